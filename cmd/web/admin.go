@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+// adminListLimit caps how many users or snippets a single admin search shows.
+const adminListLimit = 50
+
+type adminUserForm struct {
+	Disabled            bool   `form:"disabled"`
+	Role                string `form:"role"`
+	RequireTOTP         bool   `form:"requireTOTP"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.stats.Get()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	roleSettings, err := app.users.RoleSettings()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = stats
+	data.RoleSettings = roleSettings
+	app.render(w, r, http.StatusOK, "admin.tmpl.html", data)
+}
+
+// adminRoleTOTPPost turns the 2FA requirement of a role on or off. Users of
+// the role without 2FA are sent to set it up on their next request.
+func (app *application) adminRoleTOTPPost(w http.ResponseWriter, r *http.Request) {
+	role := models.Role(r.PathValue("role"))
+	if !validator.PermittedValue(role, models.Roles...) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var form adminUserForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.users.SetRoleRequiresTOTP(role, form.RequireTOTP)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.auditAdmin(r, 0, "require 2fa", map[string]string{"role": string(role), "required": strconv.FormatBool(form.RequireTOTP)})
+
+	if form.RequireTOTP {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Two-factor authentication is now required for %s accounts.", role))
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Two-factor authentication is now optional for %s accounts.", role))
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	users, err := app.users.Search(query, adminListLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Query = query
+	data.Users = users
+	app.render(w, r, http.StatusOK, "admin_users.tmpl.html", data)
+}
+
+func (app *application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var form adminUserForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.users.SetDisabled(id, form.Disabled)
+	if err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+
+	if form.Disabled {
+		app.auditAdmin(r, id, "disable user", nil)
+	} else {
+		app.auditAdmin(r, id, "enable user", nil)
+	}
+
+	if form.Disabled {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("User #%d has been disabled.", id))
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("User #%d has been enabled.", id))
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminUserResetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := app.users.RequirePasswordReset(id, forcedResetTTL)
+	if err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+
+	app.auditAdmin(r, id, "require password reset", nil)
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"Name":      user.Name,
+		"URL":       app.baseURL + "/user/password/reset/" + token,
+		"Valid":     "24 hours",
+		"ForgotURL": app.baseURL + "/user/password/forgot",
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "email/forced_reset.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error(), "email", user.Email)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("User #%d has been signed out and emailed a link to choose a new password.", id))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminUserRolePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var form adminUserForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(models.Role(form.Role), models.Roles...), "role", "Please pick one of the listed roles")
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = app.users.SetRole(id, models.Role(form.Role))
+	if err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+
+	app.auditAdmin(r, id, "change role", map[string]string{"role": form.Role})
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("User #%d is now %s.", id, form.Role))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminSnippets(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	snippets, err := app.snippets.Search(query, adminListLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Query = query
+	data.Snippets = snippets
+	app.render(w, r, http.StatusOK, "admin_snippets.tmpl.html", data)
+}
+
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	err := app.snippets.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.auditAdmin(r, 0, "delete snippet", map[string]string{"snippet": id})
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet %s has been deleted.", id))
+	http.Redirect(w, r, "/admin/snippets", http.StatusSeeOther)
+}
+
+// adminTargetUser reads the user id from the path. Admins cannot act on their
+// own account so they cannot lock themselves out by accident.
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return 0, false
+	}
+
+	if id == app.sessionManager.GetInt(r.Context(), "authenticatedUserId") {
+		app.sessionManager.Put(r.Context(), "flash", "You cannot change your own account from the admin panel.")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (app *application) adminUserError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrNoRecord) {
+		http.NotFound(w, r)
+		return
+	}
+	app.serverError(w, r, err)
+}
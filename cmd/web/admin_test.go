@@ -0,0 +1,259 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAdminAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+	}{
+		{
+			name:     "Anonymous",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Regular user",
+			email:    "alice@example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Moderator",
+			email:    "mod@example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Admin",
+			email:    "admin@example.com",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			if tt.email != "" {
+				server.login(t, tt.email, "pa$$word")
+			}
+
+			code, _, _ := server.get(t, "/admin")
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestAdminDashboard(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "admin@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/admin")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<a href='/admin'>Admin</a>")
+	assert.StringContains(t, body, "<td>2</td>")
+	assert.StringContains(t, body, "80.0 KiB")
+}
+
+func TestAdminUsers(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "admin@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/admin/users?q=mod")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "mod@example.com")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		field    string
+		value    string
+		wantCode int
+	}{
+		{
+			name:     "Disable",
+			urlPath:  "/admin/users/1/disable",
+			field:    "disabled",
+			value:    "true",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Enable",
+			urlPath:  "/admin/users/4/disable",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Disable unknown user",
+			urlPath:  "/admin/users/99/disable",
+			field:    "disabled",
+			value:    "true",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Force password reset",
+			urlPath:  "/admin/users/1/reset-password",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Force password reset on unknown user",
+			urlPath:  "/admin/users/99/reset-password",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Promote",
+			urlPath:  "/admin/users/1/role",
+			field:    "role",
+			value:    "moderator",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Unknown role",
+			urlPath:  "/admin/users/1/role",
+			field:    "role",
+			value:    "owner",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Invalid id",
+			urlPath:  "/admin/users/abc/disable",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.field != "" {
+				form.Add(tt.field, tt.value)
+			}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, header.Get("Location"), "/admin/users")
+			}
+		})
+	}
+
+	t.Run("Own account", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("disabled", "true")
+		form.Add("csrf_token", validCSRFToken)
+
+		code, _, _ := server.postForm(t, "/admin/users/3/disable", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body := server.get(t, "/admin/users")
+		assert.StringContains(t, body, "You cannot change your own account")
+	})
+}
+
+func TestAdminSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "admin@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/admin/snippets")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "snippet-hidden")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Delete hidden snippet",
+			urlPath:  "/admin/snippets/snippet-hidden/delete",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Delete snippet",
+			urlPath:  "/admin/snippets/snippet-123/delete",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/admin/snippets/snippet-404/delete",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	assert.Equal(t, len(app.snippets.(*mocks.SnippetModel).Deleted), 2)
+}
+
+func TestDisabledAccount(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	_, _, body := server.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "disabled@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, body := server.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.StringContains(t, body, "This account has been disabled")
+}
+
+func TestForcedPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := useOutbox(app)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "admin@example.com", "pa$$word")
+	_, _, body := server.get(t, "/admin/users")
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, _ := server.postForm(t, "/admin/users/1/reset-password", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	app.wg.Wait()
+	messages := outbox.Messages("alice@example.com")
+	assert.Equal(t, len(messages), 1)
+	assert.StringContains(t, messages[0].Subject, "Choose a new Snippetbox password")
+	assert.StringContains(t, messages[0].Body, "https://snippetbox.test/user/password/reset/valid-reset-token")
+
+	// the right password alone doesn't get the user back in
+	_, _, body = server.get(t, "/user/login")
+	form = url.Values{}
+	form.Add("email", "reset@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, body = server.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.StringContains(t, body, "You need to choose a new password")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go-webserver/internal/models"
+)
+
+// maxAPIBody caps the size of a JSON request body.
+const maxAPIBody = 1 << 20
+
+// apiSnippetRequest is the body of POST /api/snippets, the fields mean the
+// same as on the snippet form.
+type apiSnippetRequest struct {
+	Title          string `json:"title"`
+	Content        string `json:"content"`
+	Language       string `json:"language"`
+	Encryption     string `json:"encryption"`
+	Slug           string `json:"slug"`
+	Expires        int    `json:"expires"`
+	Org            int    `json:"org"`
+	ConfirmSecrets bool   `json:"confirmSecrets"`
+}
+
+func (app *application) apiUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.jsonError(w, r, http.StatusUnauthorized, message)
+}
+
+// apiSnippets lists the snippets of the token's owner.
+func (app *application) apiSnippets(w http.ResponseWriter, r *http.Request) {
+	apiToken, _ := app.apiToken(r)
+
+	snippets, err := app.snippets.ForUser(apiToken.UserId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if snippets == nil {
+		snippets = []models.Snippet{}
+	}
+
+	app.writeJSON(w, r, http.StatusOK, map[string]any{"snippets": snippets})
+}
+
+// apiSnippet returns any snippet the token's owner could see on the site.
+func (app *application) apiSnippet(w http.ResponseWriter, r *http.Request) {
+	apiToken, _ := app.apiToken(r)
+
+	snippet, err := app.snippets.Get(r.PathValue("id"), apiToken.UserId, false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.jsonError(w, r, http.StatusNotFound, "Snippet not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, snippet)
+}
+
+// apiSnippetCreate creates a snippet with the same checks as the snippet
+// form, including the secret scan.
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	if !app.isVerified(r) {
+		app.jsonError(w, r, http.StatusForbidden, "Please verify your email address first")
+		return
+	}
+
+	var req apiSnippetRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&req)
+	if err != nil {
+		app.jsonError(w, r, http.StatusBadRequest, "The request body must be a JSON snippet")
+		return
+	}
+
+	form := snippetCreateForm{
+		Title:          req.Title,
+		Content:        req.Content,
+		Language:       req.Language,
+		Encryption:     req.Encryption,
+		Slug:           req.Slug,
+		Expires:        req.Expires,
+		OrgId:          req.Org,
+		ConfirmSecrets: req.ConfirmSecrets,
+	}
+
+	apiToken, _ := app.apiToken(r)
+	err = app.checkSnippetForm(&form, apiToken.UserId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		app.writeJSON(w, r, http.StatusUnprocessableEntity, map[string]any{"error": "The snippet is invalid", "fields": form.FieldErrors})
+		return
+	}
+
+	id, err := app.snippets.Insert(models.SnippetRequest{
+		Title:      form.Title,
+		Content:    form.Content,
+		Language:   form.Language,
+		Encryption: form.Encryption,
+		Slug:       form.Slug,
+		Expires:    form.Expires,
+		UserId:     apiToken.UserId,
+		OrgId:      form.OrgId,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateSlug) {
+			app.writeJSON(w, r, http.StatusUnprocessableEntity, map[string]any{"error": "The snippet is invalid", "fields": map[string]string{"slug": "This slug is already taken"}})
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	url := app.baseURL + snippetURL(models.Snippet{Id: id, Slug: form.Slug})
+	w.Header().Set("Location", url)
+	app.writeJSON(w, r, http.StatusCreated, map[string]string{"id": id, "url": url})
+}
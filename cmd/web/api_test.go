@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models/mocks"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// apiRequest sends body to urlPath with token in the Authorization header,
+// GET without a body and POST with one.
+func (server *testServer) apiRequest(t *testing.T, urlPath, token, body string) (int, http.Header, string) {
+	method := http.MethodGet
+	if body != "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequest(method, server.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, res.Header, string(bytes.TrimSpace(resBody))
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+		wantUsed int
+	}{
+		{
+			name:     "No token",
+			urlPath:  "/api/snippets",
+			wantCode: http.StatusUnauthorized,
+			wantBody: "This endpoint needs an API token",
+		},
+		{
+			name:     "Invalid token",
+			token:    "expired-token",
+			urlPath:  "/api/snippets",
+			wantCode: http.StatusUnauthorized,
+			wantBody: "This token is invalid or has expired",
+		},
+		{
+			name:     "Disabled owner",
+			token:    mocks.DisabledAPIToken,
+			urlPath:  "/api/snippets",
+			wantCode: http.StatusUnauthorized,
+			wantUsed: 1,
+		},
+		{
+			name:     "Owner without required 2FA",
+			token:    mocks.EnrollAPIToken,
+			urlPath:  "/api/snippets",
+			wantCode: http.StatusForbidden,
+			wantBody: "The moderator role requires two-factor authentication",
+			wantUsed: 1,
+		},
+		{
+			name:     "Valid token",
+			token:    mocks.APIToken,
+			urlPath:  "/api/snippets",
+			wantCode: http.StatusOK,
+			wantBody: `"title":"Hello world"`,
+			wantUsed: 1,
+		},
+		{
+			name:     "Missing scope",
+			token:    mocks.ReadOnlyAPIToken,
+			urlPath:  "/api/snippets",
+			body:     `{"title":"Notes","content":"Hello","expires":7}`,
+			wantCode: http.StatusForbidden,
+			wantBody: "This token lacks the snippets:write scope",
+			wantUsed: 1,
+		},
+		{
+			name:     "Snippet",
+			token:    mocks.ReadOnlyAPIToken,
+			urlPath:  "/api/snippets/snippet-org",
+			wantCode: http.StatusOK,
+			wantBody: `"title":"On-call handbook"`,
+			wantUsed: 1,
+		},
+		{
+			name:     "Missing snippet",
+			token:    mocks.ReadOnlyAPIToken,
+			urlPath:  "/api/snippets/snippet-nope",
+			wantCode: http.StatusNotFound,
+			wantUsed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			code, header, body := server.apiRequest(t, tt.urlPath, tt.token, tt.body)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Set-Cookie"), "")
+			if code == http.StatusUnauthorized {
+				assert.Equal(t, header.Get("WWW-Authenticate"), "Bearer")
+			}
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+			assert.Equal(t, len(app.apiTokens.(*mocks.APITokenModel).Used), tt.wantUsed)
+		})
+	}
+}
+
+func TestAPISessionCookie(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	// a logged in browser must not reach the API without a token, it has no
+	// CSRF protection
+	server.login(t, "alice@example.com", "pa$$word")
+
+	code, _, _ := server.apiRequest(t, "/api/snippets", "", `{"title":"Notes","content":"Hello","expires":7}`)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.Equal(t, len(app.snippets.(*mocks.SnippetModel).Inserted), 0)
+}
+
+func TestAPISnippetCreate(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantCode     int
+		wantBody     string
+		wantInserted int
+	}{
+		{
+			name:         "Valid snippet",
+			body:         `{"title":"Notes","content":"Hello","expires":7}`,
+			wantCode:     http.StatusCreated,
+			wantBody:     `"url":"https://snippetbox.test/snippet/view/snippet-1234"`,
+			wantInserted: 1,
+		},
+		{
+			name:     "Blank title",
+			body:     `{"title":"","content":"Hello","expires":7}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"title":"This field cannot be blank"`,
+		},
+		{
+			name:     "Duplicate slug",
+			body:     `{"title":"Notes","content":"Hello","expires":7,"slug":"deploy-checklist"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"slug":"This slug is already taken"`,
+		},
+		{
+			name:     "Unknown field",
+			body:     `{"title":"Notes","content":"Hello","expires":7,"userId":2}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			code, _, body := server.apiRequest(t, "/api/snippets", mocks.APIToken, tt.body)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+
+			inserted := app.snippets.(*mocks.SnippetModel).Inserted
+			assert.Equal(t, len(inserted), tt.wantInserted)
+			if tt.wantInserted > 0 {
+				assert.Equal(t, inserted[0].UserId, 1)
+				assert.Equal(t, inserted[0].Language, "text")
+			}
+		})
+	}
+}
+
+func TestAccountTokenCreate(t *testing.T) {
+	tests := []struct {
+		name         string
+		tokenName    string
+		scopes       []string
+		expires      string
+		wantCode     int
+		wantBody     string
+		wantInserted int
+	}{
+		{
+			name:         "Valid token",
+			tokenName:    "CI",
+			scopes:       []string{"snippets:read", "snippets:write"},
+			expires:      "90",
+			wantCode:     http.StatusOK,
+			wantBody:     "Your new token: <code>valid-api-token</code>",
+			wantInserted: 1,
+		},
+		{
+			name:      "No scopes",
+			tokenName: "CI",
+			expires:   "90",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "Pick at least one scope",
+		},
+		{
+			name:      "Unknown scope",
+			tokenName: "CI",
+			scopes:    []string{"admin"},
+			expires:   "90",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must only hold the listed scopes",
+		},
+		{
+			name:      "Lifetime",
+			tokenName: "CI",
+			scopes:    []string{"snippets:read"},
+			expires:   "1000",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must be one of the listed lifetimes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, "alice@example.com", "pa$$word")
+			code, _, body := server.get(t, "/account/tokens")
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, "Deploy script")
+			assert.Equal(t, strings.Contains(body, "Your new token"), false)
+
+			form := url.Values{}
+			form.Add("name", tt.tokenName)
+			for _, scope := range tt.scopes {
+				form.Add("scopes", scope)
+			}
+			form.Add("expires", tt.expires)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body = server.postForm(t, "/account/tokens", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+
+			inserted := app.apiTokens.(*mocks.APITokenModel).Inserted
+			assert.Equal(t, len(inserted), tt.wantInserted)
+			if tt.wantInserted > 0 {
+				assert.Equal(t, inserted[0].UserId, 1)
+				assert.Equal(t, len(inserted[0].Scopes), 2)
+				assert.Equal(t, inserted[0].TTL.Hours(), float64(90*24))
+				assert.Equal(t, strings.Join(app.audits.(*mocks.AuditModel).Recorded(), ","), "login,token_create")
+			}
+		})
+	}
+}
+
+func TestAccountTokenDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		urlPath     string
+		wantCode    int
+		wantDeleted int
+	}{
+		{
+			name:        "Own token",
+			urlPath:     "/account/tokens/2/delete",
+			wantCode:    http.StatusSeeOther,
+			wantDeleted: 1,
+		},
+		{
+			name:     "Someone else's token",
+			urlPath:  "/account/tokens/3/delete",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, "alice@example.com", "pa$$word")
+			_, _, body := server.get(t, "/account/tokens")
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, len(app.apiTokens.(*mocks.APITokenModel).Deleted), tt.wantDeleted)
+			if tt.wantDeleted > 0 {
+				assert.Equal(t, strings.Join(app.audits.(*mocks.AuditModel).Recorded(), ","), "login,token_delete")
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+// tokenLifetimes are the number of days an API token can be valid for.
+var tokenLifetimes = []int{7, 30, 90, 365}
+
+type apiTokenForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
+	Expires             int      `form:"expires"`
+	validator.Validator `form:"-"`
+}
+
+func (f apiTokenForm) HasScope(scope string) bool {
+	return slices.Contains(f.Scopes, scope)
+}
+
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = apiTokenForm{Expires: 30}
+	app.renderTokens(w, r, http.StatusOK, data)
+}
+
+// accountTokenCreatePost creates an API token. Only its hash is stored, so the
+// token is shown on this response and never again.
+func (app *application) accountTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form apiTokenForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChar(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(len(form.Scopes) > 0, "scopes", "Pick at least one scope")
+	for _, scope := range form.Scopes {
+		form.CheckField(validator.PermittedValue(scope, models.APIScopes...), "scopes", "This field must only hold the listed scopes")
+	}
+	form.CheckField(validator.PermittedValue(form.Expires, tokenLifetimes...), "expires", "This field must be one of the listed lifetimes")
+
+	data := app.newTemplateData(r)
+	if !form.Valid() {
+		data.Form = form
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+	token, err := app.apiTokens.Insert(userId, form.Name, form.Scopes, time.Duration(form.Expires)*24*time.Hour)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditTokenCreate,
+		UserId:  userId,
+		Details: map[string]string{"kind": "api token", "name": form.Name, "scopes": strings.Join(form.Scopes, " ")},
+	})
+
+	data.Form = apiTokenForm{Expires: 30}
+	data.APIToken = token
+	app.renderTokens(w, r, http.StatusOK, data)
+}
+
+func (app *application) accountTokenDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+	err = app.apiTokens.Delete(userId, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditTokenDelete,
+		UserId:  userId,
+		Details: map[string]string{"kind": "api token", "id": strconv.Itoa(id)},
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "The token has been deleted, scripts using it will stop working.")
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, data templateData) {
+	tokens, err := app.apiTokens.ForUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.APITokens = tokens
+	data.APIScopes = models.APIScopes
+	data.TokenLifetimes = tokenLifetimes
+	app.render(w, r, status, "tokens.tmpl.html", data)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+// auditListLimit caps how many events the security pages show at once.
+const auditListLimit = 100
+
+// auditLabels describe the events on the security pages.
+var auditLabels = map[string]string{
+	models.AuditSignup:         "Account created",
+	models.AuditLogin:          "Logged in",
+	models.AuditLoginFailed:    "Failed login",
+	models.AuditLogout:         "Logged out",
+	models.AuditPasswordChange: "Password changed",
+	models.AuditPasswordReset:  "Password reset",
+	models.AuditTokenCreate:    "Token created",
+	models.AuditTokenDelete:    "Token deleted",
+	models.AuditTOTPEnable:     "Two-factor authentication turned on",
+	models.AuditTOTPDisable:    "Two-factor authentication turned off",
+	models.AuditPasskeyAdd:     "Passkey added",
+	models.AuditPasskeyRemove:  "Passkey removed",
+	models.AuditEmailChange:    "Email address changed",
+	models.AuditAccountDelete:  "Account deleted",
+	models.AuditModeration:     "Moderation decision",
+	models.AuditAdminAction:    "Admin action",
+}
+
+func auditLabel(event string) string {
+	if label, ok := auditLabels[event]; ok {
+		return label
+	}
+	return event
+}
+
+// audit records event with the address and user agent of the request. The
+// actor is the logged in user unless the event names one. A failure to record
+// is logged but doesn't fail the request, the action itself already happened.
+func (app *application) audit(r *http.Request, event models.AuditEvent) {
+	if event.ActorId == 0 {
+		event.ActorId = app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+	}
+	event.IP = clientIP(r)
+	event.UserAgent = r.UserAgent()
+
+	err := app.audits.Record(event)
+	if err != nil {
+		app.logger.Error(err.Error(), "event", event.Event, "method", r.Method, "uri", r.URL.RequestURI())
+	}
+}
+
+// auditAdmin records an admin action on the user with id targetId, which is 0
+// for actions that aren't about a single user.
+func (app *application) auditAdmin(r *http.Request, targetId int, action string, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["action"] = action
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditAdminAction,
+		UserId:  targetId,
+		Details: details,
+	})
+}
+
+// auditLoginFailed records a failed login for email. The event is tied to the
+// account when one exists so its owner sees it in their history.
+func (app *application) auditLoginFailed(r *http.Request, email, reason string) {
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditLoginFailed,
+		UserId:  app.userIdByEmail(email),
+		Details: map[string]string{"email": email, "reason": reason},
+	})
+}
+
+// auditTokenCreate records that a token of the given kind was sent to the
+// account with the given email address.
+func (app *application) auditTokenCreate(r *http.Request, email, kind string) {
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditTokenCreate,
+		UserId:  app.userIdByEmail(email),
+		Details: map[string]string{"kind": kind},
+	})
+}
+
+// userIdByEmail returns the id of the user with the email address, or 0.
+func (app *application) userIdByEmail(email string) int {
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		return 0
+	}
+	return user.Id
+}
+
+// accountSecurity shows the user what happened to their account lately, so
+// they can spot logins they don't recognise.
+func (app *application) accountSecurity(w http.ResponseWriter, r *http.Request) {
+	events, err := app.audits.ForUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), auditListLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.AuditEvents = events
+	app.render(w, r, http.StatusOK, "security.tmpl.html", data)
+}
+
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	event := r.URL.Query().Get("event")
+	if !validator.PermittedValue(event, models.AuditEvents...) {
+		event = ""
+	}
+
+	events, err := app.audits.Search(query, event, auditListLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Query = query
+	data.AuditEvent = event
+	data.AuditEventKinds = models.AuditEvents
+	data.AuditEvents = events
+	app.render(w, r, http.StatusOK, "admin_audit.tmpl.html", data)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models"
+	"go-webserver/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAuditLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		password   string
+		wantEvents []string
+		wantUserId int
+		wantReason string
+	}{
+		{
+			name:       "Valid credentials",
+			email:      "alice@example.com",
+			password:   "pa$$word",
+			wantEvents: []string{models.AuditLogin},
+			wantUserId: 1,
+		},
+		{
+			name:       "Wrong password",
+			email:      "alice@example.com",
+			password:   "wrong",
+			wantEvents: []string{models.AuditLoginFailed},
+			wantUserId: 1,
+			wantReason: "wrong email or password",
+		},
+		{
+			name:       "Unknown email",
+			email:      "nobody@example.com",
+			password:   "pa$$word",
+			wantEvents: []string{models.AuditLoginFailed},
+			wantReason: "wrong email or password",
+		},
+		{
+			name:       "Disabled account",
+			email:      "disabled@example.com",
+			password:   "pa$$word",
+			wantEvents: []string{models.AuditLoginFailed},
+			wantUserId: 4,
+			wantReason: "account disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			_, _, body := server.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+			server.postForm(t, "/user/login", form)
+
+			audits := app.audits.(*mocks.AuditModel)
+			assert.Equal(t, strings.Join(audits.Recorded(), ","), strings.Join(tt.wantEvents, ","))
+
+			event := audits.Events[0]
+			assert.Equal(t, event.UserId, tt.wantUserId)
+			assert.Equal(t, event.IP, "127.0.0.1")
+			assert.Equal(t, event.UserAgent, "Go-http-client/1.1")
+			if tt.wantReason != "" {
+				assert.Equal(t, event.Details["reason"], tt.wantReason)
+				assert.Equal(t, event.Details["email"], tt.email)
+			} else {
+				assert.Equal(t, event.Details["method"], "password")
+			}
+		})
+	}
+}
+
+func TestAuditLogout(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "alice@example.com", "pa$$word")
+	_, _, body := server.get(t, "/account/view")
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	server.postForm(t, "/user/logout", form)
+
+	audits := app.audits.(*mocks.AuditModel)
+	assert.Equal(t, strings.Join(audits.Recorded(), ","), "login,logout")
+	assert.Equal(t, audits.Events[1].UserId, 1)
+	assert.Equal(t, audits.Events[1].ActorId, 1)
+}
+
+func TestAuditAdminAction(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "admin@example.com", "pa$$word")
+	_, _, body := server.get(t, "/admin/users")
+
+	form := url.Values{}
+	form.Add("role", "moderator")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := server.postForm(t, "/admin/users/1/role", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	audits := app.audits.(*mocks.AuditModel)
+	assert.Equal(t, strings.Join(audits.Recorded(), ","), "login,admin_action")
+
+	event := audits.Events[1]
+	assert.Equal(t, event.ActorId, 3)
+	assert.Equal(t, event.UserId, 1)
+	assert.Equal(t, event.Details["action"], "change role")
+	assert.Equal(t, event.Details["role"], "moderator")
+}
+
+func TestAccountSecurity(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	app.audits.Record(models.AuditEvent{Event: models.AuditLoginFailed, UserId: 3, IP: "203.0.113.9"})
+
+	server.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/account/security")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<td>Logged in</td>")
+	assert.StringContains(t, body, "method: password")
+	assert.Equal(t, strings.Contains(body, "203.0.113.9"), false)
+}
+
+func TestAdminAudit(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		urlPath  string
+		wantCode int
+		wantBody string
+		hideBody string
+	}{
+		{
+			name:     "Regular user",
+			email:    "alice@example.com",
+			urlPath:  "/admin/audit",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Everyone",
+			email:    "admin@example.com",
+			urlPath:  "/admin/audit",
+			wantCode: http.StatusOK,
+			wantBody: "203.0.113.9",
+		},
+		{
+			name:     "Search",
+			email:    "admin@example.com",
+			urlPath:  "/admin/audit?q=mallory",
+			wantCode: http.StatusOK,
+			wantBody: "email: mallory@example.com",
+			hideBody: "198.51.100.7",
+		},
+		{
+			name:     "Event kind",
+			email:    "admin@example.com",
+			urlPath:  "/admin/audit?event=signup",
+			wantCode: http.StatusOK,
+			wantBody: "198.51.100.7",
+			hideBody: "203.0.113.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			app.audits.Record(models.AuditEvent{
+				Event:   models.AuditLoginFailed,
+				IP:      "203.0.113.9",
+				Details: map[string]string{"email": "mallory@example.com"},
+			})
+			app.audits.Record(models.AuditEvent{Event: models.AuditSignup, ActorId: 9, UserId: 9, IP: "198.51.100.7"})
+
+			server.login(t, tt.email, "pa$$word")
+
+			code, _, body := server.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+			if tt.hideBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.hideBody), false)
+			}
+		})
+	}
+}
+
+func TestAuditModerationDecision(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "mod@example.com", "pa$$word")
+	_, _, body := server.get(t, "/moderation")
+
+	form := url.Values{}
+	form.Add("action", "hide")
+	form.Add("reason", "Spam")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := server.postForm(t, "/moderation/report/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	audits := app.audits.(*mocks.AuditModel)
+	assert.Equal(t, strings.Join(audits.Recorded(), ","), "login,moderation")
+
+	event := audits.Events[1]
+	assert.Equal(t, event.ActorId, 2)
+	assert.Equal(t, event.Details["report"], "1")
+	assert.Equal(t, event.Details["action"], "hide")
+	assert.Equal(t, event.Details["reason"], "Spam")
+}
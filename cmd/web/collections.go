@@ -0,0 +1,336 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+type collectionCreateForm struct {
+	Name                string `form:"name"`
+	Description         string `form:"description"`
+	Visibility          string `form:"visibility"`
+	validator.Validator `form:"-"`
+}
+
+type collectionSnippetForm struct {
+	SnippetId string `form:"snippetId"`
+	Direction string `form:"direction"`
+}
+
+func (app *application) collectionList(w http.ResponseWriter, r *http.Request) {
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	collections, err := app.collections.ForUser(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collections = collections
+	app.render(w, r, http.StatusOK, "collections.tmpl.html", data)
+}
+
+func (app *application) collectionCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = collectionCreateForm{
+		Visibility: "private",
+	}
+	app.render(w, r, http.StatusOK, "collection_create.tmpl.html", data)
+}
+
+func (app *application) collectionCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChar(form.Name, 100), "name", "This field cannot exceed 100 character")
+	form.CheckField(validator.MaxChar(form.Description, 1000), "description", "This field cannot exceed 1000 character")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.CollectionVisibilities...), "visibility", "This field must be public or private")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "collection_create.tmpl.html", data)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	id, err := app.collections.Insert(userId, form.Name, form.Description, form.Visibility)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully created!")
+	http.Redirect(w, r, fmt.Sprintf("/collection/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) collectionView(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.visibleCollection(w, r)
+	if !ok {
+		return
+	}
+
+	snippets, err := app.collections.Snippets(collection.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.Snippets = snippets
+	data.IsOwner = collection.UserId == app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+	app.render(w, r, http.StatusOK, "collection.tmpl.html", data)
+}
+
+func (app *application) collectionAddPost(w http.ResponseWriter, r *http.Request) {
+	collection, form, ok := app.ownedCollectionForm(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.collections.AddSnippet(collection.Id, form.SnippetId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet added to %s", collection.Name))
+	http.Redirect(w, r, fmt.Sprintf("/collection/%d", collection.Id), http.StatusSeeOther)
+}
+
+func (app *application) collectionRemovePost(w http.ResponseWriter, r *http.Request) {
+	collection, form, ok := app.ownedCollectionForm(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.collections.RemoveSnippet(collection.Id, form.SnippetId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/%d", collection.Id), http.StatusSeeOther)
+}
+
+func (app *application) collectionMovePost(w http.ResponseWriter, r *http.Request) {
+	collection, form, ok := app.ownedCollectionForm(w, r)
+	if !ok {
+		return
+	}
+
+	var offset int
+	switch form.Direction {
+	case "up":
+		offset = -1
+	case "down":
+		offset = 1
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err := app.collections.MoveSnippet(collection.Id, form.SnippetId, offset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/%d", collection.Id), http.StatusSeeOther)
+}
+
+// collectionExport sends the whole collection as a zip archive holding a
+// manifest.json plus one file per snippet, prefixed with its position. The
+// archive is built in memory first, so a failure can still be answered with
+// an error page rather than a truncated download.
+func (app *application) collectionExport(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.visibleCollection(w, r)
+	if !ok {
+		return
+	}
+
+	snippets, err := app.collections.Snippets(collection.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	err = writeCollectionArchive(buf, collection, snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="collection-%d.zip"`, collection.Id))
+	w.Write(buf.Bytes())
+}
+
+// manifestEntry describes a snippet in the manifest of a collection export.
+// It only lists what the reader of the archive needs, not who owns the
+// snippet or how it is moderated.
+type manifestEntry struct {
+	Id        string    `json:"id"`
+	Title     string    `json:"title"`
+	Language  string    `json:"language"`
+	CreatedAt time.Time `json:"createdAt"`
+	Expires   time.Time `json:"expires"`
+	Slug      string    `json:"slug,omitempty"`
+	File      string    `json:"file"`
+}
+
+// writeCollectionArchive writes the archive collectionExport sends.
+func writeCollectionArchive(w io.Writer, collection models.Collection, snippets []models.Snippet) error {
+	manifest := struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Exported    time.Time       `json:"exported"`
+		Snippets    []manifestEntry `json:"snippets"`
+	}{
+		Name:        collection.Name,
+		Description: collection.Description,
+		Exported:    time.Now(),
+	}
+
+	archive := zip.NewWriter(w)
+	for i, snippet := range snippets {
+		name := snippetFilename(i+1, snippet)
+		manifest.Snippets = append(manifest.Snippets, manifestEntry{
+			Id:        snippet.Id,
+			Title:     snippet.Title,
+			Language:  snippet.Language,
+			CreatedAt: snippet.CreatedAt,
+			Expires:   snippet.Expires,
+			Slug:      snippet.Slug,
+			File:      name,
+		})
+
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte(snippet.Content))
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(manifest)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// visibleCollection loads the collection named in the URL. Private collections
+// are reported as not found to everyone but their owner.
+func (app *application) visibleCollection(w http.ResponseWriter, r *http.Request) (models.Collection, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Collection{}, false
+	}
+
+	collection, err := app.collections.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Collection{}, false
+	}
+
+	if collection.Visibility != "public" && collection.UserId != app.sessionManager.GetInt(r.Context(), "authenticatedUserId") {
+		http.NotFound(w, r)
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+// ownedCollectionForm decodes a collection edit form and makes sure the
+// collection belongs to the logged in user.
+func (app *application) ownedCollectionForm(w http.ResponseWriter, r *http.Request) (models.Collection, collectionSnippetForm, bool) {
+	var form collectionSnippetForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return models.Collection{}, form, false
+	}
+
+	collection, ok := app.visibleCollection(w, r)
+	if !ok {
+		return models.Collection{}, form, false
+	}
+
+	if collection.UserId != app.sessionManager.GetInt(r.Context(), "authenticatedUserId") {
+		app.clientError(w, http.StatusForbidden)
+		return models.Collection{}, form, false
+	}
+
+	return collection, form, true
+}
+
+var languageExtensions = map[string]string{
+	"go":         ".go",
+	"json":       ".json",
+	"sql":        ".sql",
+	"javascript": ".js",
+	"python":     ".py",
+	"bash":       ".sh",
+}
+
+func snippetFilename(position int, snippet models.Snippet) string {
+	return fmt.Sprintf("%02d-%s%s", position, snippet.Id, snippetExtension(snippet))
+}
+
+func snippetExtension(snippet models.Snippet) string {
+	if snippet.Encryption != "" {
+		return ".enc"
+	}
+	ext, ok := languageExtensions[snippet.Language]
+	if !ok {
+		return ".txt"
+	}
+	return ext
+}
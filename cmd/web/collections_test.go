@@ -0,0 +1,192 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"go-webserver/internal/assert"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCollectionView(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Public collection",
+			urlPath:  "/collection/1",
+			wantCode: http.StatusOK,
+			wantBody: "Onboarding",
+		},
+		{
+			name:     "Private collection of another user",
+			urlPath:  "/collection/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/collection/99",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/collection/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCollectionExport(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	code, headers, body := server.get(t, "/collection/1/export")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "application/zip")
+
+	archive, err := zip.NewReader(bytes.NewReader([]byte(body)), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, len(names), 3)
+	assert.Equal(t, names[0], "01-snippet-123.txt")
+	assert.Equal(t, names[1], "02-snippet-go.go")
+	assert.Equal(t, names[2], "manifest.json")
+
+	f, err := archive.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.StringContains(t, string(manifest), `"name": "Onboarding"`)
+	assert.StringContains(t, string(manifest), `"file": "01-snippet-123.txt"`)
+	for _, field := range []string{"userId", "orgId", "hidden", "parentId", "content"} {
+		if strings.Contains(string(manifest), `"`+field+`"`) {
+			t.Errorf("manifest contains %q", field)
+		}
+	}
+}
+
+func TestCollectionCreate(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "alice@example.com", "pa$$word")
+
+	tests := []struct {
+		name       string
+		colName    string
+		visibility string
+		wantCode   int
+	}{
+		{
+			name:       "Valid submission",
+			colName:    "Incident runbooks",
+			visibility: "private",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Empty name",
+			colName:    "",
+			visibility: "private",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Invalid visibility",
+			colName:    "Incident runbooks",
+			visibility: "secret",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, body := server.get(t, "/collection/create")
+
+			form := url.Values{}
+			form.Add("name", tt.colName)
+			form.Add("visibility", tt.visibility)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ := server.postForm(t, "/collection/create", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestCollectionAdd(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "alice@example.com", "pa$$word")
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		snippetId string
+		wantCode  int
+	}{
+		{
+			name:      "Own collection",
+			urlPath:   "/collection/1/add",
+			snippetId: "snippet-go",
+			wantCode:  http.StatusSeeOther,
+		},
+		{
+			name:      "Non-existent snippet",
+			urlPath:   "/collection/1/add",
+			snippetId: "snippet-404",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "Collection of another user",
+			urlPath:   "/collection/2/add",
+			snippetId: "snippet-go",
+			wantCode:  http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, body := server.get(t, "/snippet/view/snippet-go")
+
+			form := url.Values{}
+			form.Add("snippetId", tt.snippetId)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
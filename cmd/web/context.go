@@ -3,3 +3,7 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const roleContextKey = contextKey("role")
+const verifiedContextKey = contextKey("verified")
+const totpSetupContextKey = contextKey("totpSetup")
+const apiTokenContextKey = contextKey("apiToken")
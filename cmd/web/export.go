@@ -0,0 +1,192 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-webserver/internal/models"
+)
+
+// exportInlineLimit is the largest number of snippets exported straight away.
+// Bigger accounts get their archive built in the background.
+const exportInlineLimit = 50
+
+// Archives built in the background are deleted a while after their first
+// download, or once they are a week old.
+const (
+	exportMaxAge        = 7 * 24 * time.Hour
+	exportAfterDownload = time.Hour
+)
+
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	exports, err := app.exports.ForUser(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Exports = exports
+	app.render(w, r, http.StatusOK, "export.tmpl.html", data)
+}
+
+func (app *application) accountExportPost(w http.ResponseWriter, r *http.Request) {
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	snippets, err := app.snippets.ForUser(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Small archives are built in memory first, so a failure can still be
+	// answered with an error page rather than a truncated download.
+	if len(snippets) <= exportInlineLimit {
+		buf := new(bytes.Buffer)
+		err = writeAccountArchive(buf, user, snippets)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d.zip"`, userId))
+		w.Write(buf.Bytes())
+		return
+	}
+
+	id, err := app.exports.Insert(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		buf := new(bytes.Buffer)
+		err := writeAccountArchive(buf, user, snippets)
+		if err == nil {
+			err = app.exports.Complete(id, buf.Bytes())
+		}
+		if err != nil {
+			app.logger.Error(err.Error(), "export", id)
+			app.exports.Fail(id)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your export is being prepared, it will be listed here once it is ready.")
+	http.Redirect(w, r, "/account/export", http.StatusSeeOther)
+}
+
+func (app *application) accountExportDownload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	archive, err := app.exports.Archive(id, userId)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d-export-%d.zip"`, userId, id))
+	w.Write(archive)
+}
+
+// purgeExports deletes the archives that are no longer needed.
+func (app *application) purgeExports() {
+	err := app.exports.Purge(exportMaxAge, exportAfterDownload)
+	if err != nil {
+		app.logger.Error(err.Error())
+	}
+}
+
+// writeAccountArchive writes a zip holding profile.json, snippets.json with the
+// metadata of every snippet, and the raw content of each snippet under
+// snippets/.
+func writeAccountArchive(w io.Writer, user models.UsersNoPassword, snippets []models.Snippet) error {
+	type snippetEntry struct {
+		models.Snippet
+		File string `json:"file"`
+	}
+
+	profile := struct {
+		Id       int         `json:"id"`
+		Name     string      `json:"name"`
+		Email    string      `json:"email"`
+		Created  time.Time   `json:"created"`
+		Role     models.Role `json:"role"`
+		Exported time.Time   `json:"exported"`
+	}{
+		Id:       user.Id,
+		Name:     user.Name,
+		Email:    user.Email,
+		Created:  user.Created,
+		Role:     user.Role,
+		Exported: time.Now(),
+	}
+
+	entries := []snippetEntry{}
+
+	archive := zip.NewWriter(w)
+	for _, snippet := range snippets {
+		name := "snippets/" + snippet.Id + snippetExtension(snippet)
+		entries = append(entries, snippetEntry{Snippet: snippet, File: name})
+
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte(snippet.Content))
+		if err != nil {
+			return err
+		}
+	}
+
+	documents := []struct {
+		name  string
+		value any
+	}{
+		{"profile.json", profile},
+		{"snippets.json", entries},
+	}
+
+	for _, document := range documents {
+		f, err := archive.Create(document.name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(document.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
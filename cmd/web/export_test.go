@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"go-webserver/internal/assert"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAccountExport(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/account/export")
+	assert.Equal(t, code, http.StatusOK)
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, header, body := server.postForm(t, "/account/export", form)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/zip")
+
+	files := readZip(t, []byte(body))
+
+	var profile struct {
+		Email string `json:"email"`
+	}
+	err := json.Unmarshal(files["profile.json"], &profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, profile.Email, "alice@example.com")
+
+	var snippets []struct {
+		Id   string `json:"id"`
+		File string `json:"file"`
+	}
+	err = json.Unmarshal(files["snippets.json"], &snippets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(snippets), 2)
+	assert.Equal(t, snippets[1].File, "snippets/snippet-go.go")
+	assert.StringContains(t, string(files["snippets/snippet-go.go"]), "package main")
+}
+
+func TestAccountExportBackground(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "mod@example.com", "pa$$word")
+
+	_, _, body := server.get(t, "/account/export")
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, header, _ := server.postForm(t, "/account/export", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/export")
+
+	app.wg.Wait()
+
+	_, _, body = server.get(t, "/account/export")
+	assert.StringContains(t, body, "<a href='/account/export/1'>")
+
+	code, _, body = server.get(t, "/account/export/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(readZip(t, []byte(body))), 62)
+
+	t.Run("Someone else's export", func(t *testing.T) {
+		server := newTestServer(t, app.routes())
+		defer server.Close()
+
+		server.login(t, "alice@example.com", "pa$$word")
+
+		code, _, _ := server.get(t, "/account/export/1")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func readZip(t *testing.T, body []byte) map[string][]byte {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
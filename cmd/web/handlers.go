@@ -5,16 +5,28 @@ import (
 
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strings"
+	"time"
 
+	"go-webserver/internal/formatter"
 	"go-webserver/internal/models"
+	"go-webserver/internal/secrets"
 	"go-webserver/internal/validator"
 )
 
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Language            string            `form:"language"`
+	Encryption          string            `form:"encryption"`
+	Slug                string            `form:"slug"`
+	Expires             int               `form:"expires"`
+	OrgId               int               `form:"org"`
+	ConfirmSecrets      bool              `form:"confirmSecrets"`
+	SecretFindings      []secrets.Finding `form:"-"`
+	SecretsBlocked      bool              `form:"-"`
 	validator.Validator `form:"-"`
 }
 
@@ -35,10 +47,18 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-
 	data.Form = snippetCreateForm{
-		Expires: 365,
+		Expires:  365,
+		Language: "text",
+	}
+
+	var err error
+	data.Orgs, err = app.orgs.ForUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
+
 	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
 }
 
@@ -49,7 +69,7 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 	}
 
-	snippet, err := app.snippets.Get(id)
+	snippet, err := app.snippets.Get(id, app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), app.role(r).AtLeast(models.RoleModerator))
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			http.NotFound(w, r)
@@ -58,8 +78,66 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+
+	// Snippets with a custom slug have that as their canonical address, the
+	// nanoid URL keeps working but only redirects there.
+	if snippet.Slug != "" {
+		http.Redirect(w, r, snippetURL(snippet), http.StatusMovedPermanently)
+		return
+	}
+
+	app.renderSnippet(w, r, snippet)
+}
+
+func (app *application) snippetViewBySlug(w http.ResponseWriter, r *http.Request) {
+	snippet, err := app.snippets.GetBySlug(r.PathValue("slug"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), app.role(r).AtLeast(models.RoleModerator))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.renderSnippet(w, r, snippet)
+}
+
+func (app *application) renderSnippet(w http.ResponseWriter, r *http.Request, snippet models.Snippet) {
+	var err error
+
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	// Organization snippets are only ever shown to members, they can't be
+	// added to collections which might be public.
+	if snippet.OrgId != nil {
+		data.Org, err = app.orgs.Get(*snippet.OrgId, userId)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else if data.IsAuthenticated {
+		data.Collections, err = app.collections.ForUser(userId)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data.Stars, err = app.stars.Count(snippet.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if data.IsAuthenticated {
+		data.Starred, err = app.stars.Starred(snippet.Id, userId)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
 
 	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
 }
@@ -72,32 +150,386 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	err = app.checkSnippetForm(&form, userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		app.renderSnippetCreateForm(w, r, form)
+		return
+	}
+
+	id, err := app.snippets.Insert(models.SnippetRequest{
+		Title:      form.Title,
+		Content:    form.Content,
+		Language:   form.Language,
+		Encryption: form.Encryption,
+		Slug:       form.Slug,
+		Expires:    form.Expires,
+		UserId:     userId,
+		OrgId:      form.OrgId,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateSlug) {
+			form.AddFieldError("slug", "This slug is already taken")
+			app.renderSnippetCreateForm(w, r, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created! ")
+	http.Redirect(w, r, snippetURL(models.Snippet{Id: id, Slug: form.Slug}), http.StatusSeeOther)
+}
+
+// checkSnippetForm normalises and validates a new snippet by userId, the
+// problems end up in the form. Only a failure to check org membership is
+// returned as an error.
+func (app *application) checkSnippetForm(form *snippetCreateForm, userId int) error {
+	if form.Language == "" {
+		form.Language = "text"
+	}
+	form.Slug = strings.ToLower(strings.TrimSpace(form.Slug))
+
 	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
 	form.CheckField(validator.MaxChar(form.Title, 100), "title", "This field cannot exceed 100 character")
 	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
 	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(validator.PermittedValue(form.Language, models.SnippetLanguages...), "language", "This field must be one of the listed languages")
+
+	if form.Slug != "" {
+		form.CheckField(validator.MinChars(form.Slug, 3), "slug", "This field needs to be atleast 3 characters long")
+		form.CheckField(validator.MaxChar(form.Slug, 60), "slug", "This field cannot exceed 60 character")
+		form.CheckField(validator.Matches(form.Slug, validator.SlugRegex), "slug", "Only lowercase letters, numbers and single dashes are allowed")
+		form.CheckField(!reservedSlug(form.Slug), "slug", "This slug is reserved, please pick another one")
+	}
+
+	if form.OrgId != 0 {
+		_, err := app.orgs.Get(form.OrgId, userId)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			return err
+		}
+		form.CheckField(err == nil, "org", "You are not a member of this organization")
+	}
+
+	if form.Encryption != "" {
+		// The content is ciphertext produced in the browser, all the server can
+		// check is that it has the expected shape. It can't be scanned either.
+		form.CheckField(validator.PermittedValue(form.Encryption, models.SnippetEncryptions...), "content", "This encryption scheme is not supported")
+		form.CheckField(validator.Base64(form.Content, 28), "content", "Encrypted content is malformed")
+	} else {
+		app.scanSecrets(form)
+	}
+
+	return nil
+}
+
+// renderSnippetCreateForm re-renders a rejected snippet form.
+func (app *application) renderSnippetCreateForm(w http.ResponseWriter, r *http.Request, form snippetCreateForm) {
+	if form.Encryption != "" {
+		// Never echo ciphertext back into the textarea, it would be
+		// encrypted a second time on the next submit.
+		form.Content = ""
+		form.Encryption = ""
+		form.AddFieldError("content", "Please enter your content again, it will be encrypted in your browser")
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	var err error
+	data.Orgs, err = app.orgs.ForUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+}
+
+// reservedSlugs can't be used as custom slugs because they collide with, or
+// could be mistaken for, pages of the site itself.
+var reservedSlugs = []string{
+	"about", "account", "admin", "api", "collection", "collections", "create", "delete",
+	"edit", "export", "format", "login", "logout", "new", "ping", "s", "settings",
+	"signup", "snippet", "static", "user", "view",
+}
+
+func reservedSlug(slug string) bool {
+	return validator.PermittedValue(slug, reservedSlugs...) || strings.HasPrefix(slug, "snippet-")
+}
+
+// snippetFormat shows a preview of the snippet run through the formatter for
+// its language. Parse errors are rendered next to the offending line.
+func (app *application) snippetFormat(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.formattableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	formatted, err := formatter.Format(snippet.Language, snippet.Content)
+	if err != nil {
+		var fmtErr *formatter.Error
+		if !errors.As(err, &fmtErr) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.FormatError = fmtErr
+		app.render(w, r, http.StatusUnprocessableEntity, "format.tmpl.html", data)
+		return
+	}
+
+	data.Formatted = formatted
+	app.render(w, r, http.StatusOK, "format.tmpl.html", data)
+}
+
+// snippetFormatPost saves the formatted content as a new revision of the
+// snippet, keeping the title, language and remaining lifetime of the original
+// and linking back to it.
+func (app *application) snippetFormatPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.formattableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	formatted, err := formatter.Format(snippet.Language, snippet.Content)
+	if err != nil {
+		var fmtErr *formatter.Error
+		if errors.As(err, &fmtErr) {
+			app.clientError(w, http.StatusUnprocessableEntity)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	id, err := app.snippets.Insert(models.SnippetRequest{
+		Title:    snippet.Title,
+		Content:  formatted,
+		Language: snippet.Language,
+		Expires:  remainingDays(snippet),
+		UserId:   app.sessionManager.GetInt(r.Context(), "authenticatedUserId"),
+		OrgId:    orgId(snippet),
+		ParentId: snippet.Id,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Formatted snippet saved!")
+	http.Redirect(w, r, snippetURL(models.Snippet{Id: id}), http.StatusSeeOther)
+}
+
+// snippetForkPost copies a snippet into the user's own snippets, linked back
+// to the original so its author gets credit for the fork. Encrypted content is
+// copied as it is, the key from the original link still opens it.
+func (app *application) snippetForkPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.snippets.Insert(models.SnippetRequest{
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Language:   snippet.Language,
+		Encryption: snippet.Encryption,
+		Expires:    remainingDays(snippet),
+		UserId:     app.sessionManager.GetInt(r.Context(), "authenticatedUserId"),
+		OrgId:      orgId(snippet),
+		ParentId:   snippet.Id,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet forked!")
+	http.Redirect(w, r, snippetURL(models.Snippet{Id: id}), http.StatusSeeOther)
+}
+
+// remainingDays is the lifetime left to a snippet in whole days, at least
+// one, for copies that shouldn't outlive their original.
+func remainingDays(snippet models.Snippet) int {
+	return max(int(math.Ceil(time.Until(snippet.Expires).Hours()/24)), 1)
+}
+
+// orgId returns the organization a snippet belongs to, or 0.
+func orgId(snippet models.Snippet) int {
+	if snippet.OrgId == nil {
+		return 0
+	}
+	return *snippet.OrgId
+}
+
+// formattableSnippet loads the snippet named in the URL and makes sure its
+// language has a formatter. It writes the error response itself when not.
+func (app *application) formattableSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, err := app.snippets.Get(r.PathValue("id"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if snippet.Encryption != "" || !formatter.Supports(snippet.Language) {
+		app.clientError(w, http.StatusBadRequest)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// visibleSnippet loads the snippet named in the URL if the user may see it.
+// It writes the error response itself when not.
+func (app *application) visibleSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, err := app.snippets.Get(r.PathValue("id"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// snippetEdit shows the edit form for an organization snippet. Members of the
+// organization can change its title, language and content.
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetCreateForm{
+		Title:    snippet.Title,
+		Content:  snippet.Content,
+		Language: snippet.Language,
+	}
+	app.render(w, r, http.StatusOK, "edit.tmpl.html", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.Language == "" {
+		form.Language = "text"
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChar(form.Title, 100), "title", "This field cannot exceed 100 character")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.PermittedValue(form.Language, models.SnippetLanguages...), "language", "This field must be one of the listed languages")
+	app.scanSecrets(&form)
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
+		data.Snippet = snippet
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.tmpl.html", data)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	err = app.snippets.Update(snippet.Id, form.Title, form.Content, form.Language)
 	if err != nil {
-		app.serverError(w, r, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created! ")
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", id), http.StatusSeeOther)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+}
+
+// editableSnippet loads the snippet named in the URL if the user may edit it:
+// it has to belong to one of their organizations and can't be encrypted,
+// since the server never sees the plaintext. It writes the error response
+// itself when not.
+func (app *application) editableSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, err := app.snippets.Get(r.PathValue("id"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if snippet.OrgId == nil {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	if snippet.Encryption != "" {
+		app.clientError(w, http.StatusBadRequest)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// scanSecrets checks the snippet content for credentials before it is stored.
+// Depending on the configured policy the author either has to confirm the
+// findings or the snippet is rejected outright.
+func (app *application) scanSecrets(form *snippetCreateForm) {
+	if app.secretScanner == nil {
+		return
+	}
+
+	form.SecretFindings = app.secretScanner.Scan(form.Content)
+	if len(form.SecretFindings) == 0 {
+		return
+	}
+
+	if app.blockSecrets {
+		form.SecretsBlocked = true
+		form.AddFieldError("content", "This snippet appears to contain secrets and cannot be published. Please redact them")
+		return
+	}
+
+	if !form.ConfirmSecrets {
+		form.AddFieldError("content", "This snippet appears to contain secrets. Redact them or confirm that you want to publish it anyway")
+	}
 }
 
 type userSignupForm struct {
 	Name                string `form:"name"`
+	Username            string `form:"username"`
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	Invite              string `form:"invite"`
 	validator.Validator `form:"-"`
 }
 
@@ -114,14 +546,28 @@ type accountPasswordUpdateForm struct {
 	validator.Validator     `form:"-"`
 }
 
+type accountDeleteForm struct {
+	Password            string `form:"password"`
+	Snippets            string `form:"snippets"`
+	validator.Validator `form:"-"`
+}
+
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
+	// invite links carry the code so it doesn't have to be typed in
+	data.Form = userSignupForm{Invite: r.URL.Query().Get("invite")}
 
 	app.render(w, r, http.StatusOK, "signup.tmpl.html", data)
 }
 
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	if app.signupMode == signupClosed {
+		data := app.newTemplateData(r)
+		data.Form = userSignupForm{}
+		app.render(w, r, http.StatusForbidden, "signup.tmpl.html", data)
+		return
+	}
+
 	var form userSignupForm
 
 	err := app.decodePostForm(r, &form)
@@ -130,12 +576,29 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	form.Username = strings.ToLower(strings.TrimSpace(form.Username))
+	form.Email = models.NormalizeEmail(form.Email)
+	form.Invite = strings.TrimSpace(form.Invite)
+
 	form.CheckField(validator.NotBlank(form.Email), "email", "this field cannot be blank")
 	form.CheckField(validator.NotBlank(form.Name), "name", "this field cannot be blank")
+	form.CheckField(validator.Matches(form.Username, validator.UsernameRegex), "username", usernameRules)
+	form.CheckField(!reservedUsername(form.Username), "username", "This username is reserved, please pick another one")
 	form.CheckField(validator.NotBlank(form.Password), "password", "this field cannot be blank")
 
 	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "this field needs to be a valid email address")
 	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field needs to be atleast 8 characters long")
+	problem, err := app.passwordProblem(form.Password, form.Name, form.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if problem != "" {
+		form.AddFieldError("password", problem)
+	}
+	if app.signupMode == signupInvite {
+		form.CheckField(validator.NotBlank(form.Invite), "invite", "You need an invite code to sign up")
+	}
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
@@ -144,22 +607,42 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	var id int
+	if app.signupMode == signupInvite {
+		id, err = app.users.InsertInvited(form.Name, form.Username, form.Email, form.Password, form.Invite)
+	} else {
+		id, err = app.users.Insert(form.Name, form.Username, form.Email, form.Password)
+	}
 	if err != nil {
-		// we check is the error because of duplicate email. If yes we re render the thing but adding a new error field
-		if errors.Is(err, models.ErrDuplicateEmail) {
+		// we check is the error because of duplicate email or username. If yes we re render the thing but adding a new error field
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
 			form.AddFieldError("email", "Email address is already in use")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
-		} else {
+		case errors.Is(err, models.ErrDuplicateUsername):
+			form.AddFieldError("username", "This username is already taken")
+		case errors.Is(err, models.ErrInvalidInvite):
+			form.AddFieldError("invite", "This invite code is invalid or has been used up")
+		default:
 			app.serverError(w, r, err)
+			return
 		}
 
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditSignup,
+		ActorId: id,
+		UserId:  id,
+		Details: map[string]string{"email": form.Email, "username": form.Username, "mode": app.signupMode},
+	})
+
+	app.sendVerificationEmail(id, form.Name, form.Email)
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Check your inbox to verify your email address, then log in.")
 	// And redirect the user to the login page.
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
@@ -188,28 +671,132 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		data.Form = form
 		fmt.Println(data.Form)
 		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		return
+	}
+
+	wait, locked, err := app.loginReserve(r, form.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if wait > 0 {
+		if locked {
+			form.AddNonFieldError("This account is locked after too many failed logins, please try again later")
+		} else {
+			form.AddNonFieldError(fmt.Sprintf("Too many failed logins, please wait %s and try again", wait.Round(time.Second)))
+		}
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "login.tmpl.html", data)
+		return
 	}
 
 	id, err := app.users.Authenticate(form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.auditLoginFailed(r, form.Email, "wrong email or password")
+			err = app.loginFailed(r, form.Email)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
 			form.AddNonFieldError("Email or password is incorrect")
 			data := app.newTemplateData(r)
 			data.Form = form
 			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			app.auditLoginFailed(r, form.Email, "account disabled")
+			err = app.loginReleased(r, form.Email)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			form.AddNonFieldError("This account has been disabled")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusForbidden, "login.tmpl.html", data)
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	err = app.sessionManager.RenewToken(r.Context())
+	err = app.loginSucceeded(r, form.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// After an admin forced a password reset only the emailed link gets the
+	// user back in, the old password may be known to someone else.
+	if user.PasswordResetRequired {
+		app.auditLoginFailed(r, form.Email, "password reset required")
+		form.AddNonFieldError(forcedResetMessage)
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusForbidden, "login.tmpl.html", data)
+		return
+	}
+
+	// With 2FA turned on the password alone only gets the user as far as the
+	// second step.
+	if user.TOTPEnabled {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "passwordVerifiedUserId", id)
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	app.completeLogin(w, r, id, "password")
+}
+
+// completeLogin logs the user in and sends them back to the page they were
+// trying to reach.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, id int, method string) {
+	err := app.startSession(r, id, method)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+
+	http.Redirect(w, r, app.loginRedirect(r), http.StatusSeeOther)
+}
+
+// startSession logs the user in, method says how they proved who they are.
+func (app *application) startSession(r *http.Request, id int, method string) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
 	app.sessionManager.Put(r.Context(), "authenticatedUserId", id)
 
+	err = app.recordSession(r, id)
+	if err != nil {
+		return err
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditLogin,
+		UserId:  id,
+		Details: map[string]string{"method": method},
+	})
+	return nil
+}
+
+// loginRedirect is where to go after logging in, the page the user was sent
+// away from or else the snippet form.
+func (app *application) loginRedirect(r *http.Request) string {
 	// my way
 	// url, ok := app.sessionManager.Get(r.Context(), "redirect").(string)
 	// if ok {
@@ -220,21 +807,32 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	path := app.sessionManager.PopString(r.Context(), "redirect")
 	if path != "" {
-		http.Redirect(w, r, path, http.StatusSeeOther)
-		return
+		return path
 	}
 
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	return "/snippet/create"
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	err := app.sessionManager.RenewToken(r.Context())
+	app.audit(r, models.AuditEvent{
+		Event:  models.AuditLogout,
+		UserId: app.sessionManager.GetInt(r.Context(), "authenticatedUserId"),
+	})
+
+	err := app.sessions.Revoke(app.sessionManager.GetInt(r.Context(), "sessionId"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
 	app.sessionManager.Remove(r.Context(), "authenticatedUserId")
+	app.sessionManager.Remove(r.Context(), "sessionId")
 
 	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
 
@@ -290,6 +888,22 @@ func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http
 	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPassword", "New password and password confirmation need to be the same value")
 	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "New password and password confirmation need to be the same value")
 
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	problem, err := app.passwordProblem(form.NewPassword, user.Name, user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if problem != "" {
+		form.AddFieldError("newPassword", problem)
+	}
+
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
@@ -297,8 +911,6 @@ func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http
 		return
 	}
 
-	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
-
 	err = app.users.PasswordUpdate(userId, form.CurrPassword, form.NewPassword)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
@@ -311,9 +923,81 @@ func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http
 		}
 		return
 	}
+
+	app.audit(r, models.AuditEvent{Event: models.AuditPasswordChange, UserId: userId})
+
+	// whoever else knew the old password is signed out
+	err = app.sessions.RevokeOthers(app.sessionManager.GetInt(r.Context(), "sessionId"), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
+func (app *application) accountDelete(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountDeleteForm{Snippets: "delete"}
+	app.render(w, r, http.StatusOK, "delete.tmpl.html", data)
+}
+
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form accountDeleteForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "this field cannot be blank")
+	form.CheckField(validator.PermittedValue(form.Snippets, "delete", "keep"), "snippets", "Please choose what happens to your snippets")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "delete.tmpl.html", data)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	err = app.users.Delete(userId, form.Password, form.Snippets == "keep")
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			form.AddFieldError("password", "Password is incorrect")
+		case errors.Is(err, models.ErrLastOwner):
+			form.AddNonFieldError("You are the last owner of an organization, make someone else an owner first")
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "delete.tmpl.html", data)
+		return
+	}
+
+	// Recorded before the session goes, it names the actor.
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditAccountDelete,
+		UserId:  userId,
+		Details: map[string]string{"snippets": form.Snippets},
+	})
+
+	// The model already revoked the stored sessions, this also drops the cookie.
+	err = app.sessionManager.Destroy(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OKE"))
 }
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
 	"go-webserver/internal/assert"
+	"go-webserver/internal/models/mocks"
+	"html"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -43,6 +51,12 @@ func TestSnippetView(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantBody: "RIO RIO RIO RIO RIO ",
 		},
+		{
+			name:     "Formatted revision",
+			urlPath:  "/snippet/view/snippet-revision",
+			wantCode: http.StatusOK,
+			wantBody: "Based on <a href='/snippet/view/snippet-go'>",
+		},
 		{
 			name:     "Non-existent ID",
 			urlPath:  "/snippet/view/snippet-1234121",
@@ -80,21 +94,25 @@ func TestUserSignup(t *testing.T) {
 		validName     = "Bob"
 		validPassword = "validPa$$word"
 		validEmail    = "bob@example.com"
+		validUsername = "bob"
 		formTag       = "<form action='/user/signup' method='POST' novalidate>"
 	)
 	tests := []struct {
 		name         string
 		userName     string
 		userEmail    string
+		userUsername string
 		userPassword string
 		csrfToken    string
 		wantCode     int
 		wantFormTag  string
+		wantError    string
 	}{
 		{
 			name:         "Valid submission",
 			userName:     validName,
 			userEmail:    validEmail,
+			userUsername: validUsername,
 			userPassword: validPassword,
 			csrfToken:    validCSRFToken,
 			wantCode:     http.StatusSeeOther,
@@ -103,6 +121,7 @@ func TestUserSignup(t *testing.T) {
 			name:         "Invalid CSRF Token",
 			userName:     validName,
 			userEmail:    validEmail,
+			userUsername: validUsername,
 			userPassword: validPassword,
 			csrfToken:    "wrongToken",
 			wantCode:     http.StatusBadRequest,
@@ -111,6 +130,7 @@ func TestUserSignup(t *testing.T) {
 			name:         "Empty name",
 			userName:     "",
 			userEmail:    validEmail,
+			userUsername: validUsername,
 			userPassword: validPassword,
 			csrfToken:    validCSRFToken,
 			wantCode:     http.StatusUnprocessableEntity,
@@ -120,6 +140,7 @@ func TestUserSignup(t *testing.T) {
 			name:         "Empty email",
 			userName:     validName,
 			userEmail:    "",
+			userUsername: validUsername,
 			userPassword: validPassword,
 			csrfToken:    validCSRFToken,
 			wantCode:     http.StatusUnprocessableEntity,
@@ -129,6 +150,7 @@ func TestUserSignup(t *testing.T) {
 			name:         "Empty password",
 			userName:     validName,
 			userEmail:    validEmail,
+			userUsername: validUsername,
 			userPassword: "",
 			csrfToken:    validCSRFToken,
 			wantCode:     http.StatusUnprocessableEntity,
@@ -138,6 +160,7 @@ func TestUserSignup(t *testing.T) {
 			name:         "Invalid email",
 			userName:     validName,
 			userEmail:    "bob@example.",
+			userUsername: validUsername,
 			userPassword: validPassword,
 			csrfToken:    validCSRFToken,
 			wantCode:     http.StatusUnprocessableEntity,
@@ -147,15 +170,83 @@ func TestUserSignup(t *testing.T) {
 			name:         "Short password",
 			userName:     validName,
 			userEmail:    validEmail,
+			userUsername: validUsername,
 			userPassword: "pa$$",
 			csrfToken:    validCSRFToken,
 			wantCode:     http.StatusUnprocessableEntity,
 			wantFormTag:  formTag,
 		},
+		{
+			name:         "Breached password",
+			userName:     validName,
+			userEmail:    validEmail,
+			userUsername: validUsername,
+			userPassword: "Tr0ub4dor&3",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "This password has appeared in a data breach",
+		},
+		{
+			name:         "Common password",
+			userName:     validName,
+			userEmail:    validEmail,
+			userUsername: validUsername,
+			userPassword: "Password123",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "This password is based on a commonly used password or word",
+		},
+		{
+			name:         "Password made of own details",
+			userName:     validName,
+			userEmail:    validEmail,
+			userUsername: validUsername,
+			userPassword: "bobbob2024",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "This password is too close to your name or email address",
+		},
+		{
+			name:         "Reserved username",
+			userName:     validName,
+			userEmail:    validEmail,
+			userUsername: "admin",
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "This username is reserved",
+		},
+		{
+			name:         "Invalid username",
+			userName:     validName,
+			userEmail:    validEmail,
+			userUsername: "-bob!",
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "Usernames are 3 to 30 lowercase letters",
+		},
+		{
+			name:         "Duplicate username",
+			userName:     validName,
+			userEmail:    validEmail,
+			userUsername: "alice",
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "This username is already taken",
+		},
 		{
 			name:         "Duplicate email",
 			userName:     validName,
 			userEmail:    "dupe@example.com",
+			userUsername: validUsername,
 			userPassword: validPassword,
 			csrfToken:    validCSRFToken,
 			wantCode:     http.StatusUnprocessableEntity,
@@ -167,6 +258,7 @@ func TestUserSignup(t *testing.T) {
 			form := url.Values{}
 			form.Add("name", tt.userName)
 			form.Add("email", tt.userEmail)
+			form.Add("username", tt.userUsername)
 			form.Add("password", tt.userPassword)
 			form.Add("csrf_token", tt.csrfToken)
 			code, _, body := server.postForm(t, "/user/signup", form)
@@ -174,6 +266,9 @@ func TestUserSignup(t *testing.T) {
 			if tt.wantFormTag != "" {
 				assert.StringContains(t, body, tt.wantFormTag)
 			}
+			if tt.wantError != "" {
+				assert.StringContains(t, body, tt.wantError)
+			}
 		})
 	}
 }
@@ -258,3 +353,447 @@ func TestSnippetCreate(t *testing.T) {
 // 	}
 
 // }
+
+func TestSnippetCreateSecrets(t *testing.T) {
+	const secretContent = "PGHOST=localhost\nPGPASSWORD=hunter2"
+
+	tests := []struct {
+		name          string
+		block         bool
+		content       string
+		confirm       bool
+		wantCode      int
+		wantBody      string
+		wantNotInBody string
+	}{
+		{
+			name:     "Clean content",
+			content:  "fmt.Println(\"hello\")",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Secret warns",
+			content:  secretContent,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Password assignment",
+		},
+		{
+			name:     "Secret confirmed",
+			content:  secretContent,
+			confirm:  true,
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:          "Secret blocked",
+			block:         true,
+			content:       secretContent,
+			confirm:       true,
+			wantCode:      http.StatusUnprocessableEntity,
+			wantBody:      "cannot be published",
+			wantNotInBody: "confirmSecrets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.blockSecrets = tt.block
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, "alice@example.com", "pa$$word")
+
+			_, _, body := server.get(t, "/snippet/create")
+			form := url.Values{}
+			form.Add("title", "Deploy notes")
+			form.Add("content", tt.content)
+			form.Add("expires", "7")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+			if tt.confirm {
+				form.Add("confirmSecrets", "true")
+			}
+
+			code, _, body := server.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+			if tt.wantNotInBody != "" && strings.Contains(body, tt.wantNotInBody) {
+				t.Errorf("body should not contain %q", tt.wantNotInBody)
+			}
+		})
+	}
+}
+
+func TestSnippetFormat(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Go snippet",
+			urlPath:  "/snippet/format/snippet-go",
+			wantCode: http.StatusOK,
+			wantBody: "func main() {",
+		},
+		{
+			name:     "Broken JSON",
+			urlPath:  "/snippet/format/snippet-json",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "line 3",
+		},
+		{
+			name:     "Plain text",
+			urlPath:  "/snippet/format/snippet-123",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/format/snippet-404",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Save formatted", func(t *testing.T) {
+		server.login(t, "alice@example.com", "pa$$word")
+
+		_, _, body := server.get(t, "/snippet/format/snippet-go")
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, headers, _ := server.postForm(t, "/snippet/format/snippet-go", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/snippet-1234")
+
+		inserted := app.snippets.(*mocks.SnippetModel).Inserted
+		assert.Equal(t, inserted[len(inserted)-1].ParentId, "snippet-go")
+	})
+}
+
+// encryptLikeBrowser produces content in the same format as encrypt.js.
+func encryptLikeBrowser(t *testing.T, key []byte, plaintext string) string {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(iv, iv, []byte(plaintext), nil))
+}
+
+func TestSnippetCreateEncrypted(t *testing.T) {
+	const plaintext = "PGPASSWORD=hunter2 is the production password"
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := encryptLikeBrowser(t, key, plaintext)
+
+	tests := []struct {
+		name       string
+		content    string
+		encryption string
+		wantCode   int
+	}{
+		{
+			name:       "Valid ciphertext",
+			content:    ciphertext,
+			encryption: "aes-256-gcm",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Not base64",
+			content:    plaintext,
+			encryption: "aes-256-gcm",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Unknown scheme",
+			content:    ciphertext,
+			encryption: "rot13",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, "alice@example.com", "pa$$word")
+
+			_, _, body := server.get(t, "/snippet/create")
+			form := url.Values{}
+			form.Add("title", "Encrypted")
+			form.Add("content", tt.content)
+			form.Add("encryption", tt.encryption)
+			form.Add("expires", "7")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := server.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			inserted := app.snippets.(*mocks.SnippetModel).Inserted
+			if tt.wantCode != http.StatusSeeOther {
+				assert.Equal(t, len(inserted), 0)
+				if strings.Contains(body, tt.content) {
+					t.Error("rejected content should not be echoed back")
+				}
+				return
+			}
+
+			assert.Equal(t, len(inserted), 1)
+			assert.Equal(t, inserted[0].Content, ciphertext)
+			assert.Equal(t, inserted[0].Encryption, "aes-256-gcm")
+			if strings.Contains(inserted[0].Content, "hunter2") {
+				t.Error("plaintext reached the snippet model")
+			}
+		})
+	}
+}
+
+func TestSnippetViewEncrypted(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	code, _, body := server.get(t, "/snippet/view/snippet-enc")
+	assert.Equal(t, code, http.StatusOK)
+
+	if strings.Contains(body, "my secret plan") {
+		t.Fatal("plaintext found in the page")
+	}
+
+	matches := regexp.MustCompile(`data-ciphertext='([^']+)'`).FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no ciphertext found in the page")
+	}
+
+	// Only the holder of the key from the URL fragment can recover the content.
+	payload, err := base64.StdEncoding.DecodeString(html.UnescapeString(matches[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.RawURLEncoding.DecodeString("AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, payload[:12], payload[12:], nil)
+	assert.NilError(t, err)
+	assert.Equal(t, string(plaintext), "my secret plan")
+
+	code, _, _ = server.get(t, "/snippet/format/snippet-enc")
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestSnippetSlug(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	t.Run("View by slug", func(t *testing.T) {
+		code, _, body := server.get(t, "/s/deploy-checklist")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Tag the release")
+	})
+
+	t.Run("Unknown slug", func(t *testing.T) {
+		code, _, _ := server.get(t, "/s/no-such-slug")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Nanoid redirects to slug", func(t *testing.T) {
+		code, headers, _ := server.get(t, "/snippet/view/snippet-slug")
+		assert.Equal(t, code, http.StatusMovedPermanently)
+		assert.Equal(t, headers.Get("Location"), "/s/deploy-checklist")
+	})
+
+	server.login(t, "alice@example.com", "pa$$word")
+
+	tests := []struct {
+		name         string
+		slug         string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "No slug",
+			slug:         "",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/snippet-1234",
+		},
+		{
+			name:         "Valid slug",
+			slug:         "Release-Notes ",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/s/release-notes",
+		},
+		{
+			name:     "Invalid characters",
+			slug:     "release_notes!",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Double dash",
+			slug:     "release--notes",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Too short",
+			slug:     "ab",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Reserved word",
+			slug:     "admin",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Looks like a nanoid",
+			slug:     "snippet-123",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Already taken",
+			slug:     "deploy-checklist",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, body := server.get(t, "/snippet/create")
+			form := url.Values{}
+			form.Add("title", "Release notes")
+			form.Add("content", "Nothing to see here")
+			form.Add("expires", "7")
+			form.Add("slug", tt.slug)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := server.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantLocation != "" {
+				assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestAccountDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		snippets string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Delete snippets",
+			email:    "mod@example.com",
+			password: "pa$$word",
+			snippets: "delete",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Keep snippets",
+			email:    "mod@example.com",
+			password: "pa$$word",
+			snippets: "keep",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Wrong password",
+			email:    "mod@example.com",
+			password: "wrongPa$$word",
+			snippets: "delete",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Blank password",
+			email:    "mod@example.com",
+			password: "",
+			snippets: "delete",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Last owner of an organization",
+			email:    "alice@example.com",
+			password: "pa$$word",
+			snippets: "delete",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "You are the last owner of an organization",
+		},
+		{
+			name:     "Unknown snippet choice",
+			email:    "mod@example.com",
+			password: "pa$$word",
+			snippets: "archive",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+
+			_, _, body := server.get(t, "/account/delete")
+
+			form := url.Values{}
+			form.Add("password", tt.password)
+			form.Add("snippets", tt.snippets)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := server.postForm(t, "/account/delete", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+
+			// a deleted account leaves the client logged out
+			code, _, _ = server.get(t, "/account/view")
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, code, http.StatusSeeOther)
+				assert.Equal(t, strings.Join(app.audits.(*mocks.AuditModel).Recorded(), ","), "login,account_delete")
+			} else {
+				assert.Equal(t, code, http.StatusOK)
+			}
+		})
+	}
+}
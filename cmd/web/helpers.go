@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"time"
 
+	"go-webserver/internal/models"
+	"go-webserver/internal/passwords"
+
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
 )
@@ -17,10 +21,25 @@ func (app *application) newTemplateData(r *http.Request) templateData {
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
+		Role:            app.role(r),
+		Roles:           models.Roles,
 		CSRFToken:       nosurf.Token(r),
+		Languages:       models.SnippetLanguages,
+		ReportReasons:   models.ReportReasons,
+		SSOName:         app.ssoName(),
+		SignupMode:      app.signupMode,
 	}
 }
 
+// ssoName is what the single sign-on provider is called on the login page, or
+// empty when there is none.
+func (app *application) ssoName() string {
+	if app.sso == nil {
+		return ""
+	}
+	return app.sso.name
+}
+
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	var (
 		method = r.Method
@@ -60,6 +79,35 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	buf.WriteTo(w)
 }
 
+// background runs fn in its own goroutine. Panics are logged instead of taking
+// the server down, and app.wg lets callers wait for running jobs.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// housekeeping deletes data that has outlived its use every interval. It runs
+// for as long as the server does.
+func (app *application) housekeeping(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		app.purgeLoginAttempts()
+		app.purgeExports()
+	}
+}
+
 func (app *application) decodePostForm(r *http.Request, destination any) error {
 	err := r.ParseForm()
 	if err != nil {
@@ -87,3 +135,67 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// apiToken returns the API token the request was authenticated with, if any.
+func (app *application) apiToken(r *http.Request) (models.APIToken, bool) {
+	apiToken, ok := r.Context().Value(apiTokenContextKey).(models.APIToken)
+	return apiToken, ok
+}
+
+// role returns the role of the logged in user, or an empty role for anonymous
+// visitors.
+func (app *application) role(r *http.Request) models.Role {
+	role, ok := r.Context().Value(roleContextKey).(models.Role)
+	if !ok {
+		return ""
+	}
+	return role
+}
+
+func (app *application) isVerified(r *http.Request) bool {
+	verified, ok := r.Context().Value(verifiedContextKey).(bool)
+	if !ok {
+		return false
+	}
+	return verified
+}
+
+func (app *application) totpSetupRequired(r *http.Request) bool {
+	required, ok := r.Context().Value(totpSetupContextKey).(bool)
+	if !ok {
+		return false
+	}
+	return required
+}
+
+// passwordProblem explains why password can't be used as a new password, or
+// returns "" when it can. userInputs are the user's name and email address.
+// The error is for a breach list that couldn't be read.
+func (app *application) passwordProblem(password string, userInputs ...string) (string, error) {
+	err := app.passwordChecker.Check(password, userInputs...)
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.Is(err, passwords.ErrBreached):
+		return "This password has appeared in a data breach, please choose another one", nil
+	case errors.Is(err, passwords.ErrPersonal):
+		return "This password is too close to your name or email address", nil
+	case errors.Is(err, passwords.ErrCommon):
+		return "This password is based on a commonly used password or word", nil
+	case errors.Is(err, passwords.ErrPattern):
+		return "This password is made of repeats or sequences like aaa, abc or 1234", nil
+	case errors.Is(err, passwords.ErrWeak):
+		return "This password is too easy to guess, try a longer one or a few unrelated words", nil
+	default:
+		return "", err
+	}
+}
+
+// clientIP is the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+// The signup modes SIGNUP_MODE chooses between.
+const (
+	signupOpen   = "open"
+	signupInvite = "invite"
+	signupClosed = "closed"
+)
+
+// maxInviteUses caps how many accounts a single invite code can create.
+const maxInviteUses = 1000
+
+type adminInviteForm struct {
+	MaxUses             int    `form:"maxUses"`
+	Note                string `form:"note"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) adminInvites(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = adminInviteForm{MaxUses: 1}
+	app.renderInvites(w, r, http.StatusOK, data)
+}
+
+// adminInviteCreatePost creates an invite code. Only its hash is stored, so
+// the code is shown on this response and never again.
+func (app *application) adminInviteCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form adminInviteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Note = strings.TrimSpace(form.Note)
+	form.CheckField(form.MaxUses >= 1 && form.MaxUses <= maxInviteUses, "maxUses", fmt.Sprintf("This field must be between 1 and %d", maxInviteUses))
+	form.CheckField(validator.MaxChar(form.Note, 255), "note", "This field cannot be more than 255 characters long")
+
+	data := app.newTemplateData(r)
+	if !form.Valid() {
+		data.Form = form
+		app.renderInvites(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+	code, err := app.invites.Insert(userId, form.MaxUses, form.Note)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.auditAdmin(r, 0, "create invite code", map[string]string{"max uses": strconv.Itoa(form.MaxUses), "note": form.Note})
+
+	data.Form = adminInviteForm{MaxUses: 1}
+	data.InviteCode = code
+	data.InviteURL = app.baseURL + "/user/signup?invite=" + code
+	app.renderInvites(w, r, http.StatusOK, data)
+}
+
+func (app *application) adminInviteRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.invites.Revoke(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.auditAdmin(r, 0, "revoke invite code", map[string]string{"invite": strconv.Itoa(id)})
+
+	app.sessionManager.Put(r.Context(), "flash", "The invite code has been revoked.")
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
+
+func (app *application) renderInvites(w http.ResponseWriter, r *http.Request, status int, data templateData) {
+	codes, err := app.invites.All()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.InviteCodes = codes
+	app.render(w, r, status, "admin_invites.tmpl.html", data)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSignupPage(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		urlPath     string
+		wantForm    bool
+		wantInvite  string
+		wantNavLink bool
+	}{
+		{
+			name:        "Open",
+			mode:        signupOpen,
+			urlPath:     "/user/signup",
+			wantForm:    true,
+			wantNavLink: true,
+		},
+		{
+			name:        "Invite only",
+			mode:        signupInvite,
+			urlPath:     "/user/signup?invite=abc123",
+			wantForm:    true,
+			wantInvite:  "<input type='text' name='invite' value='abc123'>",
+			wantNavLink: true,
+		},
+		{
+			name:    "Closed",
+			mode:    signupClosed,
+			urlPath: "/user/signup",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.signupMode = tt.mode
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			code, _, body := server.get(t, tt.urlPath)
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, strings.Contains(body, "<form action='/user/signup'"), tt.wantForm)
+			assert.Equal(t, strings.Contains(body, "<a href='/user/signup'>Signup</a>"), tt.wantNavLink)
+			assert.Equal(t, strings.Contains(body, "name='invite'"), tt.wantInvite != "")
+			if tt.wantInvite != "" {
+				assert.StringContains(t, body, tt.wantInvite)
+			}
+			if !tt.wantForm {
+				assert.StringContains(t, body, "Signups are closed.")
+			}
+		})
+	}
+}
+
+func TestSignupModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		invite    string
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:     "Open without code",
+			mode:     signupOpen,
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Invite only with code",
+			mode:     signupInvite,
+			invite:   mocks.ValidInviteCode,
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:      "Invite only without code",
+			mode:      signupInvite,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "You need an invite code to sign up",
+		},
+		{
+			name:      "Invite only with used code",
+			mode:      signupInvite,
+			invite:    "used-invite",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This invite code is invalid or has been used up",
+		},
+		{
+			name:     "Closed",
+			mode:     signupClosed,
+			invite:   mocks.ValidInviteCode,
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.signupMode = tt.mode
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			_, _, body := server.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("name", "Bob")
+			form.Add("username", "bob")
+			form.Add("email", "bob@example.com")
+			form.Add("password", "validPa$$word")
+			form.Add("invite", tt.invite)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := server.postForm(t, "/user/signup", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantError != "" {
+				assert.StringContains(t, body, tt.wantError)
+			}
+
+			recorded := app.audits.(*mocks.AuditModel).Recorded()
+			assert.Equal(t, len(recorded) == 1, tt.wantCode == http.StatusSeeOther)
+		})
+	}
+}
+
+func TestAdminInviteCreate(t *testing.T) {
+	tests := []struct {
+		name         string
+		email        string
+		maxUses      string
+		wantCode     int
+		wantInserted int
+		wantBody     string
+	}{
+		{
+			name:         "Single use",
+			email:        "admin@example.com",
+			maxUses:      "1",
+			wantCode:     http.StatusOK,
+			wantInserted: 1,
+			wantBody:     "https://snippetbox.test/user/signup?invite=valid-invite",
+		},
+		{
+			name:     "No uses",
+			email:    "admin@example.com",
+			maxUses:  "0",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be between 1 and 1000",
+		},
+		{
+			name:     "Not an admin",
+			email:    "mod@example.com",
+			maxUses:  "1",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+			_, _, body := server.get(t, "/account/view")
+
+			form := url.Values{}
+			form.Add("maxUses", tt.maxUses)
+			form.Add("note", "For the team")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := server.postForm(t, "/admin/invites", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+
+			inserted := app.invites.(*mocks.InviteModel).Inserted
+			assert.Equal(t, len(inserted), tt.wantInserted)
+			if tt.wantInserted > 0 {
+				assert.Equal(t, inserted[0].CreatedBy, 3)
+				assert.Equal(t, inserted[0].Note, "For the team")
+			}
+		})
+	}
+}
+
+func TestAdminInvites(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "admin@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/admin/invites")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Conference attendees")
+	assert.StringContains(t, body, "2 of 5")
+	assert.StringContains(t, body, "<a href='/u/alice'>alice</a>")
+	assert.Equal(t, strings.Contains(body, "New invite code"), false)
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, header, _ := server.postForm(t, "/admin/invites/1/revoke", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/admin/invites")
+	assert.Equal(t, len(app.invites.(*mocks.InviteModel).Revoked), 1)
+
+	code, _, _ = server.postForm(t, "/admin/invites/99/revoke", form)
+	assert.Equal(t, code, http.StatusNotFound)
+}
@@ -2,32 +2,64 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"go-webserver/internal/mailer"
 	"go-webserver/internal/models"
+	"go-webserver/internal/passwords"
+	"go-webserver/internal/secrets"
+	"go-webserver/internal/tokens"
+	"go-webserver/ui"
 	"go-webserver/utils"
 
 	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
 type application struct {
-	debug          bool
-	logger         *slog.Logger
-	snippets       models.SnippetModelInterface
-	users          models.UserModelInterface
-	templateCache  map[string]*template.Template
-	formDecoder    *form.Decoder
-	sessionManager *scs.SessionManager
+	debug           bool
+	logger          *slog.Logger
+	snippets        models.SnippetModelInterface
+	users           models.UserModelInterface
+	collections     models.CollectionModelInterface
+	stars           models.StarModelInterface
+	orgs            models.OrgModelInterface
+	audits          models.AuditModelInterface
+	invites         models.InviteModelInterface
+	apiTokens       models.APITokenModelInterface
+	reports         models.ReportModelInterface
+	stats           models.StatsModelInterface
+	exports         models.ExportModelInterface
+	passkeys        models.PasskeyModelInterface
+	throttle        models.LoginThrottleModelInterface
+	sessions        models.SessionModelInterface
+	templateCache   map[string]*template.Template
+	formDecoder     *form.Decoder
+	sessionManager  *scs.SessionManager
+	secretScanner   *secrets.Scanner
+	passwordChecker *passwords.Checker
+	blockSecrets    bool
+	mailer          *mailer.Mailer
+	signer          *tokens.Signer
+	webAuthn        *webauthn.WebAuthn
+	sso             *ssoProvider
+	baseURL         string
+	signupMode      string
+	wg              sync.WaitGroup
 }
 
 func neuter(next http.Handler) http.Handler {
@@ -61,6 +93,181 @@ func connectDb() (*pgxpool.Pool, error) {
 	return db, nil
 }
 
+// newSecretScanner builds the snippet secret scanner from the SECRET_SCAN_*
+// environment variables. A nil scanner means scanning is switched off.
+func newSecretScanner() (*secrets.Scanner, bool) {
+	mode := utils.GetEnv("SECRET_SCAN_MODE", "warn")
+	if mode == "off" {
+		return nil, false
+	}
+
+	var disabled []string
+	for _, name := range strings.Split(utils.GetEnv("SECRET_SCAN_DISABLED_RULES"), ",") {
+		disabled = append(disabled, strings.TrimSpace(name))
+	}
+
+	return secrets.NewScanner(secrets.Select(secrets.DefaultRules(), disabled)...), mode == "block"
+}
+
+// newMailer picks the mail driver named by MAIL_DRIVER. The file driver, the
+// default, drops every message into MAIL_DIR instead of sending it.
+func newMailer() (*mailer.Mailer, error) {
+	var driver mailer.Driver
+	switch name := utils.GetEnv("MAIL_DRIVER", "file"); name {
+	case "file":
+		driver = &mailer.File{Dir: utils.GetEnv("MAIL_DIR", "./tmp/mail")}
+	case "memory":
+		driver = &mailer.Memory{}
+	case "smtp":
+		driver = &mailer.SMTP{
+			Host:     utils.GetEnv("SMTP_HOST"),
+			Port:     utils.GetEnv("SMTP_PORT", "587"),
+			Username: utils.GetEnv("SMTP_USERNAME"),
+			Password: utils.GetEnv("SMTP_PASSWORD"),
+		}
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", name)
+	}
+
+	return mailer.New(driver, utils.GetEnv("MAIL_FROM", "Snippetbox <no-reply@snippetbox.local>"), ui.Files), nil
+}
+
+// newSigner uses SECRET_KEY to sign emailed links. It has to stay the same
+// across restarts, or every outstanding link stops working.
+func newSigner() (*tokens.Signer, error) {
+	key := []byte(utils.GetEnv("SECRET_KEY"))
+	if len(key) < 32 {
+		return nil, errors.New("SECRET_KEY must be set to at least 32 characters")
+	}
+	return tokens.NewSigner(key), nil
+}
+
+// newWebAuthn sets up passkeys for the site at baseURL. WEBAUTHN_RP_ID and
+// WEBAUTHN_RP_ORIGINS override the domain and the origins it is served from.
+func newWebAuthn(baseURL string) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(utils.GetEnv("WEBAUTHN_RP_ORIGINS", baseURL), ",") {
+		origins = append(origins, strings.TrimSpace(origin))
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          utils.GetEnv("WEBAUTHN_RP_ID", u.Hostname()),
+		RPDisplayName: "Snippetbox",
+		RPOrigins:     origins,
+	})
+}
+
+// newSSO sets up OpenID Connect login when OIDC_ISSUER is set. The provider
+// must allow OIDC_REDIRECT_URL, by default /user/login/sso/callback on baseURL.
+func newSSO(baseURL string) (*ssoProvider, error) {
+	issuer := utils.GetEnv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return newSSOProvider(ctx,
+		utils.GetEnv("OIDC_PROVIDER_NAME", "single sign-on"),
+		issuer,
+		utils.GetEnv("OIDC_CLIENT_ID"),
+		utils.GetEnv("OIDC_CLIENT_SECRET"),
+		utils.GetEnv("OIDC_REDIRECT_URL", baseURL+"/user/login/sso/callback"),
+	)
+}
+
+// newPasswordPolicy hashes new passwords with PASSWORD_HASHER, argon2id or
+// bcrypt. Hashes made with the other one keep working and are replaced at the
+// next login, as are hashes made with different ARGON2_* or BCRYPT_COST
+// parameters. The parameters are kept between what still resists offline
+// guessing (the OWASP minimums) and what a login can afford to wait for.
+func newPasswordPolicy() (*passwords.Policy, error) {
+	argon := passwords.DefaultArgon2id()
+	memory, err := envUint("ARGON2_MEMORY", uint64(argon.Memory), 19*1024, 4*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := envUint("ARGON2_ITERATIONS", uint64(argon.Iterations), 2, 20)
+	if err != nil {
+		return nil, err
+	}
+	parallelism, err := envUint("ARGON2_PARALLELISM", uint64(argon.Parallelism), 1, 64)
+	if err != nil {
+		return nil, err
+	}
+	argon.Memory, argon.Iterations, argon.Parallelism = uint32(memory), uint32(iterations), uint8(parallelism)
+
+	cost, err := envUint("BCRYPT_COST", 12, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	bcrypt := passwords.Bcrypt{Cost: int(cost)}
+
+	switch name := utils.GetEnv("PASSWORD_HASHER", "argon2id"); name {
+	case "argon2id":
+		return &passwords.Policy{Hasher: argon, Legacy: []passwords.Hasher{bcrypt}}, nil
+	case "bcrypt":
+		return &passwords.Policy{Hasher: bcrypt, Legacy: []passwords.Hasher{argon}}, nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASHER %q", name)
+	}
+}
+
+// newPasswordChecker loads the breached password list named by
+// BREACHED_PASSWORDS_FILE, if any. The file holds one SHA-1 hash per line,
+// sorted by hash, as in the "ordered by hash" downloads from Have I Been Pwned.
+// It is searched on disk and stays open while the server runs.
+func newPasswordChecker(logger *slog.Logger) (*passwords.Checker, error) {
+	checker := &passwords.Checker{MinEntropy: passwords.DefaultMinEntropy}
+
+	path := utils.GetEnv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		return checker, nil
+	}
+
+	list, err := passwords.OpenBreachList(path)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("checking passwords against breach list", "path", path)
+
+	checker.Breached = list
+	return checker, nil
+}
+
+// newSignupMode reads SIGNUP_MODE, which decides who may create an account:
+// anyone (open), people with an invite code (invite) or no one (closed).
+func newSignupMode() (string, error) {
+	switch mode := utils.GetEnv("SIGNUP_MODE", signupOpen); mode {
+	case signupOpen, signupInvite, signupClosed:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown SIGNUP_MODE %q", mode)
+	}
+}
+
+// envUint reads an unsigned integer between min and max from key.
+func envUint(key string, fallback, min, max uint64) (uint64, error) {
+	value := utils.GetEnv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d, not %d", key, min, max, n)
+	}
+	return n, nil
+}
+
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
 
@@ -93,15 +300,84 @@ func main() {
 
 	fmt.Println(debug)
 
+	secretScanner, blockSecrets := newSecretScanner()
+
+	mailer, err := newMailer()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	signer, err := newSigner()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	baseURL := utils.GetEnv("BASE_URL", fmt.Sprint("http://localhost:", utils.GetEnv("PORT", "4000")))
+
+	webAuthn, err := newWebAuthn(baseURL)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	sso, err := newSSO(baseURL)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	passwordPolicy, err := newPasswordPolicy()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	passwordChecker, err := newPasswordChecker(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	signupMode, err := newSignupMode()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	app := &application{
-		debug:          debug,
-		logger:         logger,
-		snippets:       &models.SnippetModel{Pool: db},
-		users:          &models.UserModel{Pool: db},
-		templateCache:  templateCache,
-		formDecoder:    form.NewDecoder(),
-		sessionManager: sessionManager,
+		debug:           debug,
+		logger:          logger,
+		snippets:        &models.SnippetModel{Pool: db},
+		users:           &models.UserModel{Pool: db, Passwords: passwordPolicy, Logger: logger},
+		collections:     &models.CollectionModel{Pool: db},
+		stars:           &models.StarModel{Pool: db},
+		orgs:            &models.OrgModel{Pool: db},
+		audits:          &models.AuditModel{Pool: db},
+		invites:         &models.InviteModel{Pool: db},
+		apiTokens:       &models.APITokenModel{Pool: db},
+		reports:         &models.ReportModel{Pool: db},
+		stats:           &models.StatsModel{Pool: db},
+		exports:         &models.ExportModel{Pool: db},
+		passkeys:        &models.PasskeyModel{Pool: db},
+		throttle:        &models.LoginThrottleModel{Pool: db},
+		sessions:        &models.SessionModel{Pool: db},
+		templateCache:   templateCache,
+		formDecoder:     form.NewDecoder(),
+		sessionManager:  sessionManager,
+		secretScanner:   secretScanner,
+		passwordChecker: passwordChecker,
+		blockSecrets:    blockSecrets,
+		mailer:          mailer,
+		signer:          signer,
+		webAuthn:        webAuthn,
+		sso:             sso,
+		baseURL:         baseURL,
+		signupMode:      signupMode,
 	}
+	go app.housekeeping(time.Hour)
+
 	// tlsConfig := &tls.Config{
 	// 	CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
 	// }
@@ -122,5 +398,8 @@ func main() {
 	err = srv.ListenAndServe()
 	app.logger.Error(err.Error())
 
+	// let background jobs such as account exports finish before closing the pool
+	app.wg.Wait()
+
 	defer db.Close()
 }
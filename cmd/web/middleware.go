@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"go-webserver/internal/models"
+
+	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
 )
 
@@ -57,12 +62,57 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 			return
 		}
 
+		// An admin can require 2FA for a role, until it is set up the user may
+		// only do that or log out.
+		if app.totpSetupRequired(r) && !totpSetupPaths[r.URL.Path] {
+			app.sessionManager.Put(r.Context(), "flash", "Your role requires two-factor authentication, please set it up before continuing.")
+			http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+			return
+		}
+
 		w.Header().Add("Cache-Control", "no-store")
 		// And call the next handler in the chain.
 		next.ServeHTTP(w, r)
 	})
 }
 
+// totpSetupPaths stay reachable for users who still have to set up 2FA.
+var totpSetupPaths = map[string]bool{
+	"/account/2fa":        true,
+	"/account/2fa/qr.png": true,
+	"/account/2fa/enable": true,
+	"/user/logout":        true,
+}
+
+// requireRole only lets through users whose role is at least role. It is
+// meant to be appended to a chain that already requires authentication.
+func (app *application) requireRole(role models.Role) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.role(r).AtLeast(role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireVerified keeps users who have not verified their email address away
+// from creating snippets. It must run after requireAuthentication.
+func (app *application) requireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isVerified(r) {
+			app.sessionManager.Put(r.Context(), "flash", "Please verify your email address first.")
+			http.Redirect(w, r, "/account/verify", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
@@ -82,17 +132,137 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		exists, err := app.users.Exists(id)
+		user, err := app.users.Get(id)
 		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				next.ServeHTTP(w, r)
+				return
+			}
 			app.serverError(w, r, err)
 			return
 		}
 
-		if exists {
-			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-			r = r.WithContext(ctx)
+		// Disabling an account or forcing a password reset also locks out
+		// sessions that are already logged in.
+		if user.Disabled || user.PasswordResetRequired {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A session without a record, or whose record was revoked, is logged
+		// out. Revoking normally deletes the session itself, this catches a
+		// request that was already running at the time.
+		sessionId := app.sessionManager.GetInt(r.Context(), "sessionId")
+		ok := sessionId != 0
+		if ok {
+			ok, err = app.sessions.Touch(sessionId, id, app.sessionManager.Token(r.Context()), clientIP(r))
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+		if !ok {
+			app.sessionManager.Remove(r.Context(), "authenticatedUserId")
+			app.sessionManager.Remove(r.Context(), "sessionId")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, roleContextKey, user.Role)
+		ctx = context.WithValue(ctx, verifiedContextKey, user.Verified)
+		ctx = context.WithValue(ctx, totpSetupContextKey, user.TOTPRequired && !user.TOTPEnabled)
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateToken does for scripts what authenticate does for browsers. A
+// request with an "Authorization: Bearer" header is authenticated by its API
+// token, with the same request context authenticate sets up, so requireRole
+// works on API routes too. It takes the place of the dynamic chain on API
+// routes rather than joining it: without a session there is no cookie a
+// cross-site request could ride on, so no CSRF check is needed either. A bad
+// token is rejected straight away instead of falling back to an anonymous
+// request.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			app.apiUnauthorized(w, r, "The Authorization header must hold a bearer token")
+			return
+		}
+
+		apiToken, err := app.apiTokens.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidToken) {
+				app.apiUnauthorized(w, r, "This token is invalid or has expired")
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		user, err := app.users.Get(apiToken.UserId)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiUnauthorized(w, r, "This token is invalid or has expired")
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// A disabled account can't use its tokens, and neither can one an
+		// admin wants to secure with a new password. Setting that password
+		// deletes the tokens for good.
+		if user.Disabled || user.PasswordResetRequired {
+			app.apiUnauthorized(w, r, "This account can't be used with API tokens right now")
+			return
+		}
+
+		// The 2FA a role requires applies to scripts as well. Creating tokens
+		// is already out of reach until it is set up, see requireAuthentication.
+		if user.TOTPRequired && !user.TOTPEnabled {
+			app.jsonError(w, r, http.StatusForbidden, fmt.Sprintf("The %s role requires two-factor authentication, set it up before using API tokens", user.Role))
+			return
 		}
 
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, roleContextKey, user.Role)
+		ctx = context.WithValue(ctx, verifiedContextKey, user.Verified)
+		ctx = context.WithValue(ctx, apiTokenContextKey, apiToken)
+		r = r.WithContext(ctx)
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requireScope only lets through requests authenticated by an API token that
+// was given scope. Session cookies don't count, API routes have no CSRF
+// protection.
+func (app *application) requireScope(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiToken, ok := app.apiToken(r)
+			if !ok {
+				app.apiUnauthorized(w, r, "This endpoint needs an API token")
+				return
+			}
+			if !apiToken.HasScope(scope) {
+				app.jsonError(w, r, http.StatusForbidden, fmt.Sprintf("This token lacks the %s scope", scope))
+				return
+			}
+
+			w.Header().Add("Cache-Control", "no-store")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"go-webserver/internal/assert"
+	"go-webserver/internal/models"
 )
 
 func TestCommonHeader(t *testing.T) {
@@ -71,3 +73,61 @@ func TestCommonHeader(t *testing.T) {
 
 	assert.Equal(t, string(body), "OKE")
 }
+
+func TestRequireRole(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OKE"))
+	})
+
+	tests := []struct {
+		name     string
+		role     models.Role
+		wantCode int
+	}{
+		{
+			name:     "Anonymous",
+			role:     "",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "User",
+			role:     models.RoleUser,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Moderator",
+			role:     models.RoleModerator,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Admin",
+			role:     models.RoleAdmin,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Unknown role",
+			role:     models.Role("superuser"),
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodGet, "/moderation", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.role != "" {
+				req = req.WithContext(context.WithValue(req.Context(), roleContextKey, tt.role))
+			}
+
+			app.requireRole(models.RoleModerator)(next).ServeHTTP(rec, req)
+
+			assert.Equal(t, rec.Result().StatusCode, tt.wantCode)
+		})
+	}
+}
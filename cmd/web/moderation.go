@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+type snippetReportForm struct {
+	Reason              string `form:"reason"`
+	Details             string `form:"details"`
+	validator.Validator `form:"-"`
+}
+
+type moderationDecisionForm struct {
+	ReportId            int    `form:"-"`
+	Action              string `form:"action"`
+	Reason              string `form:"reason"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) snippetReport(w http.ResponseWriter, r *http.Request) {
+	snippet, err := app.snippets.Get(r.PathValue("id"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetReportForm{}
+	app.render(w, r, http.StatusOK, "report.tmpl.html", data)
+}
+
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	snippet, err := app.snippets.Get(r.PathValue("id"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	var form snippetReportForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Reason, models.ReportReasons...), "reason", "Please pick one of the listed reasons")
+	form.CheckField(validator.MaxChar(form.Details, 1000), "details", "This field cannot exceed 1000 character")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "report.tmpl.html", data)
+		return
+	}
+
+	_, err = app.reports.Insert(snippet.Id, form.Reason, form.Details)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks for your report, a moderator will review it.")
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+}
+
+func (app *application) moderationQueue(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = moderationDecisionForm{}
+	app.renderModerationQueue(w, r, http.StatusOK, data)
+}
+
+func (app *application) moderationDecisionPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	form := moderationDecisionForm{ReportId: id}
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Action, models.ModerationActions...), "action", "Please pick hide, delete or dismiss")
+	form.CheckField(validator.NotBlank(form.Reason), "reason", "Every decision needs a reason")
+	form.CheckField(validator.MaxChar(form.Reason, 1000), "reason", "This field cannot exceed 1000 character")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderModerationQueue(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	moderatorId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	err = app.reports.Resolve(id, moderatorId, form.Action, form.Reason)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditModeration,
+		Details: map[string]string{"report": strconv.Itoa(id), "action": form.Action, "reason": form.Reason},
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Report #%d: %s", id, form.Action))
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+func (app *application) renderModerationQueue(w http.ResponseWriter, r *http.Request, status int, data templateData) {
+	var err error
+
+	data.Reports, err = app.reports.Open()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Decisions, err = app.reports.Decisions(20)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, status, "moderation.tmpl.html", data)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSnippetReport(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	code, _, body := server.get(t, "/snippet/report/snippet-123")
+	assert.Equal(t, code, http.StatusOK)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		reason   string
+		wantCode int
+	}{
+		{
+			name:     "Valid report",
+			urlPath:  "/snippet/report/snippet-123",
+			reason:   "spam",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Unknown reason",
+			urlPath:  "/snippet/report/snippet-123",
+			reason:   "boring",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/snippet/report/snippet-404",
+			reason:   "spam",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("reason", tt.reason)
+			form.Add("details", "Posted the same text in ten snippets")
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestHiddenSnippet(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+	}{
+		{
+			name:     "Anonymous",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Regular user",
+			email:    "alice@example.com",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Moderator",
+			email:    "mod@example.com",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Admin",
+			email:    "admin@example.com",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			if tt.email != "" {
+				server.login(t, tt.email, "pa$$word")
+			}
+
+			code, _, body := server.get(t, "/snippet/view/snippet-hidden")
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusOK {
+				assert.StringContains(t, body, "hidden by a moderator")
+			}
+		})
+	}
+}
+
+func TestModerationQueue(t *testing.T) {
+	t.Run("Regular user", func(t *testing.T) {
+		app := newTestApplication(t)
+		server := newTestServer(t, app.routes())
+		defer server.Close()
+
+		server.login(t, "alice@example.com", "pa$$word")
+
+		code, _, _ := server.get(t, "/moderation")
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "mod@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/moderation")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Same text over and over")
+	assert.StringContains(t, body, "Malware download link")
+	assert.StringContains(t, body, "<a href='/moderation'>Moderation</a>")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		action   string
+		reason   string
+		wantCode int
+	}{
+		{
+			name:     "Hide",
+			urlPath:  "/moderation/report/1",
+			action:   "hide",
+			reason:   "Spam",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Dismiss",
+			urlPath:  "/moderation/report/1",
+			action:   "dismiss",
+			reason:   "Not spam",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Missing reason",
+			urlPath:  "/moderation/report/1",
+			action:   "delete",
+			reason:   "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Unknown action",
+			urlPath:  "/moderation/report/1",
+			action:   "ban",
+			reason:   "Spam",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Unknown report",
+			urlPath:  "/moderation/report/99",
+			action:   "hide",
+			reason:   "Spam",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("action", tt.action)
+			form.Add("reason", tt.reason)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
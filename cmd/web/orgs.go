@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+const orgInvitationTTL = 7 * 24 * time.Hour
+
+type orgCreateForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+type orgInviteForm struct {
+	Email               string `form:"email"`
+	Role                string `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+type orgRoleForm struct {
+	Role string `form:"role"`
+}
+
+type orgInvitationForm struct {
+	Token     string `form:"-"`
+	CanAccept bool   `form:"-"`
+}
+
+func (app *application) orgList(w http.ResponseWriter, r *http.Request) {
+	orgs, err := app.orgs.ForUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Orgs = orgs
+	app.render(w, r, http.StatusOK, "orgs.tmpl.html", data)
+}
+
+func (app *application) orgCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = orgCreateForm{}
+	app.render(w, r, http.StatusOK, "org_create.tmpl.html", data)
+}
+
+func (app *application) orgCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form orgCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChar(form.Name, 100), "name", "This field cannot exceed 100 character")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "org_create.tmpl.html", data)
+		return
+	}
+
+	id, err := app.orgs.Insert(form.Name, app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Organization successfully created!")
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) orgView(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.memberOrg(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderOrg(w, r, http.StatusOK, org, orgInviteForm{Role: string(models.OrgRoleMember)})
+}
+
+// renderOrg shows the organization with its snippets and members. Owners also
+// see the pending invitations and the invite form.
+func (app *application) renderOrg(w http.ResponseWriter, r *http.Request, status int, org models.Org, form orgInviteForm) {
+	var err error
+
+	data := app.newTemplateData(r)
+	data.Org = org
+	data.Form = form
+	data.OrgRoles = models.OrgRoles
+
+	data.Snippets, err = app.orgs.Snippets(org.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.OrgMembers, err = app.orgs.Members(org.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if org.Role == models.OrgRoleOwner {
+		data.Invitations, err = app.orgs.Invitations(org.Id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.render(w, r, status, "org.tmpl.html", data)
+}
+
+// orgInvitePost mails a link to join the organization. The invitation is
+// bound to the address, only an account using it can accept.
+func (app *application) orgInvitePost(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.ownedOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var form orgInviteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Email = strings.TrimSpace(form.Email)
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	form.CheckField(validator.PermittedValue(models.OrgRole(form.Role), models.OrgRoles...), "role", "This field must be owner or member")
+
+	if !form.Valid() {
+		app.renderOrg(w, r, http.StatusUnprocessableEntity, org, form)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	token, err := app.orgs.Invite(org.Id, userId, form.Email, models.OrgRole(form.Role), orgInvitationTTL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"OrgName":   org.Name,
+		"InvitedBy": user.Name,
+		"Role":      form.Role,
+		"URL":       app.baseURL + "/orgs/invitation/" + token,
+		"Valid":     "7 days",
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(form.Email, "email/org_invite.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error(), "email", form.Email)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Invitation sent to "+form.Email)
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", org.Id), http.StatusSeeOther)
+}
+
+func (app *application) orgMemberRolePost(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.ownedOrg(w, r)
+	if !ok {
+		return
+	}
+
+	memberId, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil || memberId < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	var form orgRoleForm
+	err = app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(models.OrgRole(form.Role), models.OrgRoles...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.orgs.SetRole(org.Id, memberId, models.OrgRole(form.Role))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+			return
+		case errors.Is(err, models.ErrLastOwner):
+			app.sessionManager.Put(r.Context(), "flash", "An organization needs at least one owner.")
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", org.Id), http.StatusSeeOther)
+}
+
+func (app *application) orgMemberRemovePost(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.ownedOrg(w, r)
+	if !ok {
+		return
+	}
+
+	memberId, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil || memberId < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	app.removeOrgMember(w, r, org, memberId)
+}
+
+// orgLeavePost lets every member leave, unless they are the last owner.
+func (app *application) orgLeavePost(w http.ResponseWriter, r *http.Request) {
+	org, ok := app.memberOrg(w, r)
+	if !ok {
+		return
+	}
+
+	app.removeOrgMember(w, r, org, app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+}
+
+func (app *application) removeOrgMember(w http.ResponseWriter, r *http.Request, org models.Org, memberId int) {
+	err := app.orgs.RemoveMember(org.Id, memberId)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrLastOwner):
+			app.sessionManager.Put(r.Context(), "flash", "An organization needs at least one owner.")
+			http.Redirect(w, r, fmt.Sprintf("/org/%d", org.Id), http.StatusSeeOther)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if memberId == app.sessionManager.GetInt(r.Context(), "authenticatedUserId") {
+		app.sessionManager.Put(r.Context(), "flash", "You have left "+org.Name)
+		http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", org.Id), http.StatusSeeOther)
+}
+
+// orgInvitation shows who invited the user to which organization. Only the
+// account with the invited email address can accept.
+func (app *application) orgInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, user, ok := app.pendingInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Invitation = invitation
+	data.Form = orgInvitationForm{
+		Token:     r.PathValue("token"),
+		CanAccept: strings.EqualFold(invitation.Email, user.Email),
+	}
+	app.render(w, r, http.StatusOK, "org_invitation.tmpl.html", data)
+}
+
+func (app *application) orgInvitationPost(w http.ResponseWriter, r *http.Request) {
+	invitation, user, ok := app.pendingInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	id, err := app.orgs.AcceptInvitation(r.PathValue("token"), user.Id)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			app.sessionManager.Put(r.Context(), "flash", "This invitation is invalid or has expired.")
+			http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Welcome to "+invitation.OrgName+"!")
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", id), http.StatusSeeOther)
+}
+
+// pendingInvitation loads the invitation named in the URL along with the
+// logged in user. Used up and expired invitations send the user to their
+// organizations with a flash message.
+func (app *application) pendingInvitation(w http.ResponseWriter, r *http.Request) (models.OrgInvitation, models.UsersNoPassword, bool) {
+	invitation, err := app.orgs.Invitation(r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			app.sessionManager.Put(r.Context(), "flash", "This invitation is invalid or has expired.")
+			http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.OrgInvitation{}, models.UsersNoPassword{}, false
+	}
+
+	user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return models.OrgInvitation{}, models.UsersNoPassword{}, false
+	}
+
+	return invitation, user, true
+}
+
+// memberOrg loads the organization named in the URL. It is reported as not
+// found to everyone but its members.
+func (app *application) memberOrg(w http.ResponseWriter, r *http.Request) (models.Org, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Org{}, false
+	}
+
+	org, err := app.orgs.Get(id, app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Org{}, false
+	}
+
+	return org, true
+}
+
+// ownedOrg is memberOrg for actions only owners may take, members get a 403.
+func (app *application) ownedOrg(w http.ResponseWriter, r *http.Request) (models.Org, bool) {
+	org, ok := app.memberOrg(w, r)
+	if !ok {
+		return models.Org{}, false
+	}
+
+	if org.Role != models.OrgRoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return models.Org{}, false
+	}
+
+	return org, true
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOrgSnippetView(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+	}{
+		{
+			name:     "Anonymous",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Not a member",
+			email:    "mod@example.com",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Owner",
+			email:    "alice@example.com",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Member",
+			email:    "admin@example.com",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			if tt.email != "" {
+				server.login(t, tt.email, "pa$$word")
+			}
+
+			code, _, body := server.get(t, "/snippet/view/snippet-org")
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode == http.StatusOK {
+				assert.StringContains(t, body, "Shared with <a href='/org/1'>Platform Team</a>")
+				assert.StringContains(t, body, "<a href='/snippet/edit/snippet-org'>Edit</a>")
+			}
+		})
+	}
+}
+
+func TestOrgView(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		urlPath    string
+		wantCode   int
+		wantInvite bool
+	}{
+		{
+			name:       "Owner",
+			email:      "alice@example.com",
+			urlPath:    "/org/1",
+			wantCode:   http.StatusOK,
+			wantInvite: true,
+		},
+		{
+			name:     "Member",
+			email:    "admin@example.com",
+			urlPath:  "/org/1",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not a member",
+			email:    "mod@example.com",
+			urlPath:  "/org/1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			email:    "alice@example.com",
+			urlPath:  "/org/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+
+			code, _, body := server.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			assert.StringContains(t, body, "On-call handbook")
+			assert.StringContains(t, body, "Ada Admin")
+			assert.Equal(t, strings.Contains(body, "Send invitation"), tt.wantInvite)
+		})
+	}
+}
+
+func TestOrgInvite(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		invitee   string
+		role      string
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:     "Owner invites",
+			email:    "alice@example.com",
+			invitee:  "new@example.com",
+			role:     "member",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Member can't invite",
+			email:    "admin@example.com",
+			invitee:  "new@example.com",
+			role:     "member",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:      "Invalid email",
+			email:     "alice@example.com",
+			invitee:   "new@",
+			role:      "member",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This field must be a valid email address",
+		},
+		{
+			name:      "Invalid role",
+			email:     "alice@example.com",
+			invitee:   "new@example.com",
+			role:      "admin",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This field must be owner or member",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			outbox := useOutbox(app)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+			_, _, body := server.get(t, "/org/1")
+
+			form := url.Values{}
+			form.Add("email", tt.invitee)
+			form.Add("role", tt.role)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := server.postForm(t, "/org/1/invite", form)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantError != "" {
+				assert.StringContains(t, body, tt.wantError)
+			}
+
+			app.wg.Wait()
+			messages := outbox.Messages(tt.invitee)
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, len(messages), 1)
+				assert.StringContains(t, messages[0].Subject, "Alice Jones invited you to Platform Team")
+				assert.StringContains(t, messages[0].Body, "https://snippetbox.test/orgs/invitation/valid-org-token")
+			} else {
+				assert.Equal(t, len(messages), 0)
+			}
+		})
+	}
+}
+
+func TestOrgInvitation(t *testing.T) {
+	tests := []struct {
+		name         string
+		email        string
+		token        string
+		wantCode     int
+		wantLocation string
+		wantAccepted int
+	}{
+		{
+			name:         "Invited user",
+			email:        "mod@example.com",
+			token:        "valid-org-token",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/org/1",
+			wantAccepted: 1,
+		},
+		{
+			name:     "Different address",
+			email:    "alice@example.com",
+			token:    "valid-org-token",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:         "Invalid token",
+			email:        "mod@example.com",
+			token:        "used-org-token",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/orgs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+			_, _, body := server.get(t, "/orgs")
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, header, _ := server.postForm(t, "/orgs/invitation/"+tt.token, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			assert.Equal(t, len(app.orgs.(*mocks.OrgModel).Accepted), tt.wantAccepted)
+		})
+	}
+}
+
+func TestOrgInvitationPage(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	code, header, _ := server.get(t, "/orgs/invitation/valid-org-token")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	server.login(t, "alice@example.com", "pa$$word")
+	_, _, body := server.get(t, "/orgs/invitation/valid-org-token")
+	assert.StringContains(t, body, "Alice Jones invited mod@example.com to join Platform Team as a member.")
+	assert.StringContains(t, body, "This invitation was sent to a different email address.")
+}
+
+func TestOrgMemberRemove(t *testing.T) {
+	tests := []struct {
+		name         string
+		email        string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+		wantRemoved  int
+	}{
+		{
+			name:         "Owner removes member",
+			email:        "alice@example.com",
+			urlPath:      "/org/1/members/3/remove",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/org/1",
+			wantRemoved:  1,
+		},
+		{
+			name:         "Last owner",
+			email:        "alice@example.com",
+			urlPath:      "/org/1/members/1/remove",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/org/1",
+		},
+		{
+			name:     "Member can't remove others",
+			email:    "admin@example.com",
+			urlPath:  "/org/1/members/1/remove",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:         "Member leaves",
+			email:        "admin@example.com",
+			urlPath:      "/org/1/leave",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/orgs",
+			wantRemoved:  1,
+		},
+		{
+			name:     "Not a member",
+			email:    "mod@example.com",
+			urlPath:  "/org/1/leave",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+			_, _, body := server.get(t, "/orgs")
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, header, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			assert.Equal(t, len(app.orgs.(*mocks.OrgModel).Removed), tt.wantRemoved)
+		})
+	}
+}
+
+func TestSnippetEdit(t *testing.T) {
+	tests := []struct {
+		name        string
+		email       string
+		urlPath     string
+		title       string
+		wantCode    int
+		wantUpdated int
+	}{
+		{
+			name:        "Member edits",
+			email:       "admin@example.com",
+			urlPath:     "/snippet/edit/snippet-org",
+			title:       "On-call handbook v2",
+			wantCode:    http.StatusSeeOther,
+			wantUpdated: 1,
+		},
+		{
+			name:     "Blank title",
+			email:    "alice@example.com",
+			urlPath:  "/snippet/edit/snippet-org",
+			title:    "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Not a member",
+			email:    "mod@example.com",
+			urlPath:  "/snippet/edit/snippet-org",
+			title:    "Mine now",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Personal snippet",
+			email:    "alice@example.com",
+			urlPath:  "/snippet/edit/snippet-go",
+			title:    "Hello again",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+			_, _, body := server.get(t, "/orgs")
+
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "Page the secondary after 10 minutes")
+			form.Add("language", "text")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+
+			updated := app.snippets.(*mocks.SnippetModel).Updated
+			assert.Equal(t, len(updated), tt.wantUpdated)
+			if tt.wantUpdated > 0 {
+				assert.Equal(t, updated[0].Title, tt.title)
+			}
+		})
+	}
+}
+
+func TestOrgSnippetCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		wantCode  int
+		wantOrgId int
+	}{
+		{
+			name:      "Member shares",
+			email:     "alice@example.com",
+			wantCode:  http.StatusSeeOther,
+			wantOrgId: 1,
+		},
+		{
+			name:     "Not a member",
+			email:    "mod@example.com",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, tt.email, "pa$$word")
+			_, _, body := server.get(t, "/snippet/create")
+
+			form := url.Values{}
+			form.Add("title", "Runbook")
+			form.Add("content", "Restart the worker")
+			form.Add("expires", "7")
+			form.Add("org", "1")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := server.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			inserted := app.snippets.(*mocks.SnippetModel).Inserted
+			if tt.wantOrgId != 0 {
+				assert.Equal(t, len(inserted), 1)
+				assert.Equal(t, inserted[0].OrgId, tt.wantOrgId)
+			} else {
+				assert.Equal(t, len(inserted), 0)
+				assert.StringContains(t, body, "You are not a member of this organization")
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// passkeyUser adapts a user and their registered passkeys to webauthn.User.
+// The user handle is the decimal user id, it is what a discoverable login
+// hands back to find the account again.
+type passkeyUser struct {
+	user        models.UsersNoPassword
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.user.Id))
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// loadPasskeyUser fetches a user together with the credentials of all their
+// passkeys.
+func (app *application) loadPasskeyUser(id int) (*passkeyUser, error) {
+	user, err := app.users.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := app.passkeys.ForUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &passkeyUser{user: user}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		err := json.Unmarshal(passkey.Credential, &credential)
+		if err != nil {
+			return nil, err
+		}
+		u.credentials = append(u.credentials, credential)
+	}
+	return u, nil
+}
+
+// putCeremony keeps the WebAuthn challenge in the session until the browser
+// comes back with the authenticator response.
+func (app *application) putCeremony(r *http.Request, key string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), key, data)
+	return nil
+}
+
+// popCeremony takes the challenge back out of the session, so every challenge
+// can only be answered once.
+func (app *application) popCeremony(r *http.Request, key string) (webauthn.SessionData, bool) {
+	var session webauthn.SessionData
+	data := app.sessionManager.PopBytes(r.Context(), key)
+	if data == nil || json.Unmarshal(data, &session) != nil {
+		return webauthn.SessionData{}, false
+	}
+	return session, true
+}
+
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func (app *application) jsonError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	app.writeJSON(w, r, status, map[string]string{"error": message})
+}
+
+type passkeyForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+func (form *passkeyForm) check() {
+	form.Name = strings.TrimSpace(form.Name)
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChar(form.Name, 50), "name", "This field cannot exceed 50 character")
+}
+
+func (app *application) accountPasskeys(w http.ResponseWriter, r *http.Request) {
+	passkeys, err := app.passkeys.ForUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Passkeys = passkeys
+	data.Form = passkeyForm{}
+	app.render(w, r, http.StatusOK, "passkeys.tmpl.html", data)
+}
+
+// accountPasskeyRegisterBegin starts registering a new passkey. The options it
+// returns are passed to navigator.credentials.create by passkeys.js.
+func (app *application) accountPasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user, err := app.loadPasskeyUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// User verification is required since a passkey login replaces both the
+	// password and the TOTP step.
+	creation, session, err := app.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.putCeremony(r, "passkeyRegistration", session)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, creation)
+}
+
+// accountPasskeyRegisterFinish checks the authenticator's response and stores
+// the new credential under the name given in the query string.
+func (app *application) accountPasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	form := passkeyForm{Name: r.URL.Query().Get("name")}
+	form.check()
+	if !form.Valid() {
+		app.jsonError(w, r, http.StatusUnprocessableEntity, form.FieldErrors["name"])
+		return
+	}
+
+	session, ok := app.popCeremony(r, "passkeyRegistration")
+	if !ok {
+		app.jsonError(w, r, http.StatusBadRequest, "Registration expired, please try again")
+		return
+	}
+
+	user, err := app.loadPasskeyUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	credential, err := app.webAuthn.FinishRegistration(user, session, r)
+	if err == nil && !credential.Flags.UserVerified {
+		err = errors.New("user verification missing")
+	}
+	if err != nil {
+		app.logger.Warn("passkey registration failed", "error", err)
+		app.jsonError(w, r, http.StatusBadRequest, "This passkey could not be registered")
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.passkeys.Insert(user.user.Id, credential.ID, form.Name, data)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicatePasskey) {
+			app.jsonError(w, r, http.StatusConflict, "This passkey is already registered")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditPasskeyAdd,
+		UserId:  user.user.Id,
+		Details: map[string]string{"name": form.Name},
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your passkey has been added.")
+	app.writeJSON(w, r, http.StatusOK, map[string]string{"redirect": "/account/passkeys"})
+}
+
+func (app *application) accountPasskeyRenamePost(w http.ResponseWriter, r *http.Request) {
+	id, err := base64.RawURLEncoding.DecodeString(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var form passkeyForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.check()
+	if !form.Valid() {
+		app.sessionManager.Put(r.Context(), "flash", "Passkey names can't be blank or longer than 50 characters.")
+		http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+		return
+	}
+
+	err = app.passkeys.Rename(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), id, form.Name)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your passkey has been renamed.")
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+}
+
+func (app *application) accountPasskeyDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := base64.RawURLEncoding.DecodeString(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+	err = app.passkeys.Delete(userId, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditPasskeyRemove,
+		UserId:  userId,
+		Details: map[string]string{"id": r.PathValue("id")},
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your passkey has been removed.")
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+}
+
+// userLoginPasskeyBegin starts a passwordless login. No user is named, the
+// browser offers whichever passkeys it holds for this site.
+func (app *application) userLoginPasskeyBegin(w http.ResponseWriter, r *http.Request) {
+	assertion, session, err := app.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.putCeremony(r, "passkeyLogin", session)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, assertion)
+}
+
+// userLoginPasskeyFinish verifies the assertion and logs in the user the
+// passkey belongs to. The authenticator must have verified the user with a
+// PIN or biometrics, which makes the passkey two factors in itself, so the
+// TOTP step is skipped.
+func (app *application) userLoginPasskeyFinish(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.popCeremony(r, "passkeyLogin")
+	if !ok {
+		app.jsonError(w, r, http.StatusBadRequest, "Login expired, please try again")
+		return
+	}
+
+	found, credential, err := app.webAuthn.FinishPasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		id, err := strconv.Atoi(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		return app.loadPasskeyUser(id)
+	}, session, r)
+	if err == nil && !credential.Flags.UserVerified {
+		err = errors.New("user verification missing")
+	}
+	// A signature counter that went backwards means the key may have been
+	// copied, the stored credential is left as it was.
+	if err == nil && credential.Authenticator.CloneWarning {
+		err = errors.New("signature counter went backwards, the passkey may be cloned")
+	}
+	if err != nil {
+		app.logger.Warn("passkey login failed", "error", err)
+		app.jsonError(w, r, http.StatusUnauthorized, "This passkey was not accepted")
+		return
+	}
+
+	user := found.(*passkeyUser).user
+	if user.Disabled {
+		app.jsonError(w, r, http.StatusForbidden, "Your account has been disabled")
+		return
+	}
+	if user.PasswordResetRequired {
+		app.jsonError(w, r, http.StatusForbidden, forcedResetMessage)
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.passkeys.Used(credential.ID, data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.startSession(r, user.Id, "passkey")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, map[string]string{"redirect": app.loginRedirect(r)})
+}
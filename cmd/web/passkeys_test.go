@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"go-webserver/internal/assert"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// softAuthenticator is a passkey held in memory. It answers registration and
+// login challenges the way a browser and a platform authenticator would.
+type softAuthenticator struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	id      []byte
+	counter uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+var b64 = base64.RawURLEncoding
+
+// authData builds the authenticator data for the test relying party, with the
+// attested credential appended when registering.
+func (a *softAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte("snippetbox.test"))
+
+	var data bytes.Buffer
+	data.Write(rpIdHash[:])
+	data.WriteByte(flags)
+	binary.Write(&data, binary.BigEndian, a.counter)
+
+	if attested {
+		publicKey, err := cbor.Marshal(map[int]any{
+			1:  2,  // kty: EC2
+			3:  -7, // alg: ES256
+			-1: 1,  // crv: P-256
+			-2: a.key.X.FillBytes(make([]byte, 32)),
+			-3: a.key.Y.FillBytes(make([]byte, 32)),
+		})
+		if err != nil {
+			a.t.Fatal(err)
+		}
+
+		data.Write(make([]byte, 16)) // aaguid
+		binary.Write(&data, binary.BigEndian, uint16(len(a.id)))
+		data.Write(a.id)
+		data.Write(publicKey)
+	}
+	return data.Bytes()
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    "https://snippetbox.test",
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) create(challenge string) map[string]any {
+	attestation, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(0x45, true), // user present, user verified, attested credential
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return map[string]any{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	}
+}
+
+func (a *softAuthenticator) get(challenge string, userHandle string) map[string]any {
+	return a.sign(challenge, userHandle, 0x05) // user present, user verified
+}
+
+// sign answers a login challenge with the given authenticator data flags.
+func (a *softAuthenticator) sign(challenge string, userHandle string, flags byte) map[string]any {
+	a.counter++
+	authData := a.authData(flags, false)
+	clientData := a.clientData("webauthn.get", challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return map[string]any{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString([]byte(userHandle)),
+		},
+	}
+}
+
+// postJSON posts body the way passkeys.js does, with the CSRF token in a
+// header, and decodes the JSON answer.
+func (server *testServer) postJSON(t *testing.T, urlPath, csrfToken string, body any) (int, map[string]any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+urlPath, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CSRF-Token", csrfToken)
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var answer map[string]any
+	json.Unmarshal(raw, &answer)
+	return res.StatusCode, answer
+}
+
+func challenge(t *testing.T, options map[string]any) string {
+	publicKey, ok := options["publicKey"].(map[string]any)
+	if !ok {
+		t.Fatalf("no publicKey options in %v", options)
+	}
+	return publicKey["challenge"].(string)
+}
+
+func TestPasskeys(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	authenticator := newSoftAuthenticator(t)
+
+	server.login(t, "alice@example.com", "pa$$word")
+	_, _, body := server.get(t, "/account/passkeys")
+	csrfToken := extractCSRFToken(t, body)
+
+	t.Run("Register", func(t *testing.T) {
+		code, options := server.postJSON(t, "/account/passkeys/register/begin", csrfToken, nil)
+		assert.Equal(t, code, http.StatusOK)
+
+		code, answer := server.postJSON(t, "/account/passkeys/register/finish?name=Laptop", csrfToken, authenticator.create(challenge(t, options)))
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, answer["redirect"], any("/account/passkeys"))
+
+		_, _, body := server.get(t, "/account/passkeys")
+		assert.StringContains(t, body, "value='Laptop'")
+	})
+
+	t.Run("Register without a name", func(t *testing.T) {
+		code, options := server.postJSON(t, "/account/passkeys/register/begin", csrfToken, nil)
+		assert.Equal(t, code, http.StatusOK)
+
+		code, _ = server.postJSON(t, "/account/passkeys/register/finish?name=", csrfToken, newSoftAuthenticator(t).create(challenge(t, options)))
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Register without a challenge", func(t *testing.T) {
+		code, _ := server.postJSON(t, "/account/passkeys/register/finish?name=Phone", csrfToken, newSoftAuthenticator(t).create("bm90LWlzc3VlZA"))
+		assert.Equal(t, code, http.StatusBadRequest)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", "Work laptop")
+		form.Add("csrf_token", csrfToken)
+
+		code, _, _ := server.postForm(t, "/account/passkeys/"+b64.EncodeToString(authenticator.id)+"/rename", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body := server.get(t, "/account/passkeys")
+		assert.StringContains(t, body, "value='Work laptop'")
+	})
+
+	t.Run("Rename unknown passkey", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", "Work laptop")
+		form.Add("csrf_token", csrfToken)
+
+		code, _, _ := server.postForm(t, "/account/passkeys/"+b64.EncodeToString([]byte("unknown"))+"/rename", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	// Start over with an empty cookie jar, as a browser that isn't logged in.
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Client().Jar = jar
+
+	_, _, body = server.get(t, "/user/login")
+	csrfToken = extractCSRFToken(t, body)
+
+	t.Run("Login with a bad signature", func(t *testing.T) {
+		code, options := server.postJSON(t, "/user/login/passkey/begin", csrfToken, nil)
+		assert.Equal(t, code, http.StatusOK)
+
+		assertion := authenticator.get(challenge(t, options), "1")
+		assertion["response"].(map[string]any)["signature"] = b64.EncodeToString([]byte("forged"))
+
+		code, _ = server.postJSON(t, "/user/login/passkey/finish", csrfToken, assertion)
+		assert.Equal(t, code, http.StatusUnauthorized)
+	})
+
+	t.Run("Login without user verification", func(t *testing.T) {
+		code, options := server.postJSON(t, "/user/login/passkey/begin", csrfToken, nil)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, options["publicKey"].(map[string]any)["userVerification"], any("required"))
+
+		code, _ = server.postJSON(t, "/user/login/passkey/finish", csrfToken, authenticator.sign(challenge(t, options), "1", 0x01))
+		assert.Equal(t, code, http.StatusUnauthorized)
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		code, options := server.postJSON(t, "/user/login/passkey/begin", csrfToken, nil)
+		assert.Equal(t, code, http.StatusOK)
+
+		code, answer := server.postJSON(t, "/user/login/passkey/finish", csrfToken, authenticator.get(challenge(t, options), "1"))
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, answer["redirect"], any("/snippet/create"))
+
+		code, _, body := server.get(t, "/account/passkeys")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Work laptop")
+		if strings.Contains(body, "Never") {
+			t.Error("last use of the passkey was not recorded")
+		}
+	})
+
+	t.Run("Login with a cloned passkey", func(t *testing.T) {
+		_, _, body := server.get(t, "/account/passkeys")
+		csrfToken := extractCSRFToken(t, body)
+
+		code, options := server.postJSON(t, "/user/login/passkey/begin", csrfToken, nil)
+		assert.Equal(t, code, http.StatusOK)
+
+		// a copy of the key still has the counter of the first login
+		authenticator.counter = 0
+		code, _ = server.postJSON(t, "/user/login/passkey/finish", csrfToken, authenticator.get(challenge(t, options), "1"))
+		assert.Equal(t, code, http.StatusUnauthorized)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		_, _, body := server.get(t, "/account/passkeys")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, _, _ := server.postForm(t, "/account/passkeys/"+b64.EncodeToString(authenticator.id)+"/delete", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body = server.get(t, "/account/passkeys")
+		assert.StringContains(t, body, "You haven't added any passkeys yet.")
+	})
+}
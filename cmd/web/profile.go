@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+const usernameRules = "Usernames are 3 to 30 lowercase letters, digits, dashes or underscores"
+
+// reservedUsernames can't be picked at signup or on the profile, they could be
+// mistaken for staff or for pages of the site. Neither can the placeholders
+// single sign-on hands out, though their owners may keep them.
+var reservedUsernames = []string{
+	"about", "account", "admin", "administrator", "api", "help", "login", "logout",
+	"moderator", "root", "security", "signup", "snippetbox", "staff", "support", "system",
+}
+
+func reservedUsername(username string) bool {
+	return validator.PermittedValue(username, reservedUsernames...) || strings.HasPrefix(username, models.SSOUsernamePrefix)
+}
+
+type accountProfileForm struct {
+	Name                string `form:"name"`
+	Username            string `form:"username"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = accountProfileForm{Name: user.Name, Username: user.Username, Email: user.Email}
+	app.render(w, r, http.StatusOK, "profile.tmpl.html", data)
+}
+
+// accountProfilePost saves the name right away. A new email address needs the
+// current password, since whoever controls the address can reset it, and only
+// takes effect once the link mailed to it is opened, see userEmailConfirm.
+func (app *application) accountProfilePost(w http.ResponseWriter, r *http.Request) {
+	var form accountProfileForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	form.Username = strings.ToLower(strings.TrimSpace(form.Username))
+	form.Email = models.NormalizeEmail(form.Email)
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChar(form.Name, 255), "name", "This field cannot be more than 255 characters long")
+	form.CheckField(validator.Matches(form.Username, validator.UsernameRegex), "username", usernameRules)
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "profile.tmpl.html", data)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if form.Username != user.Username {
+		form.CheckField(!reservedUsername(form.Username), "username", "This username is reserved, please pick another one")
+		if !form.Valid() {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "profile.tmpl.html", data)
+			return
+		}
+	}
+
+	// The username can still clash, so it is saved before an email change
+	// token is issued that would otherwise never be mailed.
+	if form.Name != user.Name || form.Username != user.Username {
+		err = app.users.UpdateProfile(userId, form.Name, form.Username)
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicateUsername) {
+				form.AddFieldError("username", "This username is already taken")
+				data := app.newTemplateData(r)
+				data.Form = form
+				app.render(w, r, http.StatusUnprocessableEntity, "profile.tmpl.html", data)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	var token string
+	if form.Email != user.Email {
+		form.CheckField(validator.NotBlank(form.Password), "password", "Enter your current password to change your email address")
+		if form.Valid() {
+			token, err = app.users.CreateEmailChange(userId, form.Password, form.Email, emailChangeTTL)
+			if err != nil {
+				switch {
+				case errors.Is(err, models.ErrInvalidCredentials):
+					form.AddFieldError("password", "Password is incorrect")
+				case errors.Is(err, models.ErrDuplicateEmail):
+					form.AddFieldError("email", "Email address is already in use")
+				default:
+					app.serverError(w, r, err)
+					return
+				}
+			}
+		}
+		if !form.Valid() {
+			form.Password = ""
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "profile.tmpl.html", data)
+			return
+		}
+	}
+
+	if token == "" {
+		app.sessionManager.Put(r.Context(), "flash", "Your profile has been saved.")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditTokenCreate,
+		UserId:  userId,
+		Details: map[string]string{"kind": "email change", "email": form.Email},
+	})
+
+	data := map[string]any{
+		"Name":  form.Name,
+		"URL":   app.baseURL + "/user/email/confirm/" + token,
+		"Valid": "24 hours",
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(form.Email, "email/email_change.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error(), "email", form.Email)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "We sent a link to "+form.Email+". Your email address changes once you open it.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// userEmailConfirm does not require a login, the link may well be opened in a
+// different browser. The old address is told about the change, in case it
+// wasn't the owner who made it, and every other session is signed out.
+func (app *application) userEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	redirect := "/user/login"
+	sessionId := 0
+	if app.isAuthenticated(r) {
+		redirect = "/account/view"
+		sessionId = app.sessionManager.GetInt(r.Context(), "sessionId")
+	}
+
+	change, err := app.users.ChangeEmail(r.PathValue("token"), sessionId)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidToken):
+			app.sessionManager.Put(r.Context(), "flash", "This link is invalid or has expired, please change your email address again.")
+		case errors.Is(err, models.ErrDuplicateEmail):
+			app.sessionManager.Put(r.Context(), "flash", "That email address has been taken by another account in the meantime.")
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	// The link may be opened while logged out, the account owner still made
+	// the change.
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditEmailChange,
+		ActorId: change.UserId,
+		UserId:  change.UserId,
+		Details: map[string]string{"from": change.OldEmail, "to": change.NewEmail},
+	})
+
+	data := map[string]any{
+		"Name":     change.Name,
+		"NewEmail": change.NewEmail,
+		"URL":      app.baseURL + "/user/password/forgot",
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(change.OldEmail, "email/email_changed.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error(), "email", change.OldEmail)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address is now "+change.NewEmail+".")
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// userProfile is the public page of a user. It shows the username and never
+// the email address.
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.GetByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippets, err := app.snippets.PublicForUser(user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	stats, err := app.snippets.AuthorStats(user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.Snippets = snippets
+	data.AuthorStats = stats
+	app.render(w, r, http.StatusOK, "user.tmpl.html", data)
+}
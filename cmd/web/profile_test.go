@@ -0,0 +1,282 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAccountProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		userName  string
+		username  string
+		email     string
+		password  string
+		wantCode  int
+		wantFlash string
+		wantError string
+		wantMail  bool
+	}{
+		{
+			name:      "Change name",
+			userName:  "Alice Smith",
+			username:  "alice",
+			email:     "alice@example.com",
+			wantCode:  http.StatusSeeOther,
+			wantFlash: "Your profile has been saved.",
+		},
+		{
+			name:      "Change email",
+			userName:  "Alice Jones",
+			username:  "alice",
+			email:     "alice@new.example.com",
+			password:  "pa$$word",
+			wantCode:  http.StatusSeeOther,
+			wantFlash: "We sent a link to alice@new.example.com.",
+			wantMail:  true,
+		},
+		{
+			name:      "Change email without password",
+			userName:  "Alice Jones",
+			username:  "alice",
+			email:     "alice@new.example.com",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "Enter your current password to change your email address",
+		},
+		{
+			name:      "Change email with wrong password",
+			userName:  "Alice Jones",
+			username:  "alice",
+			email:     "alice@new.example.com",
+			password:  "wrong",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "Password is incorrect",
+		},
+		{
+			name:      "Change username",
+			userName:  "Alice Jones",
+			username:  "Alice-J",
+			email:     "alice@example.com",
+			wantCode:  http.StatusSeeOther,
+			wantFlash: "Your profile has been saved.",
+		},
+		{
+			name:      "Username taken",
+			userName:  "Alice Jones",
+			username:  "mod",
+			email:     "alice@example.com",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This username is already taken",
+		},
+		{
+			name:      "Username taken with email change",
+			userName:  "Alice Jones",
+			username:  "mod",
+			email:     "alice@new.example.com",
+			password:  "pa$$word",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This username is already taken",
+		},
+		{
+			name:      "Single sign-on placeholder username",
+			userName:  "Alice Jones",
+			username:  "user-4f2k9x0q1z",
+			email:     "alice@example.com",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This username is reserved",
+		},
+		{
+			name:      "Invalid username",
+			userName:  "Alice Jones",
+			username:  "a",
+			email:     "alice@example.com",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "Usernames are 3 to 30 lowercase letters",
+		},
+		{
+			name:      "Email in use",
+			userName:  "Alice Jones",
+			username:  "alice",
+			email:     "mod@example.com",
+			password:  "pa$$word",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "Email address is already in use",
+		},
+		{
+			name:      "Blank name",
+			userName:  " ",
+			username:  "alice",
+			email:     "alice@example.com",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This field cannot be blank",
+		},
+		{
+			name:      "Invalid email",
+			userName:  "Alice Jones",
+			username:  "alice",
+			email:     "alice@",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This field must be a valid email address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			outbox := useOutbox(app)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			server.login(t, "alice@example.com", "pa$$word")
+
+			code, _, body := server.get(t, "/account/profile")
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, "<input type='text' name='name' value='Alice Jones'>")
+
+			form := url.Values{}
+			form.Add("name", tt.userName)
+			form.Add("username", tt.username)
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, header, body := server.postForm(t, "/account/profile", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantFlash != "" {
+				assert.Equal(t, header.Get("Location"), "/account/view")
+				_, _, body = server.get(t, "/account/view")
+				assert.StringContains(t, body, tt.wantFlash)
+			}
+			if tt.wantError != "" {
+				assert.StringContains(t, body, tt.wantError)
+			}
+
+			app.wg.Wait()
+			messages := outbox.Messages(tt.email)
+			changes := app.users.(*mocks.UserModel).EmailChanges
+			if tt.wantMail {
+				assert.Equal(t, len(messages), 1)
+				assert.StringContains(t, messages[0].Body, "https://snippetbox.test/user/email/confirm/valid-email-token")
+				assert.Equal(t, len(changes), 1)
+			} else {
+				assert.Equal(t, len(messages), 0)
+				// no token is issued that isn't mailed
+				assert.Equal(t, len(changes), 0)
+			}
+		})
+	}
+}
+
+func TestUserEmailConfirm(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		wantFlash string
+		wantMail  bool
+	}{
+		{
+			name:      "Valid token",
+			token:     "valid-email-token",
+			wantFlash: "Your email address is now alice@new.example.com.",
+			wantMail:  true,
+		},
+		{
+			name:      "Invalid token",
+			token:     "used-email-token",
+			wantFlash: "This link is invalid or has expired",
+		},
+		{
+			name:      "Address taken since",
+			token:     "taken-email-token",
+			wantFlash: "That email address has been taken by another account in the meantime.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			outbox := useOutbox(app)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			code, header, _ := server.get(t, "/user/email/confirm/"+tt.token)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login")
+
+			_, _, body := server.get(t, "/user/login")
+			assert.StringContains(t, body, tt.wantFlash)
+
+			app.wg.Wait()
+			messages := outbox.Messages("alice@example.com")
+			audits := app.audits.(*mocks.AuditModel)
+			if tt.wantMail {
+				assert.Equal(t, strings.Join(audits.Recorded(), ","), "email_change")
+				assert.Equal(t, audits.Events[0].ActorId, 1)
+				assert.Equal(t, len(messages), 1)
+				assert.StringContains(t, messages[0].Subject, "Your Snippetbox email address has changed")
+				assert.StringContains(t, messages[0].Body, "changed to alice@new.example.com")
+			} else {
+				assert.Equal(t, len(audits.Recorded()), 0)
+				assert.Equal(t, len(messages), 0)
+			}
+		})
+	}
+}
+
+func TestUserProfile(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Public snippets",
+			urlPath:  "/u/alice",
+			wantCode: http.StatusOK,
+			wantBody: "<a href='/snippet/view/snippet-go'>Hello world</a>",
+		},
+		{
+			name:     "Stars and forks",
+			urlPath:  "/u/alice",
+			wantCode: http.StatusOK,
+			wantBody: "<p>2 stars &middot; 1 fork</p>",
+		},
+		{
+			name:     "No snippets",
+			urlPath:  "/u/mod",
+			wantCode: http.StatusOK,
+			wantBody: "Mo Derator hasn't shared any snippets yet.",
+		},
+		{
+			name:     "Disabled user",
+			urlPath:  "/u/disabled",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown user",
+			urlPath:  "/u/nobody",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+			if strings.Contains(body, "@example.com") {
+				t.Error("profile shows an email address")
+			}
+		})
+	}
+}
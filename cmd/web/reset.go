@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/validator"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// forcedResetTTL is longer, the user didn't ask for the link and may not read
+// their email straight away.
+const forcedResetTTL = 24 * time.Hour
+
+const forcedResetMessage = "You need to choose a new password, use the link we emailed you or ask for a new one"
+
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type passwordResetForm struct {
+	Token                   string `form:"-"`
+	NewPassword             string `form:"newPassword"`
+	NewPasswordConfirmation string `form:"newPasswordConfirmation"`
+	validator.Validator     `form:"-"`
+}
+
+func (app *application) userPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordForgotForm{}
+	app.render(w, r, http.StatusOK, "forgot.tmpl.html", data)
+}
+
+// userPasswordForgotPost answers the same way whether or not the address
+// belongs to an account, so it cannot be used to find out who has signed up.
+func (app *application) userPasswordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "forgot.tmpl.html", data)
+		return
+	}
+
+	ipKey, emailKey := resetKeys(r, form.Email)
+	wait, _, err := app.reserveAttempt(ipKey, emailKey)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if wait > 0 {
+		form.AddNonFieldError(fmt.Sprintf("Too many reset requests, please wait %s and try again", wait.Round(time.Second)))
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "forgot.tmpl.html", data)
+		return
+	}
+
+	token, err := app.users.CreatePasswordReset(form.Email, passwordResetTTL)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err == nil {
+		app.auditTokenCreate(r, form.Email, "password reset")
+
+		data := map[string]any{
+			"URL":   app.baseURL + "/user/password/reset/" + token,
+			"Valid": "30 minutes",
+		}
+
+		app.background(func() {
+			err := app.mailer.Send(form.Email, "email/reset.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error(), "email", form.Email)
+			}
+		})
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If an account exists for that address, we have emailed it a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordResetForm{Token: r.PathValue("token")}
+	app.render(w, r, http.StatusOK, "reset.tmpl.html", data)
+}
+
+func (app *application) userPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	form := passwordResetForm{Token: r.PathValue("token")}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The user is looked up first so the new password can be checked against
+	// their name and email address.
+	user, err := app.users.GetByResetToken(form.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			app.renderInvalidResetLink(w, r, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "this field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "This field needs to be atleast 8 characters")
+	problem, err := app.passwordProblem(form.NewPassword, user.Name, user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if problem != "" {
+		form.AddFieldError("newPassword", problem)
+	}
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "New password and password confirmation need to be the same value")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "reset.tmpl.html", data)
+		return
+	}
+
+	userId, err := app.users.ResetPassword(form.Token, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			app.renderInvalidResetLink(w, r, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditEvent{Event: models.AuditPasswordReset, UserId: userId})
+
+	// The model revoked every stored session of the user, this one included
+	// if they happened to be logged in.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserId")
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset, please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// renderInvalidResetLink shows the reset form again with a note that its link
+// can't be used anymore.
+func (app *application) renderInvalidResetLink(w http.ResponseWriter, r *http.Request, form passwordResetForm) {
+	form.AddNonFieldError("This reset link is invalid or has expired, please request a new one")
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, http.StatusUnprocessableEntity, "reset.tmpl.html", data)
+}
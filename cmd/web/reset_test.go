@@ -0,0 +1,170 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestPasswordForgot(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantMail bool
+	}{
+		{
+			name:     "Known account",
+			email:    "alice@example.com",
+			wantCode: http.StatusSeeOther,
+			wantMail: true,
+		},
+		{
+			name:     "Unknown account",
+			email:    "nobody@example.com",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Invalid email",
+			email:    "alice@",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			outbox := useOutbox(app)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			_, _, body := server.get(t, "/user/password/forgot")
+
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, header, _ := server.postForm(t, "/user/password/forgot", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if code == http.StatusSeeOther {
+				// known and unknown addresses must look the same
+				assert.Equal(t, header.Get("Location"), "/user/login")
+				_, _, body = server.get(t, "/user/login")
+				assert.StringContains(t, body, "If an account exists for that address")
+			}
+
+			app.wg.Wait()
+			messages := outbox.Messages(tt.email)
+			if tt.wantMail {
+				assert.Equal(t, len(messages), 1)
+				assert.StringContains(t, messages[0].Body, "https://snippetbox.test/user/password/reset/valid-reset-token")
+			} else {
+				assert.Equal(t, len(messages), 0)
+			}
+		})
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	code, _, body := server.get(t, "/user/password/reset/valid-reset-token")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/user/password/reset/valid-reset-token' method='POST' novalidate>")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		token        string
+		password     string
+		confirmation string
+		wantCode     int
+		wantBody     string
+	}{
+		{
+			name:         "Valid token",
+			token:        "valid-reset-token",
+			password:     "new-Lantern-42",
+			confirmation: "new-Lantern-42",
+			wantCode:     http.StatusSeeOther,
+		},
+		{
+			name:         "Invalid token",
+			token:        "used-reset-token",
+			password:     "new-Lantern-42",
+			confirmation: "new-Lantern-42",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "invalid or has expired",
+		},
+		{
+			name:         "Short password",
+			token:        "valid-reset-token",
+			password:     "pa$$",
+			confirmation: "pa$$",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "atleast 8 characters",
+		},
+		{
+			name:         "Weak password",
+			token:        "valid-reset-token",
+			password:     "qwerty123",
+			confirmation: "qwerty123",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "This password is based on a commonly used password or word",
+		},
+		{
+			name:         "Password based on the user's name",
+			token:        "valid-reset-token",
+			password:     "reeseetter2024",
+			confirmation: "reeseetter2024",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "This password is too close to your name or email address",
+		},
+		{
+			name:         "Mismatched confirmation",
+			token:        "valid-reset-token",
+			password:     "new-Lantern-42",
+			confirmation: "other-Lantern-42",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "need to be the same value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("newPassword", tt.password)
+			form.Add("newPasswordConfirmation", tt.confirmation)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := server.postForm(t, "/user/password/reset/"+tt.token, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	t.Run("Logged in session is signed out", func(t *testing.T) {
+		server := newTestServer(t, app.routes())
+		defer server.Close()
+
+		server.login(t, "alice@example.com", "pa$$word")
+
+		_, _, body := server.get(t, "/user/password/reset/valid-reset-token")
+
+		form := url.Values{}
+		form.Add("newPassword", "new-Lantern-42")
+		form.Add("newPasswordConfirmation", "new-Lantern-42")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, _, _ := server.postForm(t, "/user/password/reset/valid-reset-token", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, header, _ := server.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+}
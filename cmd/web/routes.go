@@ -1,6 +1,7 @@
 package main
 
 import (
+	"go-webserver/internal/models"
 	"go-webserver/ui"
 	"net/http"
 
@@ -17,19 +18,114 @@ func (app *application) routes() http.Handler {
 	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
 	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("GET /s/{slug}", dynamic.ThenFunc(app.snippetViewBySlug))
+	mux.Handle("GET /snippet/report/{id}", dynamic.ThenFunc(app.snippetReport))
+	mux.Handle("POST /snippet/report/{id}", dynamic.ThenFunc(app.snippetReportPost))
+	mux.Handle("GET /snippet/format/{id}", dynamic.ThenFunc(app.snippetFormat))
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
 	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
 	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
+	mux.Handle("GET /user/login/2fa", dynamic.ThenFunc(app.userLoginTOTP))
+	mux.Handle("POST /user/login/2fa", dynamic.ThenFunc(app.userLoginTOTPPost))
+	mux.Handle("POST /user/login/passkey/begin", dynamic.ThenFunc(app.userLoginPasskeyBegin))
+	mux.Handle("POST /user/login/passkey/finish", dynamic.ThenFunc(app.userLoginPasskeyFinish))
+	mux.Handle("GET /user/login/sso", dynamic.ThenFunc(app.userLoginSSO))
+	mux.Handle("GET /user/login/sso/callback", dynamic.ThenFunc(app.userLoginSSOCallback))
+	mux.Handle("GET /user/verify/{token}", dynamic.ThenFunc(app.userVerify))
+	mux.Handle("GET /user/email/confirm/{token}", dynamic.ThenFunc(app.userEmailConfirm))
+	mux.Handle("GET /user/password/forgot", dynamic.ThenFunc(app.userPasswordForgot))
+	mux.Handle("POST /user/password/forgot", dynamic.ThenFunc(app.userPasswordForgotPost))
+	mux.Handle("GET /user/password/reset/{token}", dynamic.ThenFunc(app.userPasswordReset))
+	mux.Handle("POST /user/password/reset/{token}", dynamic.ThenFunc(app.userPasswordResetPost))
 	mux.Handle("GET /about", dynamic.ThenFunc(app.about))
+	mux.Handle("GET /u/{username}", dynamic.ThenFunc(app.userProfile))
+	mux.Handle("GET /collection/{id}", dynamic.ThenFunc(app.collectionView))
+	mux.Handle("GET /collection/{id}/export", dynamic.ThenFunc(app.collectionExport))
 
 	protected := dynamic.Append(app.requireAuthentication)
-	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreate))
-	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
+	mux.Handle("GET /account/verify", protected.ThenFunc(app.accountVerify))
+	mux.Handle("POST /account/verify/resend", protected.ThenFunc(app.accountVerifyResendPost))
 	mux.Handle("GET /account/view", protected.ThenFunc(app.accountView))
+	mux.Handle("GET /account/profile", protected.ThenFunc(app.accountProfile))
+	mux.Handle("POST /account/profile", protected.ThenFunc(app.accountProfilePost))
 	mux.Handle("GET /account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
 	mux.Handle("POST /account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
+	mux.Handle("GET /account/export", protected.ThenFunc(app.accountExport))
+	mux.Handle("POST /account/export", protected.ThenFunc(app.accountExportPost))
+	mux.Handle("GET /account/export/{id}", protected.ThenFunc(app.accountExportDownload))
+	mux.Handle("GET /account/2fa", protected.ThenFunc(app.accountTOTP))
+	mux.Handle("GET /account/2fa/qr.png", protected.ThenFunc(app.accountTOTPQR))
+	mux.Handle("POST /account/2fa/enable", protected.ThenFunc(app.accountTOTPEnablePost))
+	mux.Handle("POST /account/2fa/disable", protected.ThenFunc(app.accountTOTPDisablePost))
+	mux.Handle("POST /account/2fa/recovery-codes", protected.ThenFunc(app.accountRecoveryCodesPost))
+	mux.Handle("GET /account/passkeys", protected.ThenFunc(app.accountPasskeys))
+	mux.Handle("POST /account/passkeys/register/begin", protected.ThenFunc(app.accountPasskeyRegisterBegin))
+	mux.Handle("POST /account/passkeys/register/finish", protected.ThenFunc(app.accountPasskeyRegisterFinish))
+	mux.Handle("POST /account/passkeys/{id}/rename", protected.ThenFunc(app.accountPasskeyRenamePost))
+	mux.Handle("POST /account/passkeys/{id}/delete", protected.ThenFunc(app.accountPasskeyDeletePost))
+	mux.Handle("GET /account/sessions", protected.ThenFunc(app.accountSessions))
+	mux.Handle("POST /account/sessions/{id}/revoke", protected.ThenFunc(app.accountSessionRevokePost))
+	mux.Handle("POST /account/sessions/revoke-others", protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+	mux.Handle("GET /account/security", protected.ThenFunc(app.accountSecurity))
+	mux.Handle("GET /account/tokens", protected.ThenFunc(app.accountTokens))
+	mux.Handle("POST /account/tokens", protected.ThenFunc(app.accountTokenCreatePost))
+	mux.Handle("POST /account/tokens/{id}/delete", protected.ThenFunc(app.accountTokenDeletePost))
+	mux.Handle("GET /account/delete", protected.ThenFunc(app.accountDelete))
+	mux.Handle("POST /account/delete", protected.ThenFunc(app.accountDeletePost))
+	mux.Handle("GET /collections", protected.ThenFunc(app.collectionList))
+	mux.Handle("GET /collection/create", protected.ThenFunc(app.collectionCreate))
+	mux.Handle("POST /collection/create", protected.ThenFunc(app.collectionCreatePost))
+	mux.Handle("POST /collection/{id}/add", protected.ThenFunc(app.collectionAddPost))
+	mux.Handle("POST /snippet/star/{id}", protected.ThenFunc(app.snippetStarPost))
+	mux.Handle("POST /snippet/unstar/{id}", protected.ThenFunc(app.snippetUnstarPost))
+	mux.Handle("POST /collection/{id}/remove", protected.ThenFunc(app.collectionRemovePost))
+	mux.Handle("POST /collection/{id}/move", protected.ThenFunc(app.collectionMovePost))
+	mux.Handle("GET /orgs", protected.ThenFunc(app.orgList))
+	mux.Handle("GET /org/{id}", protected.ThenFunc(app.orgView))
+	mux.Handle("POST /org/{id}/leave", protected.ThenFunc(app.orgLeavePost))
+	mux.Handle("POST /org/{id}/members/{userId}/role", protected.ThenFunc(app.orgMemberRolePost))
+	mux.Handle("POST /org/{id}/members/{userId}/remove", protected.ThenFunc(app.orgMemberRemovePost))
+
+	verified := protected.Append(app.requireVerified)
+	mux.Handle("GET /snippet/create", verified.ThenFunc(app.snippetCreate))
+	mux.Handle("POST /snippet/create", verified.ThenFunc(app.snippetCreatePost))
+	mux.Handle("POST /snippet/format/{id}", verified.ThenFunc(app.snippetFormatPost))
+	mux.Handle("POST /snippet/fork/{id}", verified.ThenFunc(app.snippetForkPost))
+	mux.Handle("GET /snippet/edit/{id}", verified.ThenFunc(app.snippetEdit))
+	mux.Handle("POST /snippet/edit/{id}", verified.ThenFunc(app.snippetEditPost))
+	mux.Handle("GET /org/create", verified.ThenFunc(app.orgCreate))
+	mux.Handle("POST /org/create", verified.ThenFunc(app.orgCreatePost))
+	mux.Handle("POST /org/{id}/invite", verified.ThenFunc(app.orgInvitePost))
+	mux.Handle("GET /orgs/invitation/{token}", verified.ThenFunc(app.orgInvitation))
+	mux.Handle("POST /orgs/invitation/{token}", verified.ThenFunc(app.orgInvitationPost))
+
+	moderation := protected.Append(app.requireRole(models.RoleModerator))
+	mux.Handle("GET /moderation", moderation.ThenFunc(app.moderationQueue))
+	mux.Handle("POST /moderation/report/{id}", moderation.ThenFunc(app.moderationDecisionPost))
+
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+	mux.Handle("GET /admin", admin.ThenFunc(app.adminDashboard))
+	mux.Handle("POST /admin/roles/{role}/2fa", admin.ThenFunc(app.adminRoleTOTPPost))
+	mux.Handle("GET /admin/users", admin.ThenFunc(app.adminUsers))
+	mux.Handle("POST /admin/users/{id}/disable", admin.ThenFunc(app.adminUserDisablePost))
+	mux.Handle("POST /admin/users/{id}/reset-password", admin.ThenFunc(app.adminUserResetPasswordPost))
+	mux.Handle("POST /admin/users/{id}/role", admin.ThenFunc(app.adminUserRolePost))
+	mux.Handle("GET /admin/snippets", admin.ThenFunc(app.adminSnippets))
+	mux.Handle("POST /admin/snippets/{id}/delete", admin.ThenFunc(app.adminSnippetDeletePost))
+	mux.Handle("GET /admin/audit", admin.ThenFunc(app.adminAudit))
+	mux.Handle("GET /admin/invites", admin.ThenFunc(app.adminInvites))
+	mux.Handle("POST /admin/invites", admin.ThenFunc(app.adminInviteCreatePost))
+	mux.Handle("POST /admin/invites/{id}/revoke", admin.ThenFunc(app.adminInviteRevokePost))
+
+	// Scripts authenticate with API tokens instead of session cookies. The
+	// API doesn't go through the dynamic chain, so a logged in browser can't
+	// be tricked into calling it, see authenticateToken.
+	api := alice.New(app.authenticateToken)
+	mux.Handle("GET /api/snippets", api.Append(app.requireScope(models.ScopeSnippetsRead)).ThenFunc(app.apiSnippets))
+	mux.Handle("GET /api/snippets/{id}", api.Append(app.requireScope(models.ScopeSnippetsRead)).ThenFunc(app.apiSnippet))
+	mux.Handle("POST /api/snippets", api.Append(app.requireScope(models.ScopeSnippetsWrite)).ThenFunc(app.apiSnippetCreate))
 
 
 
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-webserver/internal/models"
+)
+
+// browsers and platforms are matched against the User-Agent in order, the
+// first hit wins. Most browsers claim to be several others as well.
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	platforms = []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"CrOS", "ChromeOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// describeDevice turns a User-Agent into something a user recognises, like
+// "Firefox on Linux".
+func describeDevice(userAgent string) string {
+	var browser, platform string
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return "Unknown browser on " + platform
+	default:
+		return "Unknown device"
+	}
+}
+
+// recordSession stores the device and address of a new login and ties the
+// record to the current session.
+func (app *application) recordSession(r *http.Request, userId int) error {
+	id, err := app.sessions.Insert(userId, app.sessionManager.Token(r.Context()), describeDevice(r.UserAgent()), clientIP(r))
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), "sessionId", id)
+	return nil
+}
+
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.sessions.ForUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"), app.sessionManager.Lifetime)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	data.SessionId = app.sessionManager.GetInt(r.Context(), "sessionId")
+	app.render(w, r, http.StatusOK, "sessions.tmpl.html", data)
+}
+
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if id == app.sessionManager.GetInt(r.Context(), "sessionId") {
+		app.sessionManager.Put(r.Context(), "flash", "Use the logout button to end this session.")
+		http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sessions.Revoke(id, app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The session has been signed out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	err := app.sessions.RevokeOthers(app.sessionManager.GetInt(r.Context(), "sessionId"), app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You've been signed out everywhere else.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
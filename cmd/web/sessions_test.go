@@ -0,0 +1,143 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+			want:      "Firefox on Linux",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0",
+			want:      "Edge on Windows",
+		},
+		{
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1",
+			want:      "Safari on iOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36",
+			want:      "Chrome on Android",
+		},
+		{
+			userAgent: "curl/8.5.0",
+			want:      "curl",
+		},
+		{
+			userAgent: "",
+			want:      "Unknown device",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, describeDevice(tt.userAgent), tt.want)
+		})
+	}
+}
+
+// loggedIn reports whether the client's session is still logged in.
+func loggedIn(t *testing.T, server *testServer) bool {
+	code, _, _ := server.get(t, "/account/view")
+	return code == http.StatusOK
+}
+
+func TestAccountSessions(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	// two browsers, sharing the app and its sessions
+	laptop := newTestServer(t, routes)
+	defer laptop.Close()
+	phone := newTestServer(t, routes)
+	defer phone.Close()
+
+	laptop.login(t, "alice@example.com", "pa$$word")
+	phone.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := laptop.get(t, "/account/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "This device")
+	assert.StringContains(t, body, "<form action='/account/sessions/2/revoke' method='POST'>")
+	assert.StringContains(t, body, "Sign out everywhere else")
+	csrfToken := extractCSRFToken(t, body)
+
+	revoke := func(urlPath string) int {
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		code, _, _ := laptop.postForm(t, urlPath, form)
+		return code
+	}
+
+	t.Run("Revoke", func(t *testing.T) {
+		assert.Equal(t, revoke("/account/sessions/2/revoke"), http.StatusSeeOther)
+		assert.Equal(t, loggedIn(t, phone), false)
+		assert.Equal(t, loggedIn(t, laptop), true)
+	})
+
+	t.Run("Revoke this session", func(t *testing.T) {
+		assert.Equal(t, revoke("/account/sessions/1/revoke"), http.StatusSeeOther)
+		assert.Equal(t, loggedIn(t, laptop), true)
+	})
+
+	t.Run("Revoke someone else's session", func(t *testing.T) {
+		phone.login(t, "mod@example.com", "pa$$word")
+
+		assert.Equal(t, revoke("/account/sessions/3/revoke"), http.StatusNotFound)
+		assert.Equal(t, loggedIn(t, phone), true)
+	})
+
+	t.Run("Sign out everywhere else", func(t *testing.T) {
+		phone.login(t, "alice@example.com", "pa$$word")
+
+		assert.Equal(t, revoke("/account/sessions/revoke-others"), http.StatusSeeOther)
+		assert.Equal(t, loggedIn(t, phone), false)
+		assert.Equal(t, loggedIn(t, laptop), true)
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		assert.Equal(t, revoke("/user/logout"), http.StatusSeeOther)
+
+		sessions, err := app.sessions.ForUser(1, app.sessionManager.Lifetime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 0)
+	})
+}
+
+func TestPasswordUpdateRevokesSessions(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	laptop := newTestServer(t, routes)
+	defer laptop.Close()
+	phone := newTestServer(t, routes)
+	defer phone.Close()
+
+	laptop.login(t, "alice@example.com", "pa$$word")
+	phone.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := laptop.get(t, "/account/password/update")
+
+	form := url.Values{}
+	form.Add("currentPassword", "pa$$word")
+	form.Add("newPassword", "new-Lantern-42")
+	form.Add("newPasswordConfirmation", "new-Lantern-42")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := laptop.postForm(t, "/account/password/update", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	assert.Equal(t, loggedIn(t, phone), false)
+	assert.Equal(t, loggedIn(t, laptop), true)
+}
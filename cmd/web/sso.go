@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-webserver/internal/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ssoProvider is the OpenID Connect provider users can log in with instead of
+// a password.
+type ssoProvider struct {
+	name     string
+	issuer   string
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// newSSOProvider fetches the provider's discovery document from issuer.
+func newSSOProvider(ctx context.Context, name, issuer, clientID, clientSecret, redirectURL string) (*ssoProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssoProvider{
+		name:   name,
+		issuer: issuer,
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+type ssoClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// identify trades the authorization code for an ID token and returns the
+// subject and claims it vouches for.
+func (p *ssoProvider) identify(ctx context.Context, code, verifier, nonce string) (string, ssoClaims, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return "", ssoClaims{}, err
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", ssoClaims{}, errors.New("sso: no id_token in token response")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return "", ssoClaims{}, err
+	}
+	if idToken.Nonce != nonce {
+		return "", ssoClaims{}, errors.New("sso: nonce mismatch")
+	}
+
+	var claims ssoClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return "", ssoClaims{}, err
+	}
+	return idToken.Subject, claims, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// userLoginSSO sends the user to the provider. State, nonce and the PKCE
+// verifier stay in the session until the provider sends the user back.
+func (app *application) userLoginSSO(w http.ResponseWriter, r *http.Request) {
+	if app.sso == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	app.sessionManager.Put(r.Context(), "ssoState", state)
+	app.sessionManager.Put(r.Context(), "ssoNonce", nonce)
+	app.sessionManager.Put(r.Context(), "ssoVerifier", verifier)
+
+	url := app.sso.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+func (app *application) userLoginSSOCallback(w http.ResponseWriter, r *http.Request) {
+	if app.sso == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state := app.sessionManager.PopString(r.Context(), "ssoState")
+	nonce := app.sessionManager.PopString(r.Context(), "ssoNonce")
+	verifier := app.sessionManager.PopString(r.Context(), "ssoVerifier")
+
+	query := r.URL.Query()
+	if state == "" || query.Get("state") != state {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if query.Get("error") != "" {
+		app.ssoFailed(w, r, "Logging in with "+app.sso.name+" was cancelled.")
+		return
+	}
+
+	subject, claims, err := app.sso.identify(r.Context(), query.Get("code"), verifier, nonce)
+	if err != nil {
+		app.logger.Warn("sso login failed", "error", err)
+		app.ssoFailed(w, r, "Logging in with "+app.sso.name+" failed, please try again.")
+		return
+	}
+
+	// Only an address the provider has checked may be matched against
+	// existing accounts.
+	if claims.Email == "" || !claims.EmailVerified {
+		app.ssoFailed(w, r, app.sso.name+" hasn't verified your email address.")
+		return
+	}
+	if claims.Name == "" {
+		claims.Name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	// Outside open signup the provider may only log in existing users, it
+	// can't be used to get around the invite codes.
+	id, err := app.users.SSOLogin(app.sso.issuer, subject, claims.Email, claims.Name, app.signupMode == signupOpen)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.ssoFailed(w, r, "There is no account for "+claims.Email+", and new signups are closed.")
+		case errors.Is(err, models.ErrUnverifiedAccount):
+			app.ssoFailed(w, r, "The account for "+claims.Email+" hasn't verified its email address yet. Log in with your password and verify it, then "+app.sso.name+" will log you in too.")
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if user.Disabled {
+		app.ssoFailed(w, r, "This account has been disabled.")
+		return
+	}
+	if user.PasswordResetRequired {
+		app.ssoFailed(w, r, forcedResetMessage+".")
+		return
+	}
+
+	// 2FA set up on this site still applies, whoever vouched for the user.
+	if user.TOTPEnabled {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "passwordVerifiedUserId", id)
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	app.completeLogin(w, r, id, "sso")
+}
+
+func (app *application) ssoFailed(w http.ResponseWriter, r *http.Request, message string) {
+	app.sessionManager.Put(r.Context(), "flash", message)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"go-webserver/internal/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// fakeProvider is just enough of an OpenID Connect provider for the
+// authorization code flow with PKCE. Tests skip the login page, they hand out
+// codes with authorize and the app redeems them at the token endpoint.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	nonce     string
+	claims    map[string]any
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakeProvider{key: key, grants: make(map[string]fakeGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// authorize plays the provider's login page. It checks the request the app
+// sent the user off with and returns the code and state to come back with.
+func (p *fakeProvider) authorize(t *testing.T, location string, claims map[string]any) (string, string) {
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+
+	assert.Equal(t, u.Path, "/authorize")
+	assert.Equal(t, query.Get("client_id"), "snippetbox")
+	assert.Equal(t, query.Get("response_type"), "code")
+	assert.Equal(t, query.Get("code_challenge_method"), "S256")
+	assert.Equal(t, query.Get("redirect_uri"), "https://snippetbox.test/user/login/sso/callback")
+
+	code, err := randomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grants[code] = fakeGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	return code, query.Get("state")
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   p.URL,
+		"aud":   "snippetbox",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": grant.nonce,
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	payload, _ := json.Marshal(claims)
+
+	signer, _ := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: p.key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	signed, _ := signer.Sign(payload)
+	idToken, _ := signed.CompactSerialize()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func TestSSOLogin(t *testing.T) {
+	provider := newFakeProvider(t)
+	defer provider.Close()
+
+	tests := []struct {
+		name         string
+		claims       map[string]any
+		mode         string
+		badState     bool
+		badCode      bool
+		wantCode     int
+		wantLocation string
+		wantAccount  string
+		wantFlash    string
+	}{
+		{
+			name:         "Existing user",
+			claims:       map[string]any{"sub": "u-1", "email": "Alice@example.com", "email_verified": true},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/create",
+			wantAccount:  "Alice Jones",
+		},
+		{
+			name:         "New user",
+			claims:       map[string]any{"sub": "u-2", "email": "new@corp.example", "email_verified": true, "name": "New Person"},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/create",
+			wantAccount:  "New Person",
+		},
+		{
+			name:         "Existing user, invite only",
+			claims:       map[string]any{"sub": "u-1", "email": "alice@example.com", "email_verified": true},
+			mode:         signupInvite,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/create",
+			wantAccount:  "Alice Jones",
+		},
+		{
+			name:         "New user, invite only",
+			claims:       map[string]any{"sub": "u-2", "email": "new@corp.example", "email_verified": true},
+			mode:         signupInvite,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "New user, signups closed",
+			claims:       map[string]any{"sub": "u-2", "email": "new@corp.example", "email_verified": true},
+			mode:         signupClosed,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Unverified email",
+			claims:       map[string]any{"sub": "u-3", "email": "alice@example.com", "email_verified": false},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Unverified account",
+			claims:       map[string]any{"sub": "u-6", "email": "unverified@example.com", "email_verified": true},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+			wantFlash:    "hasn&#39;t verified its email address yet",
+		},
+		{
+			name:         "Disabled user",
+			claims:       map[string]any{"sub": "u-4", "email": "disabled@example.com", "email_verified": true},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Two-factor user",
+			claims:       map[string]any{"sub": "u-7", "email": "totp@example.com", "email_verified": true},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login/2fa",
+		},
+		{
+			name:         "Wrong code",
+			claims:       map[string]any{"sub": "u-1", "email": "alice@example.com", "email_verified": true},
+			badCode:      true,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:     "Wrong state",
+			claims:   map[string]any{"sub": "u-1", "email": "alice@example.com", "email_verified": true},
+			badState: true,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			if tt.mode != "" {
+				app.signupMode = tt.mode
+			}
+
+			var err error
+			app.sso, err = newSSOProvider(context.Background(), "Corp", provider.URL, "snippetbox", "secret", "https://snippetbox.test/user/login/sso/callback")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			_, _, body := server.get(t, "/user/login")
+			assert.StringContains(t, body, "Log in with Corp")
+
+			code, header, _ := server.get(t, "/user/login/sso")
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			authCode, state := provider.authorize(t, header.Get("Location"), tt.claims)
+			if tt.badCode {
+				authCode = "not-issued"
+			}
+			if tt.badState {
+				state = "forged"
+			}
+
+			code, header, _ = server.get(t, "/user/login/sso/callback?"+url.Values{"code": {authCode}, "state": {state}}.Encode())
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+
+			if tt.wantFlash != "" {
+				_, _, body := server.get(t, tt.wantLocation)
+				assert.StringContains(t, body, tt.wantFlash)
+			}
+
+			if tt.wantAccount != "" {
+				code, _, body := server.get(t, "/account/view")
+				assert.Equal(t, code, http.StatusOK)
+				assert.StringContains(t, body, tt.wantAccount)
+			}
+		})
+	}
+}
+
+func TestSSONotConfigured(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	code, _, _ := server.get(t, "/user/login/sso")
+	assert.Equal(t, code, http.StatusNotFound)
+}
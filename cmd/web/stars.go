@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"go-webserver/internal/models"
+)
+
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.stars.Star(snippet.Id, app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+}
+
+func (app *application) snippetUnstarPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.visibleSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.stars.Unstar(snippet.Id, app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, snippetURL(snippet), http.StatusSeeOther)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSnippetStar(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	_, _, body := server.get(t, "/snippet/view/snippet-go")
+	assert.StringContains(t, body, "1 star")
+
+	server.login(t, "mod@example.com", "pa$$word")
+	_, _, body = server.get(t, "/snippet/view/snippet-go")
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, headers, _ := server.postForm(t, "/snippet/star/snippet-go", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/view/snippet-go")
+
+	// starring twice still counts once
+	server.postForm(t, "/snippet/star/snippet-go", form)
+	_, _, body = server.get(t, "/snippet/view/snippet-go")
+	assert.StringContains(t, body, "2 stars")
+	assert.StringContains(t, body, "action='/snippet/unstar/snippet-go'")
+
+	code, _, _ = server.postForm(t, "/snippet/unstar/snippet-go", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	_, _, body = server.get(t, "/snippet/view/snippet-go")
+	assert.StringContains(t, body, "1 star")
+
+	// members only snippets can't be starred by outsiders
+	code, _, _ = server.postForm(t, "/snippet/star/snippet-org", form)
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestSnippetFork(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "mod@example.com", "pa$$word")
+	_, _, body := server.get(t, "/snippet/view/snippet-go")
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, headers, _ := server.postForm(t, "/snippet/fork/snippet-go", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/view/snippet-1234")
+
+	inserted := app.snippets.(*mocks.SnippetModel).Inserted
+	assert.Equal(t, len(inserted), 1)
+	assert.Equal(t, inserted[0].ParentId, "snippet-go")
+	assert.Equal(t, inserted[0].UserId, 2)
+	assert.Equal(t, inserted[0].Title, "Hello world")
+
+	code, _, _ = server.postForm(t, "/snippet/fork/snippet-404", form)
+	assert.Equal(t, code, http.StatusNotFound)
+}
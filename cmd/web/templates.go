@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/base64"
+	"fmt"
+	"go-webserver/internal/formatter"
 	"go-webserver/internal/models"
 	"go-webserver/ui"
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -16,8 +20,65 @@ type templateData struct {
 	Form            any
 	Flash           string
 	IsAuthenticated bool
+	Role            models.Role
+	Roles           []models.Role
 	CSRFToken       string
 	User            models.UsersNoPassword
+	Languages       []string
+	Collection      models.Collection
+	Collections     []models.Collection
+	Stars           int
+	Starred         bool
+	AuthorStats     models.AuthorStats
+	Org             models.Org
+	Orgs            []models.Org
+	OrgMembers      []models.OrgMember
+	OrgRoles        []models.OrgRole
+	Invitation      models.OrgInvitation
+	Invitations     []models.OrgInvitation
+	AuditEvents     []models.AuditEvent
+	AuditEvent      string
+	AuditEventKinds []string
+	InviteCodes     []models.InviteCode
+	InviteCode      string
+	InviteURL       string
+	SignupMode      string
+	APITokens       []models.APIToken
+	APIToken        string
+	APIScopes       []string
+	TokenLifetimes  []int
+	IsOwner         bool
+	Reports         []models.Report
+	Decisions       []models.ModerationDecision
+	ReportReasons   []string
+	Formatted       string
+	FormatError     *formatter.Error
+	Stats           models.Stats
+	Users           []models.UsersNoPassword
+	Query           string
+	Exports         []models.AccountExport
+	TOTPSecret      string
+	RecoveryCodes   []string
+	CodesLeft       int
+	RoleSettings    []models.RoleSetting
+	Passkeys        []models.Passkey
+	SSOName         string
+	Sessions        []models.Session
+	SessionId       int
+}
+
+type sourceLine struct {
+	Number int
+	Text   string
+}
+
+// numberedLines splits content so templates can print line numbers next to it.
+func numberedLines(content string) []sourceLine {
+	var lines []sourceLine
+	for i, text := range strings.Split(content, "\n") {
+		lines = append(lines, sourceLine{Number: i + 1, Text: text})
+	}
+	return lines
 }
 
 func humanDate(time time.Time) string {
@@ -28,8 +89,43 @@ func humanDate(time time.Time) string {
 	return time.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// humanBytes prints a byte count with a binary unit, e.g. 80.0 KiB.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// snippetURL returns the canonical address of a snippet.
+func snippetURL(snippet models.Snippet) string {
+	if snippet.Slug != "" {
+		return "/s/" + snippet.Slug
+	}
+	return "/snippet/view/" + snippet.Id
+}
+
+// passkeyURL returns the address passkey actions are posted under, the raw
+// credential id doesn't fit in a path.
+func passkeyURL(passkey models.Passkey) string {
+	return "/account/passkeys/" + base64.RawURLEncoding.EncodeToString(passkey.Id)
+}
+
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"snippetURL":     snippetURL,
+	"passkeyURL":     passkeyURL,
+	"humanDate":      humanDate,
+	"humanBytes":     humanBytes,
+	"auditLabel":     auditLabel,
+	"describeDevice": describeDevice,
+	"formattable":    formatter.Supports,
+	"numberedLines":  numberedLines,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -2,7 +2,12 @@ package main
 
 import (
 	"bytes"
+	"go-webserver/internal/mailer"
 	"go-webserver/internal/models/mocks"
+	"go-webserver/internal/passwords"
+	"go-webserver/internal/secrets"
+	"go-webserver/internal/tokens"
+	"go-webserver/ui"
 	"html"
 	"io"
 	"log/slog"
@@ -11,11 +16,13 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
 type testServer struct {
@@ -54,16 +61,50 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = time.Hour * 12
 	sessionManager.Cookie.Secure = true
 
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          "snippetbox.test",
+		RPDisplayName: "Snippetbox",
+		RPOrigins:     []string{"https://snippetbox.test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	return &application{
-		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
-		snippets:       &mocks.SnippetModel{},
-		users:          &mocks.UserModel{},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		snippets:        &mocks.SnippetModel{},
+		users:           &mocks.UserModel{},
+		collections:     &mocks.CollectionModel{},
+		stars:           &mocks.StarModel{},
+		orgs:            &mocks.OrgModel{},
+		audits:          &mocks.AuditModel{},
+		invites:         &mocks.InviteModel{},
+		apiTokens:       &mocks.APITokenModel{},
+		reports:         &mocks.ReportModel{},
+		stats:           &mocks.StatsModel{},
+		exports:         &mocks.ExportModel{},
+		passkeys:        &mocks.PasskeyModel{},
+		throttle:        &mocks.LoginThrottleModel{},
+		sessions:        &mocks.SessionModel{},
+		templateCache:   templateCache,
+		formDecoder:     formDecoder,
+		sessionManager:  sessionManager,
+		secretScanner:   secrets.NewScanner(secrets.DefaultRules()...),
+		passwordChecker: newTestPasswordChecker(t),
+		mailer:          mailer.New(&mailer.Memory{}, "test@snippetbox.local", ui.Files),
+		signer:          tokens.NewSigner([]byte("test-secret-key")),
+		webAuthn:        webAuthn,
+		baseURL:         "https://snippetbox.test",
+		signupMode:      signupOpen,
 	}
 }
 
+// newTestPasswordChecker treats "Tr0ub4dor&3" as breached.
+func newTestPasswordChecker(t *testing.T) *passwords.Checker {
+	const list = "874572E7A5AE6A49466A6AC578B98ADBA78C6AA6:4051\n"
+	return &passwords.Checker{Breached: passwords.NewBreachList(strings.NewReader(list), int64(len(list)))}
+}
+
 func newTestServer(t *testing.T, h http.Handler) *testServer {
 	server := httptest.NewTLSServer(h)
 	// make a new cookie jar
@@ -115,3 +156,26 @@ func (server *testServer) postForm(t *testing.T, urlPath string, form url.Values
 	// Return the response status, headers and body.w
 	return res.StatusCode, res.Header, string(body)
 }
+
+// login fetches a fresh CSRF token and signs in through the login form, so the
+// session cookie in the client jar is authenticated for the following requests.
+func (server *testServer) login(t *testing.T, email, password string) {
+	_, _, body := server.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := server.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login as %s failed with status %d", email, code)
+	}
+}
+
+// useOutbox swaps the test mailer for one whose messages can be inspected.
+func useOutbox(app *application) *mailer.Memory {
+	outbox := &mailer.Memory{}
+	app.mailer = mailer.New(outbox, "test@snippetbox.local", ui.Files)
+	return outbox
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-webserver/internal/models"
+)
+
+// Failed logins are counted per client IP and per email address, and wrong
+// two-factor codes per user. After a few free tries every failure doubles the
+// wait before the next attempt, and an account with too many failures is
+// locked for a while. Password reset requests are counted the same way,
+// without the lock.
+const (
+	loginFreeFailures  = 3
+	loginBaseDelay     = time.Second
+	loginMaxDelay      = 15 * time.Minute
+	loginLockFailures  = 10
+	loginLockDuration  = time.Hour
+	loginFailureWindow = 24 * time.Hour
+)
+
+func loginKeys(r *http.Request, email string) (string, string) {
+	return "ip:" + clientIP(r), "email:" + models.NormalizeEmail(email)
+}
+
+// resetKeys count every password reset request, whether or not the address
+// has an account, so the answer can't tell them apart.
+func resetKeys(r *http.Request, email string) (string, string) {
+	return "reset-ip:" + clientIP(r), "reset-email:" + strings.ToLower(email)
+}
+
+func totpKey(id int) string {
+	return "totp:" + strconv.Itoa(id)
+}
+
+// lockable reports whether failures for key lock an account rather than just
+// slow the client down.
+func lockable(key string) bool {
+	return strings.HasPrefix(key, "email:") || strings.HasPrefix(key, "totp:")
+}
+
+// loginDelay is how long after its last failure a key has to wait before the
+// next login attempt, and whether that is because the account is locked.
+func loginDelay(attempts models.LoginAttempts) (time.Duration, bool) {
+	if time.Since(attempts.LastFailure) > loginFailureWindow {
+		return 0, false
+	}
+
+	if lockable(attempts.Key) && attempts.Failures >= loginLockFailures {
+		return loginLockDuration, true
+	}
+
+	if attempts.Failures < loginFreeFailures {
+		return 0, false
+	}
+	delay := loginMaxDelay
+	if shift := attempts.Failures - loginFreeFailures; shift < 20 {
+		delay = min(loginBaseDelay<<shift, loginMaxDelay)
+	}
+	return delay, false
+}
+
+// loginReserve counts the attempt as a failure for the client IP and the
+// email address before the password is checked, loginSucceeded takes it back
+// again. It returns how long the client has to wait before trying to log in as
+// email, zero means go ahead.
+func (app *application) loginReserve(r *http.Request, email string) (time.Duration, bool, error) {
+	ipKey, emailKey := loginKeys(r, email)
+	return app.reserveAttempt(ipKey, emailKey)
+}
+
+// reserveAttempt counts a failure for each key up front and returns how long
+// the client has to wait, and whether that is because the account is locked.
+// Parallel requests that all saw the same count each get their own failure
+// this way, and once the delays have kicked in only the first of them is let
+// through.
+func (app *application) reserveAttempt(keys ...string) (time.Duration, bool, error) {
+	all, err := app.throttle.Get(keys...)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var wait time.Duration
+	var locked bool
+	seen := make(map[string]int)
+	for _, attempts := range all {
+		seen[attempts.Key] = attempts.Failures
+		delay, lock := loginDelay(attempts)
+		left := time.Until(attempts.LastFailure.Add(delay))
+		if left <= 0 {
+			continue
+		}
+		wait = max(wait, left)
+		locked = locked || lock
+	}
+	if wait > 0 {
+		return wait, locked, nil
+	}
+
+	for _, key := range keys {
+		reserved, err := app.throttle.Fail(key, loginFailureWindow)
+		if err != nil {
+			return 0, false, err
+		}
+		if reserved.Failures <= seen[key]+1 {
+			continue
+		}
+
+		// Another attempt got its failure in since Get, it counts as having
+		// just happened.
+		delay, lock := loginDelay(models.LoginAttempts{Key: key, Failures: reserved.Failures - 1, LastFailure: reserved.LastFailure})
+		wait = max(wait, delay)
+		locked = locked || lock
+	}
+	return wait, locked, nil
+}
+
+// loginFailed keeps the failure loginReserve counted. The owner of the account
+// hears about it when the failures lock their account.
+func (app *application) loginFailed(r *http.Request, email string) error {
+	_, emailKey := loginKeys(r, email)
+
+	locked, err := app.lockedNow(emailKey)
+	if err != nil || !locked {
+		return err
+	}
+
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			// there is no account, so nobody to tell
+			return nil
+		}
+		return err
+	}
+
+	app.sendLockoutEmail(r, user)
+	return nil
+}
+
+// totpFailed keeps the failure the second login step reserved, and tells the
+// user when it locks their account.
+func (app *application) totpFailed(r *http.Request, id int) error {
+	locked, err := app.lockedNow(totpKey(id))
+	if err != nil || !locked {
+		return err
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		return err
+	}
+
+	app.sendLockoutEmail(r, user)
+	return nil
+}
+
+// lockedNow reports whether the last failure counted for key is the one that
+// locked the account.
+func (app *application) lockedNow(key string) (bool, error) {
+	all, err := app.throttle.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return len(all) > 0 && all[0].Failures == loginLockFailures, nil
+}
+
+func (app *application) sendLockoutEmail(r *http.Request, user models.UsersNoPassword) {
+	data := map[string]any{
+		"Name":     user.Name,
+		"Failures": loginLockFailures,
+		"Locked":   "1 hour",
+		"IP":       clientIP(r),
+		"URL":      app.baseURL + "/user/password/forgot",
+	}
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "email/lockout.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error(), "email", user.Email)
+		}
+	})
+}
+
+// loginSucceeded clears the failures of the email address. The client IP only
+// gets back the failure loginReserve counted, or a single account the client
+// can log in to would let it reset the count for every other one.
+func (app *application) loginSucceeded(r *http.Request, email string) error {
+	ipKey, emailKey := loginKeys(r, email)
+
+	err := app.throttle.Release(ipKey)
+	if err != nil {
+		return err
+	}
+	return app.throttle.Reset(emailKey)
+}
+
+// loginReleased takes back the failures loginReserve counted, for attempts
+// that had the right password but were refused anyway.
+func (app *application) loginReleased(r *http.Request, email string) error {
+	ipKey, emailKey := loginKeys(r, email)
+
+	err := app.throttle.Release(ipKey)
+	if err != nil {
+		return err
+	}
+	return app.throttle.Release(emailKey)
+}
+
+// purgeLoginAttempts forgets failures that are too old to count any more.
+func (app *application) purgeLoginAttempts() {
+	err := app.throttle.Purge(loginFailureWindow)
+	if err != nil {
+		app.logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models"
+	"go-webserver/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   models.LoginAttempts
+		wantDelay  time.Duration
+		wantLocked bool
+	}{
+		{
+			name:     "Free failures",
+			attempts: models.LoginAttempts{Key: "ip:127.0.0.1", Failures: 2, LastFailure: time.Now()},
+		},
+		{
+			name:      "First delay",
+			attempts:  models.LoginAttempts{Key: "ip:127.0.0.1", Failures: 3, LastFailure: time.Now()},
+			wantDelay: time.Second,
+		},
+		{
+			name:      "Doubled",
+			attempts:  models.LoginAttempts{Key: "email:alice@example.com", Failures: 6, LastFailure: time.Now()},
+			wantDelay: 8 * time.Second,
+		},
+		{
+			name:      "Capped",
+			attempts:  models.LoginAttempts{Key: "ip:127.0.0.1", Failures: 500, LastFailure: time.Now()},
+			wantDelay: loginMaxDelay,
+		},
+		{
+			name:       "Locked account",
+			attempts:   models.LoginAttempts{Key: "email:alice@example.com", Failures: 10, LastFailure: time.Now()},
+			wantDelay:  loginLockDuration,
+			wantLocked: true,
+		},
+		{
+			name:     "Old failures",
+			attempts: models.LoginAttempts{Key: "email:alice@example.com", Failures: 10, LastFailure: time.Now().Add(-25 * time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, locked := loginDelay(tt.attempts)
+			assert.Equal(t, delay, tt.wantDelay)
+			assert.Equal(t, locked, tt.wantLocked)
+		})
+	}
+}
+
+func postLogin(t *testing.T, server *testServer, email, password string) (int, http.Header, string) {
+	_, _, body := server.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	return server.postForm(t, "/user/login", form)
+}
+
+func TestLoginThrottling(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	for i := 0; i < loginFreeFailures; i++ {
+		code, _, _ := postLogin(t, server, "alice@example.com", "wrong")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	code, header, body := postLogin(t, server, "alice@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, header.Get("Retry-After"), "1")
+	assert.StringContains(t, body, "Too many failed logins")
+}
+
+func TestLoginThrottlingParallel(t *testing.T) {
+	app := newTestApplication(t)
+	throttle := &mocks.LoginThrottleModel{}
+	app.throttle = throttle
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	// one free failure left, however many guesses arrive at once
+	throttle.Set(models.LoginAttempts{Key: "email:alice@example.com", Failures: loginFreeFailures - 1, LastFailure: time.Now()})
+
+	_, _, body := server.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i], _, _ = server.postForm(t, "/user/login", form)
+		}()
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, code := range codes {
+		if code == http.StatusUnprocessableEntity {
+			checked++
+		} else {
+			assert.Equal(t, code, http.StatusTooManyRequests)
+		}
+	}
+	assert.Equal(t, checked, 1)
+}
+
+func TestAccountLockout(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := useOutbox(app)
+	throttle := &mocks.LoginThrottleModel{}
+	app.throttle = throttle
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	// one failure short of the lock, long enough ago to be allowed to try
+	throttle.Set(models.LoginAttempts{Key: "email:alice@example.com", Failures: loginLockFailures - 1, LastFailure: time.Now().Add(-time.Hour)})
+
+	// the address counts however it is typed
+	code, _, _ := postLogin(t, server, "Alice@Example.com", "wrong")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	app.wg.Wait()
+	messages := outbox.Messages("alice@example.com")
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].Subject, "Your Snippetbox account has been locked")
+
+	code, _, body := postLogin(t, server, "alice@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.StringContains(t, body, "This account is locked")
+
+	// other accounts can still log in from the same address
+	code, _, _ = postLogin(t, server, "mod@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusSeeOther)
+}
+
+func TestLoginResetsFailures(t *testing.T) {
+	app := newTestApplication(t)
+	throttle := &mocks.LoginThrottleModel{}
+	app.throttle = throttle
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	throttle.Set(models.LoginAttempts{Key: "email:alice@example.com", Failures: 2, LastFailure: time.Now()})
+
+	code, _, _ := postLogin(t, server, "alice@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	attempts, _ := throttle.Get("email:alice@example.com")
+	assert.Equal(t, len(attempts), 0)
+
+	// the client IP gets back the failure counted while checking the password
+	attempts, _ = throttle.Get("ip:127.0.0.1")
+	assert.Equal(t, len(attempts), 1)
+	assert.Equal(t, attempts[0].Failures, 0)
+}
+
+func TestPasswordForgotThrottling(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := useOutbox(app)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	_, _, body := server.get(t, "/user/password/forgot")
+
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		form := url.Values{}
+		form.Add("email", email)
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		for i := 0; i < loginFreeFailures; i++ {
+			code, _, _ := server.postForm(t, "/user/password/forgot", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+		}
+
+		// known and unknown addresses are held back alike
+		code, header, body := server.postForm(t, "/user/password/forgot", form)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.Equal(t, header.Get("Retry-After"), "1")
+		assert.StringContains(t, body, "Too many reset requests")
+
+		// a different client IP can't get around it either
+		app.throttle.(*mocks.LoginThrottleModel).Reset("reset-ip:127.0.0.1")
+		code, _, _ = server.postForm(t, "/user/password/forgot", form)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		app.throttle.(*mocks.LoginThrottleModel).Reset("reset-ip:127.0.0.1")
+	}
+
+	app.wg.Wait()
+	assert.Equal(t, len(outbox.Messages("alice@example.com")), loginFreeFailures)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/totp"
+	"go-webserver/internal/validator"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// maxTOTPAttempts is how many wrong codes the second login step takes before
+// the user has to enter their password again.
+const maxTOTPAttempts = 5
+
+var totpCodeRX = regexp.MustCompile(`^\d{6}$`)
+
+type twoFactorForm struct {
+	Code                string `form:"code"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	if app.sessionManager.GetInt(r.Context(), "passwordVerifiedUserId") == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	app.render(w, r, http.StatusOK, "login_2fa.tmpl.html", data)
+}
+
+// userLoginTOTPPost is the second login step. It takes either a code from the
+// authenticator app or one of the recovery codes.
+func (app *application) userLoginTOTPPost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "passwordVerifiedUserId")
+	if id == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	var ok bool
+	if form.Valid() {
+		// Wrong codes count against the account like wrong passwords, a new
+		// session doesn't get a fresh set of guesses.
+		wait, locked, err := app.reserveAttempt(totpKey(id))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if wait > 0 {
+			if locked {
+				form.AddNonFieldError("This account is locked after too many wrong codes, please try again later")
+			} else {
+				form.AddNonFieldError(fmt.Sprintf("Too many wrong codes, please wait %s and try again", wait.Round(time.Second)))
+			}
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusTooManyRequests, "login_2fa.tmpl.html", data)
+			return
+		}
+
+		if totpCodeRX.MatchString(form.Code) {
+			ok, err = app.users.ValidateTOTP(id, form.Code)
+		} else {
+			ok, err = app.users.UseRecoveryCode(id, form.Code)
+		}
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !ok {
+		if form.Valid() {
+			app.audit(r, models.AuditEvent{
+				Event:   models.AuditLoginFailed,
+				UserId:  id,
+				Details: map[string]string{"reason": "wrong two-factor code"},
+			})
+
+			err = app.totpFailed(r, id)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+
+		attempts := app.sessionManager.GetInt(r.Context(), "totpAttempts") + 1
+		if attempts >= maxTOTPAttempts {
+			app.sessionManager.Remove(r.Context(), "passwordVerifiedUserId")
+			app.sessionManager.Remove(r.Context(), "totpAttempts")
+			app.sessionManager.Put(r.Context(), "flash", "Too many wrong codes, please log in again.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "totpAttempts", attempts)
+
+		if form.Valid() {
+			form.AddFieldError("code", "This code is not valid")
+		}
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login_2fa.tmpl.html", data)
+		return
+	}
+
+	err = app.throttle.Reset(totpKey(id))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "passwordVerifiedUserId")
+	app.sessionManager.Remove(r.Context(), "totpAttempts")
+	app.completeLogin(w, r, id, "totp")
+}
+
+func (app *application) accountTOTP(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = twoFactorForm{}
+	app.renderTwoFactor(w, r, http.StatusOK, data)
+}
+
+// accountTOTPQR draws the enrollment QR code. It is generated here rather than
+// by a third party service so the secret never leaves the server.
+func (app *application) accountTOTPQR(w http.ResponseWriter, r *http.Request) {
+	secret := app.sessionManager.GetString(r.Context(), "totpSecret")
+	if secret == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserId"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	png, err := qrcode.Encode(totp.URI("Snippetbox", user.Email, secret), qrcode.Medium, 256)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+func (app *application) accountTOTPEnablePost(w http.ResponseWriter, r *http.Request) {
+	secret := app.sessionManager.GetString(r.Context(), "totpSecret")
+	if secret == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, ok := totp.Match(secret, form.Code, time.Now())
+	form.CheckField(ok, "code", "This code is not valid, check the time on your device and try again")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, data)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	codes, err := app.users.EnableTOTP(userId, secret)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "totpSecret")
+
+	app.audit(r, models.AuditEvent{Event: models.AuditTOTPEnable, UserId: userId})
+
+	// The codes are rendered straight away instead of going through the
+	// session, they are shown exactly once.
+	data := app.newTemplateData(r)
+	data.Flash = "Two-factor authentication is now on."
+	data.RecoveryCodes = codes
+	app.render(w, r, http.StatusOK, "recovery_codes.tmpl.html", data)
+}
+
+func (app *application) accountTOTPDisablePost(w http.ResponseWriter, r *http.Request) {
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.TOTPRequired {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Two-factor authentication is required for the %s role.", user.Role))
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.users.DisableTOTP(userId, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Password is incorrect")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditEvent{Event: models.AuditTOTPDisable, UserId: userId})
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is now off.")
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+func (app *application) accountRecoveryCodesPost(w http.ResponseWriter, r *http.Request) {
+	var form twoFactorForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	codes, err := app.users.RegenerateRecoveryCodes(userId, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Password is incorrect")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditEvent{
+		Event:   models.AuditTokenCreate,
+		UserId:  userId,
+		Details: map[string]string{"kind": "recovery codes"},
+	})
+
+	data := app.newTemplateData(r)
+	data.RecoveryCodes = codes
+	app.render(w, r, http.StatusOK, "recovery_codes.tmpl.html", data)
+}
+
+// renderTwoFactor shows the 2FA settings. Users without 2FA get a pending
+// secret in their session to enroll with.
+func (app *application) renderTwoFactor(w http.ResponseWriter, r *http.Request, status int, data templateData) {
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	var err error
+	data.User, err = app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if data.User.TOTPEnabled {
+		data.CodesLeft, err = app.users.RecoveryCodesLeft(userId)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		data.TOTPSecret = app.sessionManager.GetString(r.Context(), "totpSecret")
+		if data.TOTPSecret == "" {
+			data.TOTPSecret, err = totp.GenerateSecret()
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			app.sessionManager.Put(r.Context(), "totpSecret", data.TOTPSecret)
+		}
+	}
+
+	app.render(w, r, status, "twofactor.tmpl.html", data)
+}
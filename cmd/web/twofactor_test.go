@@ -0,0 +1,309 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"go-webserver/internal/models"
+	"go-webserver/internal/models/mocks"
+	"go-webserver/internal/totp"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var totpSecretRX = regexp.MustCompile(`<code>([A-Z2-7]{32})</code>`)
+
+func currentCode(t *testing.T, secret string) string {
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestLoginTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		wantCode int
+	}{
+		{
+			name:     "Authenticator code",
+			code:     "current",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Recovery code",
+			code:     mocks.RecoveryCode,
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Wrong code",
+			code:     "000000",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Blank code",
+			code:     "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			server := newTestServer(t, app.routes())
+			defer server.Close()
+
+			// the password alone only leads to the second step
+			_, _, body := server.get(t, "/user/login")
+			form := url.Values{}
+			form.Add("email", "totp@example.com")
+			form.Add("password", "pa$$word")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, header, _ := server.postForm(t, "/user/login", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login/2fa")
+
+			code, _, _ = server.get(t, "/account/view")
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			_, _, body = server.get(t, "/user/login/2fa")
+			form = url.Values{}
+			if tt.code == "current" {
+				form.Add("code", currentCode(t, mocks.TOTPSecret))
+			} else {
+				form.Add("code", tt.code)
+			}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ = server.postForm(t, "/user/login/2fa", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			code, _, _ = server.get(t, "/account/view")
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, code, http.StatusOK)
+			} else {
+				assert.Equal(t, code, http.StatusSeeOther)
+			}
+		})
+	}
+}
+
+func TestLoginTOTPAttempts(t *testing.T) {
+	app := newTestApplication(t)
+	throttle := &mocks.LoginThrottleModel{}
+	app.throttle = throttle
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	_, _, body := server.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", "totp@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	server.postForm(t, "/user/login", form)
+
+	_, _, body = server.get(t, "/user/login/2fa")
+	form = url.Values{}
+	form.Add("code", "000000")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	// the account wide delays are tested below, this is about the session
+	for range maxTOTPAttempts - 1 {
+		code, _, _ := server.postForm(t, "/user/login/2fa", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		throttle.Reset(totpKey(7))
+	}
+
+	code, header, _ := server.postForm(t, "/user/login/2fa", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	// the password step has to be repeated now
+	code, header, _ = server.get(t, "/user/login/2fa")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+}
+
+func TestLoginTOTPLockout(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := useOutbox(app)
+	throttle := &mocks.LoginThrottleModel{}
+	app.throttle = throttle
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	// one wrong code short of the lock, long enough ago to be allowed to try
+	throttle.Set(models.LoginAttempts{Key: totpKey(7), Failures: loginLockFailures - 1, LastFailure: time.Now().Add(-time.Hour)})
+
+	secondStep := func(code string) (int, string) {
+		_, _, body := server.get(t, "/user/login")
+		form := url.Values{}
+		form.Add("email", "totp@example.com")
+		form.Add("password", "pa$$word")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		server.postForm(t, "/user/login", form)
+
+		_, _, body = server.get(t, "/user/login/2fa")
+		form = url.Values{}
+		form.Add("code", code)
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		status, _, body := server.postForm(t, "/user/login/2fa", form)
+		return status, body
+	}
+
+	code, _ := secondStep("000000")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	app.wg.Wait()
+	messages := outbox.Messages("totp@example.com")
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].Subject, "Your Snippetbox account has been locked")
+
+	// starting over with the password doesn't help, not even with the right code
+	code, body := secondStep(currentCode(t, mocks.TOTPSecret))
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.StringContains(t, body, "This account is locked")
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+	matches := totpSecretRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no totp secret found in body")
+	}
+	secret := matches[1]
+	validCSRFToken := extractCSRFToken(t, body)
+
+	code, header, _ := server.get(t, "/account/2fa/qr.png")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "image/png")
+
+	form := url.Values{}
+	form.Add("code", "000000")
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ = server.postForm(t, "/account/2fa/enable", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	form.Set("code", currentCode(t, secret))
+	code, _, body = server.postForm(t, "/account/2fa/enable", form)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<code>code0-mock0</code>")
+	assert.Equal(t, strings.Join(app.audits.(*mocks.AuditModel).Recorded(), ","), "login,2fa_enable")
+
+	// the pending secret is gone once enrollment is done
+	code, _, _ = server.get(t, "/account/2fa/qr.png")
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestTOTPSettings(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "totp@example.com", "pa$$word")
+	_, _, body := server.get(t, "/user/login/2fa")
+	form := url.Values{}
+	form.Add("code", mocks.RecoveryCode)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	server.postForm(t, "/user/login/2fa", form)
+
+	code, _, body := server.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "You have 7 unused recovery codes")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		password string
+		wantCode int
+	}{
+		{
+			name:     "Regenerate with wrong password",
+			urlPath:  "/account/2fa/recovery-codes",
+			password: "wrongPa$$word",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Regenerate",
+			urlPath:  "/account/2fa/recovery-codes",
+			password: "pa$$word",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Disable with wrong password",
+			urlPath:  "/account/2fa/disable",
+			password: "wrongPa$$word",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Disable",
+			urlPath:  "/account/2fa/disable",
+			password: "pa$$word",
+			wantCode: http.StatusSeeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("password", tt.password)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := server.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestTOTPRequiredForRole(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "enroll@example.com", "pa$$word")
+
+	code, header, _ := server.get(t, "/moderation")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/2fa")
+
+	code, _, _ = server.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+}
+
+func TestAdminRoleTOTP(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "admin@example.com", "pa$$word")
+
+	_, _, body := server.get(t, "/admin")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("requireTOTP", "true")
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ := server.postForm(t, "/admin/roles/moderator/2fa", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	code, _, _ = server.postForm(t, "/admin/roles/owner/2fa", form)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	_, _, body = server.get(t, "/admin")
+	assert.StringContains(t, body, "<td>moderator</td>\n        <td>Yes</td>")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-webserver/internal/models"
+	"go-webserver/internal/tokens"
+)
+
+const (
+	verifyEmailPurpose = "verify-email"
+	verifyEmailTTL     = 48 * time.Hour
+
+	// verificationResendInterval is how long a user has to wait before asking
+	// for another verification email.
+	verificationResendInterval = time.Minute
+)
+
+// sendVerificationEmail mails a signed link that verifies email for the user
+// with the given id. Delivery happens in the background so a slow mail server
+// does not hold up the response.
+func (app *application) sendVerificationEmail(id int, name, email string) {
+	subject := strconv.Itoa(id) + " " + email
+
+	data := map[string]any{
+		"Name":  name,
+		"URL":   app.baseURL + "/user/verify/" + app.signer.Sign(verifyEmailPurpose, subject, verifyEmailTTL),
+		"Valid": "48 hours",
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(email, "email/verify.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error(), "email", email)
+		}
+	})
+}
+
+func (app *application) accountVerify(w http.ResponseWriter, r *http.Request) {
+	if app.isVerified(r) {
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	app.render(w, r, http.StatusOK, "verify.tmpl.html", data)
+}
+
+func (app *application) accountVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	userId := app.sessionManager.GetInt(r.Context(), "authenticatedUserId")
+
+	user, err := app.users.Get(userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Verified {
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	ok, err := app.users.ClaimVerificationEmail(userId, verificationResendInterval)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !ok {
+		data := app.newTemplateData(r)
+		data.Flash = "We just sent you an email, please wait a minute before asking for another one."
+		app.render(w, r, http.StatusTooManyRequests, "verify.tmpl.html", data)
+		return
+	}
+
+	app.sendVerificationEmail(user.Id, user.Name, user.Email)
+
+	app.sessionManager.Put(r.Context(), "flash", "We sent you a new verification email.")
+	http.Redirect(w, r, "/account/verify", http.StatusSeeOther)
+}
+
+// parseVerifySubject splits the subject of a verification link back into the
+// user id and the email address it was sent to.
+func parseVerifySubject(subject string) (int, string, error) {
+	idStr, email, ok := strings.Cut(subject, " ")
+	if !ok {
+		return 0, "", tokens.ErrInvalid
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, "", tokens.ErrInvalid
+	}
+	return id, email, nil
+}
+
+// userVerify does not require a login, the link may well be opened in a
+// different browser than the one used to sign up. The link only counts while
+// the account still has the address it was sent to.
+func (app *application) userVerify(w http.ResponseWriter, r *http.Request) {
+	subject, err := app.signer.Verify(r.PathValue("token"), verifyEmailPurpose)
+	if err == nil {
+		var id int
+		var email string
+		id, email, err = parseVerifySubject(subject)
+		if err == nil {
+			err = app.users.Verify(id, email)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, tokens.ErrInvalid) || errors.Is(err, tokens.ErrExpired) || errors.Is(err, models.ErrNoRecord) {
+			data := app.newTemplateData(r)
+			data.Flash = "This verification link is invalid or has expired."
+			app.render(w, r, http.StatusBadRequest, "verify.tmpl.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been verified.")
+	if app.isAuthenticated(r) {
+		http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
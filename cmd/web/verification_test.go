@@ -0,0 +1,150 @@
+package main
+
+import (
+	"go-webserver/internal/assert"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var verifyLinkRX = regexp.MustCompile(`https://snippetbox\.test(/user/verify/\S+)`)
+
+func TestSignupSendsVerificationEmail(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := useOutbox(app)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	_, _, body := server.get(t, "/user/signup")
+
+	form := url.Values{}
+	form.Add("name", "Bob")
+	form.Add("username", "bob")
+	form.Add("email", "bob@example.com")
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := server.postForm(t, "/user/signup", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	app.wg.Wait()
+
+	messages := outbox.Messages("bob@example.com")
+	assert.Equal(t, len(messages), 1)
+	assert.StringContains(t, messages[0].Subject, "Verify your Snippetbox email address")
+	assert.StringContains(t, messages[0].Body, "Hi Bob,")
+	assert.Equal(t, len(verifyLinkRX.FindStringSubmatch(messages[0].Body)), 2)
+}
+
+func TestUserVerify(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Valid token",
+			token:    app.signer.Sign(verifyEmailPurpose, "6 unverified@example.com", time.Hour),
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Expired token",
+			token:    app.signer.Sign(verifyEmailPurpose, "6 unverified@example.com", -time.Hour),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Token for another purpose",
+			token:    app.signer.Sign("reset-password", "6 unverified@example.com", time.Hour),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Unknown email",
+			token:    app.signer.Sign(verifyEmailPurpose, "6 nobody@example.com", time.Hour),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Address now held by another account",
+			token:    app.signer.Sign(verifyEmailPurpose, "6 alice@example.com", time.Hour),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "No user id",
+			token:    app.signer.Sign(verifyEmailPurpose, "unverified@example.com", time.Hour),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Garbage",
+			token:    "abc.def",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := server.get(t, "/user/verify/"+tt.token)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusBadRequest {
+				assert.StringContains(t, body, "invalid or has expired")
+			}
+		})
+	}
+}
+
+func TestRequireVerified(t *testing.T) {
+	app := newTestApplication(t)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "unverified@example.com", "pa$$word")
+
+	for _, urlPath := range []string{"/snippet/create", "/org/create", "/orgs/invitation/valid-org-token"} {
+		code, header, _ := server.get(t, urlPath)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/verify")
+	}
+
+	code, _, _ := server.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+}
+
+func TestVerificationResend(t *testing.T) {
+	app := newTestApplication(t)
+	outbox := useOutbox(app)
+	server := newTestServer(t, app.routes())
+	defer server.Close()
+
+	server.login(t, "unverified@example.com", "pa$$word")
+
+	code, _, body := server.get(t, "/account/verify")
+	assert.Equal(t, code, http.StatusOK)
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ = server.postForm(t, "/account/verify/resend", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	code, _, body = server.postForm(t, "/account/verify/resend", form)
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.StringContains(t, body, "please wait a minute")
+
+	app.wg.Wait()
+	assert.Equal(t, len(outbox.Messages("unverified@example.com")), 1)
+
+	t.Run("Already verified", func(t *testing.T) {
+		server := newTestServer(t, app.routes())
+		defer server.Close()
+
+		server.login(t, "alice@example.com", "pa$$word")
+
+		code, header, _ := server.get(t, "/account/verify")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/view")
+	})
+}
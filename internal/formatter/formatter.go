@@ -0,0 +1,89 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"strings"
+)
+
+var ErrUnsupported = errors.New("formatter: language cannot be formatted")
+
+// Error is a parse error reported back to the author. Line and Column are
+// 1-based, Column is 0 when unknown.
+type Error struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+var formatters = map[string]func(string) (string, error){
+	"go":   formatGo,
+	"json": formatJSON,
+	"sql":  formatSQL,
+}
+
+func Supports(language string) bool {
+	_, ok := formatters[language]
+	return ok
+}
+
+// Format returns src formatted according to language. Syntax problems are
+// returned as *Error so the caller can point at the offending line.
+func Format(language, src string) (string, error) {
+	f, ok := formatters[language]
+	if !ok {
+		return "", ErrUnsupported
+	}
+	return f(src)
+}
+
+func formatGo(src string) (string, error) {
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		var list scanner.ErrorList
+		if errors.As(err, &list) && len(list) > 0 {
+			return "", &Error{Line: list[0].Pos.Line, Column: list[0].Pos.Column, Msg: list[0].Msg}
+		}
+		return "", &Error{Line: 1, Msg: err.Error()}
+	}
+	return string(out), nil
+}
+
+func formatJSON(src string) (string, error) {
+	trimmed := strings.TrimSpace(src)
+	leading := strings.Index(src, trimmed)
+
+	var buf bytes.Buffer
+	err := json.Indent(&buf, []byte(trimmed), "", "  ")
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, column := position(src, leading+int(syntaxErr.Offset))
+			return "", &Error{Line: line, Column: column, Msg: syntaxErr.Error()}
+		}
+		return "", &Error{Line: 1, Msg: err.Error()}
+	}
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(src string, offset int) (int, int) {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	line := 1 + strings.Count(src[:offset], "\n")
+	column := offset - strings.LastIndex(src[:offset], "\n")
+	return line, column
+}
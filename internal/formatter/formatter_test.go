@@ -0,0 +1,108 @@
+package formatter
+
+import (
+	"errors"
+	"go-webserver/internal/assert"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		src      string
+		want     string
+	}{
+		{
+			name:     "Go",
+			language: "go",
+			src:      "package main\nfunc main(){\nfmt.Println( \"hi\" )\n}",
+			want:     "package main\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+		},
+		{
+			name:     "JSON",
+			language: "json",
+			src:      `{"id":1,"tags":["a","b"]}`,
+			want:     "{\n  \"id\": 1,\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n}\n",
+		},
+		{
+			name:     "SQL",
+			language: "sql",
+			src:      "select id, title from snippets where expires > current_timestamp and id = @id order by created_at desc",
+			want:     "SELECT id,\n  title\nFROM snippets\nWHERE expires > current_timestamp\n  AND id = @id\nORDER BY created_at DESC\n",
+		},
+		{
+			name:     "SQL subquery",
+			language: "sql",
+			src:      "select count(*) from (select * from users where id in (1, 2)) u;",
+			want:     "SELECT count(*)\nFROM (\n  SELECT *\n  FROM users\n  WHERE id IN (1, 2)) u;\n",
+		},
+		{
+			name:     "SQL row lock",
+			language: "sql",
+			src:      "select id from collections where id = @id for update",
+			want:     "SELECT id\nFROM collections\nWHERE id = @id FOR UPDATE\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.language, tt.src)
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		src      string
+		wantLine int
+	}{
+		{
+			name:     "Go",
+			language: "go",
+			src:      "package main\n\nfunc main() {\n\tx :=\n}\n",
+			wantLine: 5,
+		},
+		{
+			name:     "JSON",
+			language: "json",
+			src:      "{\n  \"id\": 1,\n  \"title\" \"missing colon\"\n}",
+			wantLine: 3,
+		},
+		{
+			name:     "SQL unterminated string",
+			language: "sql",
+			src:      "SELECT *\nFROM users\nWHERE name = 'alice",
+			wantLine: 3,
+		},
+		{
+			name:     "SQL unbalanced parenthesis",
+			language: "sql",
+			src:      "SELECT *\nFROM users\nWHERE id IN (1, 2))",
+			wantLine: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Format(tt.language, tt.src)
+
+			var fmtErr *Error
+			if !errors.As(err, &fmtErr) {
+				t.Fatalf("got: %v; want *formatter.Error", err)
+			}
+			assert.Equal(t, fmtErr.Line, tt.wantLine)
+		})
+	}
+}
+
+func TestFormatUnsupported(t *testing.T) {
+	_, err := Format("text", "hello")
+	assert.Equal(t, errors.Is(err, ErrUnsupported), true)
+	assert.Equal(t, Supports("text"), false)
+	assert.Equal(t, Supports("go"), true)
+}
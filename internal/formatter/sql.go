@@ -0,0 +1,275 @@
+package formatter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The SQL formatter is deliberately simple: it upper-cases keywords, starts
+// each clause on its own line and indents nested queries. It only rejects
+// input it cannot tokenize, it is not a SQL parser.
+
+var sqlKeywords = map[string]bool{
+	"ADD": true, "ALL": true, "ALTER": true, "AND": true, "AS": true, "ASC": true,
+	"BETWEEN": true, "BY": true, "CASE": true, "CONFLICT": true, "CONSTRAINT": true,
+	"CREATE": true, "CROSS": true, "DEFAULT": true, "DELETE": true, "DESC": true,
+	"DISTINCT": true, "DO": true, "DROP": true, "ELSE": true, "END": true, "EXISTS": true,
+	"FALSE": true, "FOR": true, "FOREIGN": true, "FROM": true, "FULL": true, "GROUP": true,
+	"HAVING": true, "IF": true, "IN": true, "INDEX": true, "INNER": true, "INSERT": true,
+	"INTERVAL": true, "INTO": true, "IS": true, "JOIN": true, "KEY": true, "LEFT": true,
+	"LIKE": true, "ILIKE": true, "LIMIT": true, "NOT": true, "NOTHING": true, "NULL": true,
+	"OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true, "PRIMARY": true,
+	"REFERENCES": true, "RETURNING": true, "RIGHT": true, "SELECT": true, "SET": true,
+	"TABLE": true, "THEN": true, "TRUE": true, "UNION": true, "UNIQUE": true,
+	"UPDATE": true, "USING": true, "VALUES": true, "WHEN": true, "WHERE": true, "WITH": true,
+}
+
+// clauses start on a new line. The value lists the keywords which, when they
+// directly precede the clause keyword, keep it on the same line.
+var sqlClauses = map[string][]string{
+	"SELECT":    {"UNION", "ALL", "INSERT"},
+	"FROM":      {"DELETE", "DISTINCT"},
+	"WHERE":     nil,
+	"GROUP":     nil,
+	"ORDER":     nil,
+	"HAVING":    nil,
+	"LIMIT":     nil,
+	"OFFSET":    nil,
+	"UNION":     nil,
+	"INSERT":    nil,
+	"VALUES":    nil,
+	"UPDATE":    {"DO", "FOR"},
+	"SET":       {"UPDATE"},
+	"DELETE":    nil,
+	"RETURNING": nil,
+	"JOIN":      {"INNER", "LEFT", "RIGHT", "FULL", "CROSS", "OUTER"},
+	"INNER":     nil,
+	"LEFT":      nil,
+	"RIGHT":     nil,
+	"FULL":      nil,
+	"CROSS":     nil,
+}
+
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlString
+	sqlComment
+	sqlPunct
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	line int
+}
+
+func tokenizeSQL(src string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(src)
+	line := 1
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			start := i
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlComment, string(runes[start:i]), line})
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start, startLine := i, line
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i+1 >= len(runes) {
+				return nil, &Error{Line: startLine, Msg: "unterminated block comment"}
+			}
+			i += 2
+			tokens = append(tokens, sqlToken{sqlComment, string(runes[start:i]), startLine})
+		case r == '\'' || r == '"':
+			start, startLine := i, line
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, &Error{Line: startLine, Msg: "unterminated quoted string"}
+				}
+				if runes[i] == '\n' {
+					line++
+				}
+				if runes[i] == r {
+					// A doubled quote is an escaped quote, not the end of the literal.
+					if i+1 < len(runes) && runes[i+1] == r {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlString, string(runes[start:i]), startLine})
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@' || r == '$':
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlWord, string(runes[start:i]), line})
+		default:
+			text := string(r)
+			if i+1 < len(runes) {
+				switch pair := string(runes[i : i+2]); pair {
+				case "<=", ">=", "<>", "!=", "::", "||":
+					text = pair
+				}
+			}
+			i += len([]rune(text))
+			tokens = append(tokens, sqlToken{sqlPunct, text, line})
+		}
+	}
+
+	return tokens, nil
+}
+
+func formatSQL(src string) (string, error) {
+	tokens, err := tokenizeSQL(src)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		b        strings.Builder
+		depth    int
+		opened   []int
+		prev     string
+		between  bool
+		inSelect bool
+		lineOpen bool
+	)
+
+	newline := func(extra int) {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(strings.Repeat("  ", depth+extra))
+		lineOpen = false
+	}
+
+	write := func(text string, space bool) {
+		if space && lineOpen {
+			b.WriteByte(' ')
+		}
+		b.WriteString(text)
+		lineOpen = true
+	}
+
+	for _, tok := range tokens {
+		text := tok.text
+		upper := strings.ToUpper(text)
+		isKeyword := tok.kind == sqlWord && sqlKeywords[upper]
+		if isKeyword {
+			text = upper
+		}
+
+		switch {
+		case tok.kind == sqlComment:
+			if lineOpen {
+				write(text, true)
+			} else {
+				newline(0)
+				write(text, false)
+			}
+			newline(0)
+
+		case tok.kind == sqlPunct && text == "(":
+			opened = append(opened, tok.line)
+			write(text, lineOpen && (sqlKeywords[prev] || prev == "," || prev == "="))
+			depth++
+
+		case tok.kind == sqlPunct && text == ")":
+			if len(opened) == 0 {
+				return "", &Error{Line: tok.line, Msg: "unexpected closing parenthesis"}
+			}
+			opened = opened[:len(opened)-1]
+			depth--
+			write(text, false)
+
+		case tok.kind == sqlPunct && text == ",":
+			write(text, false)
+			if inSelect && depth == 0 {
+				newline(1)
+			}
+
+		case tok.kind == sqlPunct && text == ";":
+			write(text, false)
+			b.WriteByte('\n')
+			inSelect = false
+			lineOpen = false
+
+		case tok.kind == sqlPunct && (text == "." || text == "::"):
+			write(text, false)
+
+		case isKeyword && clauseStart(upper, prev):
+			inSelect = upper == "SELECT"
+			if upper != "SELECT" && upper != "UNION" && upper != "ALL" {
+				inSelect = false
+			}
+			newline(0)
+			write(text, false)
+
+		case isKeyword && upper == "ON":
+			newline(1)
+			write(text, false)
+
+		case isKeyword && (upper == "AND" || upper == "OR"):
+			if upper == "AND" && between {
+				between = false
+				write(text, true)
+				break
+			}
+			newline(1)
+			write(text, false)
+
+		default:
+			if upper == "BETWEEN" {
+				between = true
+			}
+			write(text, !(prev == "(" || prev == "." || prev == "::"))
+		}
+
+		if tok.kind != sqlComment {
+			prev = text
+		}
+	}
+
+	if len(opened) > 0 {
+		return "", &Error{Line: opened[len(opened)-1], Msg: "unclosed parenthesis"}
+	}
+
+	return strings.TrimSpace(b.String()) + "\n", nil
+}
+
+func clauseStart(keyword, prev string) bool {
+	keep, ok := sqlClauses[keyword]
+	if !ok {
+		return false
+	}
+	for _, k := range keep {
+		if k == prev {
+			return false
+		}
+	}
+	return true
+}
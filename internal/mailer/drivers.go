@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Memory keeps every message in memory, it is meant for tests.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (d *Memory) Deliver(msg Message) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.messages = append(d.messages, msg)
+	return nil
+}
+
+// Messages returns the messages delivered to the given address, oldest first.
+func (d *Memory) Messages(to string) []Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var messages []Message
+	for _, msg := range d.messages {
+		if msg.To == to {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// File writes every message as a .eml file into Dir, handy in development.
+type File struct {
+	Dir string
+}
+
+func (d *File) Deliver(msg Message) error {
+	err := os.MkdirAll(d.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", msg.Sent.UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(d.Dir, name), format(msg), 0o600)
+}
+
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+func (d *SMTP) Deliver(msg Message) error {
+	var auth smtp.Auth
+	if d.Username != "" {
+		auth = smtp.PlainAuth("", d.Username, d.Password, d.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(d.Host, d.Port), auth, msg.From, []string{msg.To}, format(msg))
+}
+
+func format(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", strings.TrimSpace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", msg.Sent.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.TrimSpace(msg.Body), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
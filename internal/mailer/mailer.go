@@ -0,0 +1,66 @@
+// Package mailer renders emails from text templates and hands them to a
+// pluggable delivery driver.
+package mailer
+
+import (
+	"bytes"
+	"io/fs"
+	"text/template"
+	"time"
+)
+
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+	Sent    time.Time
+}
+
+// Driver delivers a rendered message.
+type Driver interface {
+	Deliver(msg Message) error
+}
+
+type Mailer struct {
+	driver    Driver
+	from      string
+	templates fs.FS
+}
+
+// New returns a mailer that reads its templates from the given filesystem.
+// Every template defines a "subject" and a "body".
+func New(driver Driver, from string, templates fs.FS) *Mailer {
+	return &Mailer{
+		driver:    driver,
+		from:      from,
+		templates: templates,
+	}
+}
+
+func (m *Mailer) Send(to, templateFile string, data any) error {
+	tmpl, err := template.New("email").ParseFS(m.templates, templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	body := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(body, "body", data)
+	if err != nil {
+		return err
+	}
+
+	return m.driver.Deliver(Message{
+		From:    m.from,
+		To:      to,
+		Subject: subject.String(),
+		Body:    body.String(),
+		Sent:    time.Now(),
+	})
+}
@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"go-webserver/internal/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var templates = fstest.MapFS{
+	"welcome.tmpl": {Data: []byte(`{{define "subject"}}Welcome {{.}}{{end}}{{define "body"}}Hello {{.}}, nice to meet you.{{end}}`)},
+}
+
+func TestMemory(t *testing.T) {
+	outbox := &Memory{}
+	m := New(outbox, "app@example.com", templates)
+
+	err := m.Send("alice@example.com", "welcome.tmpl", "Alice")
+	assert.NilError(t, err)
+
+	messages := outbox.Messages("alice@example.com")
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].From, "app@example.com")
+	assert.Equal(t, messages[0].Subject, "Welcome Alice")
+	assert.Equal(t, messages[0].Body, "Hello Alice, nice to meet you.")
+	assert.Equal(t, len(outbox.Messages("bob@example.com")), 0)
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	m := New(&File{Dir: dir}, "app@example.com", templates)
+
+	err := m.Send("alice@example.com", "welcome.tmpl", "Alice")
+	assert.NilError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-alice_at_example.com.eml"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 1)
+
+	content, err := os.ReadFile(files[0])
+	assert.NilError(t, err)
+	assert.StringContains(t, string(content), "Subject: Welcome Alice\r\n")
+	assert.StringContains(t, string(content), "\r\n\r\nHello Alice, nice to meet you.\r\n")
+}
+
+func TestMissingTemplate(t *testing.T) {
+	m := New(&Memory{}, "app@example.com", templates)
+
+	err := m.Send("alice@example.com", "missing.tmpl", nil)
+	if err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The scopes an API token can be given, each lets scripts use a part of the
+// API on behalf of the token's owner.
+const (
+	ScopeSnippetsRead  = "snippets:read"
+	ScopeSnippetsWrite = "snippets:write"
+)
+
+var APIScopes = []string{ScopeSnippetsRead, ScopeSnippetsWrite}
+
+// APIToken lets scripts authenticate as its owner. Only a hash of the token
+// is stored, it is shown to the user once when it is created.
+type APIToken struct {
+	Id       int        `db:"id"`
+	UserId   int        `db:"user_id"`
+	Name     string     `db:"name"`
+	Scopes   []string   `db:"scopes"`
+	Created  time.Time  `db:"created"`
+	Expiry   time.Time  `db:"expiry"`
+	LastUsed *time.Time `db:"last_used"`
+}
+
+func (t APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t APIToken) Expired() bool {
+	return time.Now().After(t.Expiry)
+}
+
+type APITokenModelInterface interface {
+	Insert(userId int, name string, scopes []string, ttl time.Duration) (string, error)
+	ForUser(userId int) ([]APIToken, error)
+	Delete(userId, id int) error
+	Authenticate(token string) (APIToken, error)
+}
+
+type APITokenModel struct {
+	Pool *pgxpool.Pool
+}
+
+// Insert stores the hash of a new token valid for ttl and returns the token
+// itself.
+func (m *APITokenModel) Insert(userId int, name string, scopes []string, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO api_tokens (user_id, token_hash, name, scopes, created, expiry)
+	VALUES (@userId, @hash, @name, @scopes, @created, @expiry)`
+	args := pgx.NamedArgs{
+		"userId":  userId,
+		"hash":    hash,
+		"name":    name,
+		"scopes":  scopes,
+		"created": time.Now(),
+		"expiry":  time.Now().Add(ttl),
+	}
+
+	_, err = m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ForUser returns the user's tokens, expired ones included so they can see
+// what stopped working.
+func (m *APITokenModel) ForUser(userId int) ([]APIToken, error) {
+	query := `SELECT id, user_id, name, scopes, created, expiry, last_used FROM api_tokens
+	WHERE user_id = @userId ORDER BY created DESC, id DESC`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[APIToken])
+}
+
+func (m *APITokenModel) Delete(userId, id int) error {
+	query := `DELETE FROM api_tokens WHERE id = @id AND user_id = @userId`
+	commandTag, err := m.Pool.Exec(context.Background(), query, pgx.NamedArgs{"id": id, "userId": userId})
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Authenticate returns the unexpired token and records that it was used, or
+// ErrInvalidToken.
+func (m *APITokenModel) Authenticate(token string) (APIToken, error) {
+	query := `UPDATE api_tokens SET last_used = CURRENT_TIMESTAMP
+	WHERE token_hash = @hash AND expiry > CURRENT_TIMESTAMP
+	RETURNING id, user_id, name, scopes, created, expiry, last_used`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"hash": hashToken(token)})
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	apiToken, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[APIToken])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return APIToken{}, ErrInvalidToken
+		}
+		return APIToken{}, err
+	}
+
+	return apiToken, nil
+}
+
+// revokeAPITokens deletes all of the user's tokens, for when their password
+// changes and whatever was set up with the old one shouldn't outlive it.
+func revokeAPITokens(ctx context.Context, tx pgx.Tx, userId int) error {
+	_, err := tx.Exec(ctx, `DELETE FROM api_tokens WHERE user_id = @userId`, pgx.NamedArgs{"userId": userId})
+	return err
+}
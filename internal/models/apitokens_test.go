@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"go-webserver/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestAPITokenAuthenticate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := APITokenModel{Pool: db}
+
+	token, err := m.Insert(1, "Deploy script", []string{ScopeSnippetsRead}, time.Hour)
+	assert.NilError(t, err)
+
+	tokens, err := m.ForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 1)
+	assert.Equal(t, tokens[0].LastUsed == nil, true)
+
+	apiToken, err := m.Authenticate(token)
+	assert.NilError(t, err)
+	assert.Equal(t, apiToken.UserId, 1)
+	assert.Equal(t, apiToken.HasScope(ScopeSnippetsRead), true)
+	assert.Equal(t, apiToken.HasScope(ScopeSnippetsWrite), false)
+	assert.Equal(t, apiToken.LastUsed != nil, true)
+
+	expired, err := m.Insert(1, "Old script", []string{ScopeSnippetsRead}, -time.Hour)
+	assert.NilError(t, err)
+	_, err = m.Authenticate(expired)
+	assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+
+	err = m.Delete(2, apiToken.Id)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	err = m.Delete(1, apiToken.Id)
+	assert.NilError(t, err)
+	_, err = m.Authenticate(token)
+	assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+}
+
+func TestAPITokensRevokedWithPassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := APITokenModel{Pool: db}
+	users := UserModel{Pool: db}
+
+	_, err := m.Insert(1, "Deploy script", []string{ScopeSnippetsRead}, time.Hour)
+	assert.NilError(t, err)
+
+	err = users.PasswordUpdate(1, "wrong", "new-Lantern-42")
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	tokens, err := m.ForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 1)
+
+	err = users.PasswordUpdate(1, "pa$$word", "new-Lantern-42")
+	assert.NilError(t, err)
+	tokens, err = m.ForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 0)
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The security relevant events that end up in the audit log.
+const (
+	AuditSignup         = "signup"
+	AuditLogin          = "login"
+	AuditLoginFailed    = "login_failed"
+	AuditLogout         = "logout"
+	AuditPasswordChange = "password_change"
+	AuditPasswordReset  = "password_reset"
+	AuditTokenCreate    = "token_create"
+	AuditTokenDelete    = "token_delete"
+	AuditTOTPEnable     = "2fa_enable"
+	AuditTOTPDisable    = "2fa_disable"
+	AuditPasskeyAdd     = "passkey_add"
+	AuditPasskeyRemove  = "passkey_remove"
+	AuditEmailChange    = "email_change"
+	AuditAccountDelete  = "account_delete"
+	AuditModeration     = "moderation"
+	AuditAdminAction    = "admin_action"
+)
+
+var AuditEvents = []string{
+	AuditSignup, AuditLogin, AuditLoginFailed, AuditLogout, AuditPasswordChange,
+	AuditPasswordReset, AuditTokenCreate, AuditTokenDelete, AuditTOTPEnable,
+	AuditTOTPDisable, AuditPasskeyAdd, AuditPasskeyRemove, AuditEmailChange,
+	AuditAccountDelete, AuditModeration, AuditAdminAction,
+}
+
+// AuditEvent records who did what from where. ActorId is the user who acted
+// and UserId the account the event is about, they differ for admin actions
+// and are 0 when unknown, e.g. for a failed login with an unknown email.
+type AuditEvent struct {
+	Id        int64             `db:"id"`
+	Event     string            `db:"event"`
+	ActorId   int               `db:"actor_id"`
+	UserId    int               `db:"user_id"`
+	IP        string            `db:"ip"`
+	UserAgent string            `db:"user_agent"`
+	Details   map[string]string `db:"details"`
+	Created   time.Time         `db:"created"`
+}
+
+type AuditModelInterface interface {
+	Record(event AuditEvent) error
+	ForUser(userId, limit int) ([]AuditEvent, error)
+	Search(query, event string, limit int) ([]AuditEvent, error)
+}
+
+// AuditModel only ever inserts, the audit_events table refuses updates and
+// deletes so the history can't be rewritten from the application.
+type AuditModel struct {
+	Pool *pgxpool.Pool
+}
+
+func (m *AuditModel) Record(event AuditEvent) error {
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+
+	query := `INSERT INTO audit_events (event, actor_id, user_id, ip, user_agent, details, created)
+	VALUES (@event, NULLIF(@actorId, 0), NULLIF(@userId, 0), @ip, left(@userAgent, 500), @details, CURRENT_TIMESTAMP)`
+	args := pgx.NamedArgs{
+		"event":     event.Event,
+		"actorId":   event.ActorId,
+		"userId":    event.UserId,
+		"ip":        event.IP,
+		"userAgent": event.UserAgent,
+		"details":   event.Details,
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	return err
+}
+
+const auditColumns = `id, event, COALESCE(actor_id, 0) AS actor_id, COALESCE(user_id, 0) AS user_id,
+	ip, user_agent, details, created`
+
+// ForUser returns the latest events about the user's account, newest first.
+func (m *AuditModel) ForUser(userId, limit int) ([]AuditEvent, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_events
+	WHERE user_id = @userId ORDER BY created DESC, id DESC LIMIT @limit`
+	args := pgx.NamedArgs{
+		"userId": userId,
+		"limit":  limit,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[AuditEvent])
+}
+
+// Search finds events by a case-insensitive substring of the IP address, the
+// details or the email address of the actor or the user, optionally of a
+// single kind. It is meant for administrators.
+func (m *AuditModel) Search(query, event string, limit int) ([]AuditEvent, error) {
+	sql := `SELECT ` + auditColumns + ` FROM audit_events e
+	WHERE (@event = '' OR e.event = @event)
+	AND (@query = '' OR e.ip ILIKE @pattern OR e.details::text ILIKE @pattern
+		OR EXISTS (SELECT 1 FROM users u WHERE u.id IN (e.actor_id, e.user_id) AND u.email ILIKE @pattern))
+	ORDER BY e.created DESC, e.id DESC LIMIT @limit`
+	args := pgx.NamedArgs{
+		"query":   query,
+		"pattern": containsPattern(query),
+		"event":   event,
+		"limit":   limit,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), sql, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[AuditEvent])
+}
+
+// likeEscaper escapes the characters that are special in LIKE patterns, with
+// the backslash that is their default escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern is a LIKE pattern that matches text containing s.
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
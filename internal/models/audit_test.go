@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"go-webserver/internal/assert"
+	"testing"
+)
+
+func TestAuditAppendOnly(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := AuditModel{Pool: db}
+
+	err := m.Record(AuditEvent{Event: AuditLogin, ActorId: 1, UserId: 1, IP: "203.0.113.9", Details: map[string]string{"method": "password"}})
+	assert.NilError(t, err)
+
+	events, err := m.ForUser(1, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Details["method"], "password")
+
+	events, err = m.Search("alice@", "", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 1)
+
+	// LIKE wildcards in the query are matched literally
+	events, err = m.Search("%", "", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 0)
+
+	_, err = db.Exec(context.Background(), "UPDATE audit_events SET ip = '127.0.0.1'")
+	assert.Equal(t, err != nil, true)
+
+	_, err = db.Exec(context.Background(), "DELETE FROM audit_events")
+	assert.Equal(t, err != nil, true)
+
+	_, err = db.Exec(context.Background(), "TRUNCATE audit_events")
+	assert.Equal(t, err != nil, true)
+}
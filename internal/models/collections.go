@@ -0,0 +1,226 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Collection struct {
+	Id          int       `db:"id"`
+	UserId      int       `db:"user_id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Visibility  string    `db:"visibility"`
+	Created     time.Time `db:"created"`
+}
+
+// CollectionVisibilities are the values accepted for Collection.Visibility.
+// Private collections are only shown to their owner.
+var CollectionVisibilities = []string{"public", "private"}
+
+type CollectionModelInterface interface {
+	Insert(userId int, name, description, visibility string) (int, error)
+	Get(id int) (Collection, error)
+	ForUser(userId int) ([]Collection, error)
+	Snippets(id int) ([]Snippet, error)
+	AddSnippet(id int, snippetId string) error
+	RemoveSnippet(id int, snippetId string) error
+	MoveSnippet(id int, snippetId string, offset int) error
+}
+
+type CollectionModel struct {
+	Pool *pgxpool.Pool
+}
+
+func (m *CollectionModel) Insert(userId int, name, description, visibility string) (int, error) {
+	query := `INSERT INTO collections (user_id, name, description, visibility, created)
+	VALUES (@userId, @name, @description, @visibility, @created) RETURNING id`
+
+	args := pgx.NamedArgs{
+		"userId":      userId,
+		"name":        name,
+		"description": description,
+		"visibility":  visibility,
+		"created":     time.Now(),
+	}
+
+	var id int
+	err := m.Pool.QueryRow(context.Background(), query, args).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *CollectionModel) Get(id int) (Collection, error) {
+	query := `SELECT id, user_id, name, description, visibility, created FROM collections WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	collection, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Collection])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Collection{}, ErrNoRecord
+		}
+		return Collection{}, err
+	}
+
+	return collection, nil
+}
+
+func (m *CollectionModel) ForUser(userId int) ([]Collection, error) {
+	query := `SELECT id, user_id, name, description, visibility, created FROM collections
+	WHERE user_id = @userId ORDER BY name`
+	args := pgx.NamedArgs{
+		"userId": userId,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Collection])
+}
+
+// Snippets returns the unexpired snippets of a collection in their saved order.
+// Organization snippets are left out, collections can be public.
+func (m *CollectionModel) Snippets(id int) ([]Snippet, error) {
+	query := `SELECT s.* FROM snippets s
+	JOIN collection_snippets cs ON cs.snippet_id = s.id
+	WHERE cs.collection_id = @id AND s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND s.org_id IS NULL
+	ORDER BY cs.position`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+}
+
+// AddSnippet appends a snippet to the end of the collection. Adding a snippet
+// which is already part of the collection is a no-op. The collection row is
+// locked so two snippets added at once don't get the same position.
+func (m *CollectionModel) AddSnippet(id int, snippetId string) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked int
+	err = tx.QueryRow(ctx, `SELECT id FROM collections WHERE id = @id FOR UPDATE`, pgx.NamedArgs{"id": id}).Scan(&locked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	query := `INSERT INTO collection_snippets (collection_id, snippet_id, position)
+	SELECT @id, @snippetId, COALESCE(MAX(position), 0) + 1 FROM collection_snippets WHERE collection_id = @id
+	ON CONFLICT DO NOTHING`
+	args := pgx.NamedArgs{
+		"id":        id,
+		"snippetId": snippetId,
+	}
+
+	_, err = tx.Exec(ctx, query, args)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// 23503 is the postgres error code for a foreign key violation, the
+		// snippet or the collection doesn't exist.
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (m *CollectionModel) RemoveSnippet(id int, snippetId string) error {
+	query := `DELETE FROM collection_snippets WHERE collection_id = @id AND snippet_id = @snippetId`
+	args := pgx.NamedArgs{
+		"id":        id,
+		"snippetId": snippetId,
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// MoveSnippet swaps a snippet with its neighbour, offset -1 moves it one place
+// up and 1 one place down. Moving past either end is a no-op.
+func (m *CollectionModel) MoveSnippet(id int, snippetId string, offset int) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT snippet_id FROM collection_snippets WHERE collection_id = @id ORDER BY position FOR UPDATE`
+	rows, err := tx.Query(ctx, query, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return err
+	}
+
+	order, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	from := -1
+	for i, sid := range order {
+		if sid == snippetId {
+			from = i
+		}
+	}
+	if from == -1 {
+		return ErrNoRecord
+	}
+
+	to := from + offset
+	if to < 0 || to >= len(order) {
+		return nil
+	}
+	order[from], order[to] = order[to], order[from]
+
+	for i, sid := range order {
+		query = `UPDATE collection_snippets SET position = @position WHERE collection_id = @id AND snippet_id = @snippetId`
+		_, err = tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "snippetId": sid, "position": i + 1})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
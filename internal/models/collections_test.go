@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"go-webserver/internal/assert"
+	"sync"
+	"testing"
+)
+
+func TestCollectionAddSnippetParallel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	collections := CollectionModel{Pool: db}
+	snippets := SnippetModel{Pool: db}
+
+	id, err := collections.Insert(1, "Runbooks", "", "public")
+	assert.NilError(t, err)
+
+	var ids []string
+	for _, title := range []string{"Deploy", "Rollback", "Restart", "Rotate keys"} {
+		snippetId, err := snippets.Insert(SnippetRequest{Title: title, Content: "Steps", Expires: 7, UserId: 1})
+		assert.NilError(t, err)
+		ids = append(ids, snippetId)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ids))
+	for i, snippetId := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = collections.AddSnippet(id, snippetId)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NilError(t, err)
+	}
+
+	// every snippet got a position of its own
+	var positions int
+	err = db.QueryRow(context.Background(), `SELECT COUNT(DISTINCT position) FROM collection_snippets WHERE collection_id = $1`, id).Scan(&positions)
+	assert.NilError(t, err)
+	assert.Equal(t, positions, len(ids))
+
+	err = collections.AddSnippet(999, ids[0])
+	assert.Equal(t, err, ErrNoRecord)
+}
@@ -5,4 +5,12 @@ import "errors"
 var ErrNoRecord = errors.New("models: no matching record found")
 
 var ErrInvalidCredentials = errors.New("models: invalid credentials")
-var ErrDuplicateEmail = errors.New("models: duplicate email")
\ No newline at end of file
+var ErrDuplicateEmail = errors.New("models: duplicate email")
+var ErrDuplicateUsername = errors.New("models: duplicate username")
+var ErrDuplicateSlug = errors.New("models: duplicate slug")
+var ErrAccountDisabled = errors.New("models: account disabled")
+var ErrInvalidToken = errors.New("models: invalid or expired token")
+var ErrDuplicatePasskey = errors.New("models: duplicate passkey")
+var ErrLastOwner = errors.New("models: organization needs an owner")
+var ErrInvalidInvite = errors.New("models: invalid or used up invite code")
+var ErrUnverifiedAccount = errors.New("models: account email not verified")
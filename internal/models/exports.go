@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// AccountExport is a data export archive built in the background for a user.
+// The archive itself is only loaded by Archive.
+type AccountExport struct {
+	Id      int       `db:"id"`
+	UserId  int       `db:"user_id"`
+	Status  string    `db:"status"`
+	Size    int64     `db:"size"`
+	Created time.Time `db:"created"`
+}
+
+type ExportModelInterface interface {
+	Insert(userId int) (int, error)
+	Complete(id int, archive []byte) error
+	Fail(id int) error
+	ForUser(userId int) ([]AccountExport, error)
+	Archive(id, userId int) ([]byte, error)
+	Purge(maxAge, afterDownload time.Duration) error
+}
+
+type ExportModel struct {
+	Pool *pgxpool.Pool
+}
+
+func (m *ExportModel) Insert(userId int) (int, error) {
+	query := `INSERT INTO account_exports(user_id, status, created) VALUES (@userId, @status, @created)
+	RETURNING id`
+	args := pgx.NamedArgs{
+		"userId":  userId,
+		"status":  ExportPending,
+		"created": time.Now(),
+	}
+
+	var id int
+	err := m.Pool.QueryRow(context.Background(), query, args).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *ExportModel) Complete(id int, archive []byte) error {
+	query := `UPDATE account_exports SET status = @status, archive = @archive WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"status":  ExportReady,
+		"archive": archive,
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	return err
+}
+
+func (m *ExportModel) Fail(id int) error {
+	query := `UPDATE account_exports SET status = @status WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":     id,
+		"status": ExportFailed,
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	return err
+}
+
+// ForUser lists the user's ten most recent exports.
+func (m *ExportModel) ForUser(userId int) ([]AccountExport, error) {
+	query := `SELECT id, user_id, status, COALESCE(octet_length(archive), 0)::bigint AS size, created
+	FROM account_exports WHERE user_id = @userId ORDER BY created DESC LIMIT 10`
+	args := pgx.NamedArgs{
+		"userId": userId,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[AccountExport])
+}
+
+// Archive returns a finished export and notes when it was first downloaded.
+// Exports that belong to someone else or are not ready yet are reported as
+// ErrNoRecord.
+func (m *ExportModel) Archive(id, userId int) ([]byte, error) {
+	query := `UPDATE account_exports SET downloaded = COALESCE(downloaded, CURRENT_TIMESTAMP)
+	WHERE id = @id AND user_id = @userId AND status = @status
+	RETURNING archive`
+	args := pgx.NamedArgs{
+		"id":     id,
+		"userId": userId,
+		"status": ExportReady,
+	}
+
+	var archive []byte
+	err := m.Pool.QueryRow(context.Background(), query, args).Scan(&archive)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// Purge deletes exports created more than maxAge ago, and those first
+// downloaded more than afterDownload ago.
+func (m *ExportModel) Purge(maxAge, afterDownload time.Duration) error {
+	query := `DELETE FROM account_exports
+	WHERE created < CURRENT_TIMESTAMP - @maxAge::interval
+	OR downloaded < CURRENT_TIMESTAMP - @afterDownload::interval`
+	args := pgx.NamedArgs{
+		"maxAge":        maxAge.String(),
+		"afterDownload": afterDownload.String(),
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	return err
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"go-webserver/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestExportPurge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := ExportModel{Pool: db}
+
+	downloaded, err := m.Insert(1)
+	assert.NilError(t, err)
+	assert.NilError(t, m.Complete(downloaded, []byte("zip")))
+	waiting, err := m.Insert(1)
+	assert.NilError(t, err)
+	assert.NilError(t, m.Complete(waiting, []byte("zip")))
+
+	_, err = m.Archive(downloaded, 1)
+	assert.NilError(t, err)
+
+	err = m.Purge(time.Hour, 0)
+	assert.NilError(t, err)
+
+	_, err = m.Archive(downloaded, 1)
+	assert.Equal(t, err, ErrNoRecord)
+	_, err = m.Archive(waiting, 1)
+	assert.NilError(t, err)
+
+	err = m.Purge(0, time.Hour)
+	assert.NilError(t, err)
+
+	exports, err := m.ForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(exports), 0)
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InviteCode lets up to MaxUses people sign up while signups are invite-only.
+// Only a hash of the code is stored, UsedBy lists the usernames of the
+// accounts created with it that still exist.
+type InviteCode struct {
+	Id        int       `db:"id"`
+	Note      string    `db:"note"`
+	MaxUses   int       `db:"max_uses"`
+	Uses      int       `db:"uses"`
+	Revoked   bool      `db:"revoked"`
+	CreatedBy string    `db:"created_by"`
+	Created   time.Time `db:"created"`
+	UsedBy    []string  `db:"used_by"`
+}
+
+// Usable reports whether the code still lets someone sign up.
+func (c InviteCode) Usable() bool {
+	return !c.Revoked && c.Uses < c.MaxUses
+}
+
+type InviteModelInterface interface {
+	Insert(createdBy, maxUses int, note string) (string, error)
+	All() ([]InviteCode, error)
+	Revoke(id int) error
+}
+
+type InviteModel struct {
+	Pool *pgxpool.Pool
+}
+
+// Insert stores the hash of a new code that can be used maxUses times and
+// returns the code itself.
+func (m *InviteModel) Insert(createdBy, maxUses int, note string) (string, error) {
+	code, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO invite_codes (code_hash, note, max_uses, created_by, created)
+	VALUES (@hash, @note, @maxUses, @createdBy, @created)`
+	args := pgx.NamedArgs{
+		"hash":      hash,
+		"note":      note,
+		"maxUses":   maxUses,
+		"createdBy": createdBy,
+		"created":   time.Now(),
+	}
+
+	_, err = m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// All returns every code, newest first, with the accounts created with it.
+func (m *InviteModel) All() ([]InviteCode, error) {
+	query := `SELECT i.id, i.note, i.max_uses, i.uses, i.revoked, COALESCE(c.name, '') AS created_by, i.created,
+		COALESCE(array_agg(u.username ORDER BY iu.used) FILTER (WHERE u.id IS NOT NULL), '{}') AS used_by
+	FROM invite_codes i
+	LEFT JOIN users c ON c.id = i.created_by
+	LEFT JOIN invite_code_uses iu ON iu.code_id = i.id
+	LEFT JOIN users u ON u.id = iu.user_id
+	GROUP BY i.id, c.name
+	ORDER BY i.created DESC, i.id DESC`
+
+	rows, err := m.Pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[InviteCode])
+}
+
+// Revoke stops the code from being used again, the accounts already created
+// with it are kept.
+func (m *InviteModel) Revoke(id int) error {
+	commandTag, err := m.Pool.Exec(context.Background(), `UPDATE invite_codes SET revoked = true WHERE id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// InsertInvited creates a user like Insert, using up one use of the invite
+// code. The account is only created if the code is still usable, otherwise
+// ErrInvalidInvite is returned.
+func (m *UserModel) InsertInvited(name, username, email, password, code string) (int, error) {
+	hashedPassword, err := m.passwords().Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The row lock makes a second signup with the last use of the code wait
+	// and then fail.
+	var codeId int
+	query := `UPDATE invite_codes SET uses = uses + 1
+	WHERE code_hash = @hash AND NOT revoked AND uses < max_uses RETURNING id`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"hash": hashToken(code)}).Scan(&codeId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidInvite
+		}
+		return 0, err
+	}
+
+	var id int
+	query = `INSERT INTO users (name, username, email, hashed_password, created)
+	VALUES (@name, @username, @email, @hashedPassword, @createdAt) RETURNING id`
+	args := pgx.NamedArgs{
+		"name":           name,
+		"username":       username,
+		"email":          NormalizeEmail(email),
+		"hashedPassword": hashedPassword,
+		"createdAt":      time.Now(),
+	}
+	err = tx.QueryRow(ctx, query, args).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, duplicateError(pgErr)
+		}
+		return 0, err
+	}
+
+	query = `INSERT INTO invite_code_uses (code_id, user_id, used) VALUES (@codeId, @userId, @used)`
+	_, err = tx.Exec(ctx, query, pgx.NamedArgs{"codeId": codeId, "userId": id, "used": time.Now()})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
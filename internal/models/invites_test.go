@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"go-webserver/internal/assert"
+	"testing"
+)
+
+func TestInsertInvited(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	invites := InviteModel{Pool: db}
+	users := UserModel{Pool: db}
+
+	code, err := invites.Insert(1, 1, "For Bob")
+	assert.NilError(t, err)
+
+	_, err = users.InsertInvited("Bob Brown", "bob", "bob@example.com", "new-Lantern-42", "not-a-code")
+	assert.Equal(t, errors.Is(err, ErrInvalidInvite), true)
+
+	// a failed signup doesn't use up the code
+	_, err = users.InsertInvited("Alice Again", "alice2", "alice@example.com", "new-Lantern-42", code)
+	assert.Equal(t, errors.Is(err, ErrDuplicateEmail), true)
+
+	bob, err := users.InsertInvited("Bob Brown", "bob", "bob@example.com", "new-Lantern-42", code)
+	assert.NilError(t, err)
+
+	_, err = users.InsertInvited("Carol Chen", "carol", "carol@example.com", "new-Lantern-42", code)
+	assert.Equal(t, errors.Is(err, ErrInvalidInvite), true)
+
+	codes, err := invites.All()
+	assert.NilError(t, err)
+	assert.Equal(t, len(codes), 1)
+	assert.Equal(t, codes[0].Uses, 1)
+	assert.Equal(t, codes[0].Usable(), false)
+	assert.Equal(t, len(codes[0].UsedBy), 1)
+	assert.Equal(t, codes[0].UsedBy[0], "bob")
+
+	// deleting the account keeps the record of the use
+	err = users.Delete(bob, "new-Lantern-42", false)
+	assert.NilError(t, err)
+
+	var uses int
+	err = db.QueryRow(context.Background(), `SELECT count(*) FROM invite_code_uses WHERE user_id IS NULL`).Scan(&uses)
+	assert.NilError(t, err)
+	assert.Equal(t, uses, 1)
+
+	codes, err = invites.All()
+	assert.NilError(t, err)
+	assert.Equal(t, codes[0].Uses, 1)
+	assert.Equal(t, len(codes[0].UsedBy), 0)
+}
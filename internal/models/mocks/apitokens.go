@@ -0,0 +1,77 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"sort"
+	"time"
+)
+
+// The API tokens the mock knows about. Both of alice's tokens work, the ones
+// of the disabled user and of enroll, who still has to set up the 2FA their
+// role requires, are valid but their owners can't use them.
+const (
+	APIToken         = "valid-api-token"
+	ReadOnlyAPIToken = "read-only-api-token"
+	DisabledAPIToken = "disabled-api-token"
+	EnrollAPIToken   = "enroll-api-token"
+)
+
+var mockAPITokens = map[string]models.APIToken{
+	APIToken:         {Id: 1, UserId: 1, Name: "Deploy script", Scopes: models.APIScopes},
+	ReadOnlyAPIToken: {Id: 2, UserId: 1, Name: "Backup", Scopes: []string{models.ScopeSnippetsRead}},
+	DisabledAPIToken: {Id: 3, UserId: 4, Name: "Old script", Scopes: models.APIScopes},
+	EnrollAPIToken:   {Id: 4, UserId: 8, Name: "Moderation bot", Scopes: models.APIScopes},
+}
+
+// APITokenCreate is what APITokenModel.Insert was called with.
+type APITokenCreate struct {
+	UserId int
+	Name   string
+	Scopes []string
+	TTL    time.Duration
+}
+
+// APITokenModel records the tokens created, deleted and used. New tokens are
+// always APIToken.
+type APITokenModel struct {
+	Inserted []APITokenCreate
+	Deleted  []int
+	Used     []int
+}
+
+func (m *APITokenModel) Insert(userId int, name string, scopes []string, ttl time.Duration) (string, error) {
+	m.Inserted = append(m.Inserted, APITokenCreate{UserId: userId, Name: name, Scopes: scopes, TTL: ttl})
+	return APIToken, nil
+}
+
+func (m *APITokenModel) ForUser(userId int) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	for _, token := range mockAPITokens {
+		if token.UserId == userId {
+			token.Created = time.Now()
+			token.Expiry = time.Now().Add(30 * 24 * time.Hour)
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Id < tokens[j].Id })
+	return tokens, nil
+}
+
+func (m *APITokenModel) Delete(userId, id int) error {
+	for _, token := range mockAPITokens {
+		if token.Id == id && token.UserId == userId {
+			m.Deleted = append(m.Deleted, id)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *APITokenModel) Authenticate(token string) (models.APIToken, error) {
+	apiToken, ok := mockAPITokens[token]
+	if !ok {
+		return models.APIToken{}, models.ErrInvalidToken
+	}
+	m.Used = append(m.Used, apiToken.Id)
+	return apiToken, nil
+}
@@ -0,0 +1,74 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditModel keeps the recorded events in memory so tests can check what
+// was logged.
+type AuditModel struct {
+	mu     sync.Mutex
+	Events []models.AuditEvent
+}
+
+func (m *AuditModel) Record(event models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.Id = int64(len(m.Events) + 1)
+	event.Created = time.Now()
+	m.Events = append(m.Events, event)
+	return nil
+}
+
+// Recorded returns the kinds of the events recorded so far, oldest first.
+func (m *AuditModel) Recorded() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []string
+	for _, event := range m.Events {
+		events = append(events, event.Event)
+	}
+	return events
+}
+
+func (m *AuditModel) ForUser(userId, limit int) ([]models.AuditEvent, error) {
+	return m.filter(limit, func(event models.AuditEvent) bool {
+		return event.UserId == userId
+	}), nil
+}
+
+func (m *AuditModel) Search(query, event string, limit int) ([]models.AuditEvent, error) {
+	return m.filter(limit, func(e models.AuditEvent) bool {
+		if event != "" && e.Event != event {
+			return false
+		}
+		if query == "" || strings.Contains(e.IP, query) {
+			return true
+		}
+		for _, value := range e.Details {
+			if strings.Contains(strings.ToLower(value), strings.ToLower(query)) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// filter returns the newest events first, like the database does.
+func (m *AuditModel) filter(limit int, keep func(models.AuditEvent) bool) []models.AuditEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.AuditEvent
+	for i := len(m.Events) - 1; i >= 0 && len(events) < limit; i-- {
+		if keep(m.Events[i]) {
+			events = append(events, m.Events[i])
+		}
+	}
+	return events
+}
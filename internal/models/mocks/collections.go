@@ -0,0 +1,71 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"time"
+)
+
+var mockCollection = models.Collection{
+	Id:          1,
+	UserId:      1,
+	Name:        "Onboarding",
+	Description: "Everything a new starter needs",
+	Visibility:  "public",
+	Created:     time.Now(),
+}
+
+var mockPrivateCollection = models.Collection{
+	Id:          2,
+	UserId:      2,
+	Name:        "Incident runbooks",
+	Description: "Internal only",
+	Visibility:  "private",
+	Created:     time.Now(),
+}
+
+type CollectionModel struct{}
+
+func (m *CollectionModel) Insert(userId int, name, description, visibility string) (int, error) {
+	return 3, nil
+}
+
+func (m *CollectionModel) Get(id int) (models.Collection, error) {
+	switch id {
+	case 1:
+		return mockCollection, nil
+	case 2:
+		return mockPrivateCollection, nil
+	default:
+		return models.Collection{}, models.ErrNoRecord
+	}
+}
+
+func (m *CollectionModel) ForUser(userId int) ([]models.Collection, error) {
+	switch userId {
+	case 1:
+		return []models.Collection{mockCollection}, nil
+	case 2:
+		return []models.Collection{mockPrivateCollection}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *CollectionModel) Snippets(id int) ([]models.Snippet, error) {
+	return []models.Snippet{mockSnippet, mockGoSnippet}, nil
+}
+
+func (m *CollectionModel) AddSnippet(id int, snippetId string) error {
+	if _, err := (&SnippetModel{}).Get(snippetId, 0, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *CollectionModel) RemoveSnippet(id int, snippetId string) error {
+	return nil
+}
+
+func (m *CollectionModel) MoveSnippet(id int, snippetId string, offset int) error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"sync"
+	"time"
+)
+
+// ExportModel keeps exports in memory. It is safe to use from the background
+// goroutine that builds an archive.
+type ExportModel struct {
+	mu       sync.Mutex
+	exports  []models.AccountExport
+	archives map[int][]byte
+	Purged   int
+}
+
+func (m *ExportModel) Insert(userId int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := len(m.exports) + 1
+	m.exports = append(m.exports, models.AccountExport{Id: id, UserId: userId, Status: models.ExportPending, Created: time.Now()})
+	return id, nil
+}
+
+func (m *ExportModel) Complete(id int, archive []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.archives == nil {
+		m.archives = make(map[int][]byte)
+	}
+	m.archives[id] = archive
+	m.exports[id-1].Status = models.ExportReady
+	m.exports[id-1].Size = int64(len(archive))
+	return nil
+}
+
+func (m *ExportModel) Fail(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.exports[id-1].Status = models.ExportFailed
+	return nil
+}
+
+func (m *ExportModel) ForUser(userId int) ([]models.AccountExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var exports []models.AccountExport
+	for _, export := range m.exports {
+		if export.UserId == userId {
+			exports = append(exports, export)
+		}
+	}
+	return exports, nil
+}
+
+func (m *ExportModel) Archive(id, userId int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	archive, ok := m.archives[id]
+	if !ok || m.exports[id-1].UserId != userId {
+		return nil, models.ErrNoRecord
+	}
+	return archive, nil
+}
+
+// Purge keeps every export, it only counts the calls in Purged.
+func (m *ExportModel) Purge(maxAge, afterDownload time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Purged++
+	return nil
+}
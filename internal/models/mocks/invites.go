@@ -0,0 +1,46 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"time"
+)
+
+var mockInviteCode = models.InviteCode{
+	Id:        1,
+	Note:      "Conference attendees",
+	MaxUses:   5,
+	Uses:      2,
+	CreatedBy: "Ada Admin",
+	Created:   time.Now(),
+	UsedBy:    []string{"alice", "mod"},
+}
+
+// InviteCreate is what InviteModel.Insert was called with.
+type InviteCreate struct {
+	CreatedBy, MaxUses int
+	Note               string
+}
+
+// InviteModel records the codes created and revoked. New codes are always
+// ValidInviteCode.
+type InviteModel struct {
+	Inserted []InviteCreate
+	Revoked  []int
+}
+
+func (m *InviteModel) Insert(createdBy, maxUses int, note string) (string, error) {
+	m.Inserted = append(m.Inserted, InviteCreate{CreatedBy: createdBy, MaxUses: maxUses, Note: note})
+	return ValidInviteCode, nil
+}
+
+func (m *InviteModel) All() ([]models.InviteCode, error) {
+	return []models.InviteCode{mockInviteCode}, nil
+}
+
+func (m *InviteModel) Revoke(id int) error {
+	if id != mockInviteCode.Id {
+		return models.ErrNoRecord
+	}
+	m.Revoked = append(m.Revoked, id)
+	return nil
+}
@@ -0,0 +1,132 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"time"
+)
+
+var mockOrg = models.Org{
+	Id:      1,
+	Name:    "Platform Team",
+	Created: time.Now(),
+}
+
+// mockOrgMembers are the members of mockOrg: alice owns it and the admin has
+// joined as a plain member.
+var mockOrgMembers = map[int]models.OrgRole{
+	1: models.OrgRoleOwner,
+	3: models.OrgRoleMember,
+}
+
+// OrgInvite is what OrgModel.Invite was called with.
+type OrgInvite struct {
+	OrgId, InvitedBy int
+	Email            string
+	Role             models.OrgRole
+}
+
+// OrgModel records invitations and membership changes. The invitation token
+// "valid-org-token" invites mod@example.com to mockOrg.
+type OrgModel struct {
+	Invited  []OrgInvite
+	Roles    map[int]models.OrgRole
+	Removed  []int
+	Accepted []int
+}
+
+func (m *OrgModel) Insert(name string, ownerId int) (int, error) {
+	return 2, nil
+}
+
+func (m *OrgModel) Get(id, userId int) (models.Org, error) {
+	role, ok := mockOrgMembers[userId]
+	if id != mockOrg.Id || !ok {
+		return models.Org{}, models.ErrNoRecord
+	}
+	org := mockOrg
+	org.Role = role
+	return org, nil
+}
+
+func (m *OrgModel) ForUser(userId int) ([]models.Org, error) {
+	org, err := m.Get(mockOrg.Id, userId)
+	if err != nil {
+		return nil, nil
+	}
+	return []models.Org{org}, nil
+}
+
+func (m *OrgModel) Members(id int) ([]models.OrgMember, error) {
+	var members []models.OrgMember
+	for _, userId := range []int{1, 3} {
+		user := mockUsers[userId]
+		members = append(members, models.OrgMember{
+			UserId:   user.Id,
+			Name:     user.Name,
+			Username: user.Username,
+			Role:     mockOrgMembers[userId],
+			Joined:   time.Now(),
+		})
+	}
+	return members, nil
+}
+
+func (m *OrgModel) Snippets(id int) ([]models.Snippet, error) {
+	return []models.Snippet{mockOrgSnippet}, nil
+}
+
+func (m *OrgModel) SetRole(id, userId int, role models.OrgRole) error {
+	if _, ok := mockOrgMembers[userId]; !ok {
+		return models.ErrNoRecord
+	}
+	if userId == 1 && role != models.OrgRoleOwner {
+		return models.ErrLastOwner
+	}
+	if m.Roles == nil {
+		m.Roles = map[int]models.OrgRole{}
+	}
+	m.Roles[userId] = role
+	return nil
+}
+
+func (m *OrgModel) RemoveMember(id, userId int) error {
+	if _, ok := mockOrgMembers[userId]; !ok {
+		return models.ErrNoRecord
+	}
+	if userId == 1 {
+		return models.ErrLastOwner
+	}
+	m.Removed = append(m.Removed, userId)
+	return nil
+}
+
+func (m *OrgModel) Invite(id, invitedBy int, email string, role models.OrgRole, ttl time.Duration) (string, error) {
+	m.Invited = append(m.Invited, OrgInvite{OrgId: id, InvitedBy: invitedBy, Email: email, Role: role})
+	return "valid-org-token", nil
+}
+
+func (m *OrgModel) Invitations(id int) ([]models.OrgInvitation, error) {
+	return nil, nil
+}
+
+func (m *OrgModel) Invitation(token string) (models.OrgInvitation, error) {
+	if token != "valid-org-token" {
+		return models.OrgInvitation{}, models.ErrInvalidToken
+	}
+	return models.OrgInvitation{
+		OrgId:     mockOrg.Id,
+		OrgName:   mockOrg.Name,
+		Email:     "mod@example.com",
+		Role:      models.OrgRoleMember,
+		InvitedBy: mockUsers[1].Name,
+		Expiry:    time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (m *OrgModel) AcceptInvitation(token string, userId int) (int, error) {
+	if token != "valid-org-token" {
+		return 0, models.ErrInvalidToken
+	}
+	m.Accepted = append(m.Accepted, userId)
+	return mockOrg.Id, nil
+}
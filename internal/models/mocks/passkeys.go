@@ -0,0 +1,86 @@
+package mocks
+
+import (
+	"bytes"
+	"go-webserver/internal/models"
+	"sync"
+	"time"
+)
+
+// PasskeyModel keeps registered passkeys in memory so a test can register a
+// software authenticator and log in with it afterwards.
+type PasskeyModel struct {
+	mu       sync.Mutex
+	passkeys []models.Passkey
+}
+
+func (m *PasskeyModel) Insert(userId int, id []byte, name string, credential []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, passkey := range m.passkeys {
+		if bytes.Equal(passkey.Id, id) {
+			return models.ErrDuplicatePasskey
+		}
+	}
+	m.passkeys = append(m.passkeys, models.Passkey{Id: id, UserId: userId, Name: name, Credential: credential, Created: time.Now()})
+	return nil
+}
+
+func (m *PasskeyModel) ForUser(userId int) ([]models.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var passkeys []models.Passkey
+	for _, passkey := range m.passkeys {
+		if passkey.UserId == userId {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	return passkeys, nil
+}
+
+func (m *PasskeyModel) Rename(userId int, id []byte, name string) error {
+	return m.update(userId, id, func(passkey *models.Passkey) { passkey.Name = name })
+}
+
+func (m *PasskeyModel) Delete(userId int, id []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, passkey := range m.passkeys {
+		if passkey.UserId == userId && bytes.Equal(passkey.Id, id) {
+			m.passkeys = append(m.passkeys[:i], m.passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *PasskeyModel) Used(id []byte, credential []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.passkeys {
+		if bytes.Equal(m.passkeys[i].Id, id) {
+			now := time.Now()
+			m.passkeys[i].Credential = credential
+			m.passkeys[i].LastUsed = &now
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *PasskeyModel) update(userId int, id []byte, fn func(*models.Passkey)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.passkeys {
+		if m.passkeys[i].UserId == userId && bytes.Equal(m.passkeys[i].Id, id) {
+			fn(&m.passkeys[i])
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,55 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"time"
+)
+
+var mockReport = models.Report{
+	Id:           1,
+	SnippetId:    "snippet-123",
+	SnippetTitle: mockSnippet.Title,
+	Reason:       "spam",
+	Details:      "Same text over and over",
+	Status:       "open",
+	Created:      time.Now(),
+}
+
+type ReportModel struct{}
+
+func (m *ReportModel) Insert(snippetId, reason, details string) (int, error) {
+	return 2, nil
+}
+
+func (m *ReportModel) Get(id int) (models.Report, error) {
+	if id == mockReport.Id {
+		return mockReport, nil
+	}
+	return models.Report{}, models.ErrNoRecord
+}
+
+func (m *ReportModel) Open() ([]models.Report, error) {
+	return []models.Report{mockReport}, nil
+}
+
+func (m *ReportModel) Resolve(id, moderatorId int, action, reason string) error {
+	if id != mockReport.Id {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *ReportModel) Decisions(limit int) ([]models.ModerationDecision, error) {
+	return []models.ModerationDecision{
+		{
+			Id:          1,
+			ReportId:    3,
+			SnippetId:   "snippet-gone",
+			ModeratorId: 2,
+			Moderator:   "Mo Derator",
+			Action:      "delete",
+			Reason:      "Malware download link",
+			Created:     time.Now(),
+		},
+	}, nil
+}
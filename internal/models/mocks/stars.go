@@ -0,0 +1,50 @@
+package mocks
+
+import "sync"
+
+// StarModel keeps the stars in memory, alice has starred snippet-go from the
+// start.
+type StarModel struct {
+	mu    sync.Mutex
+	stars map[string]map[int]bool
+}
+
+func (m *StarModel) starsOf(snippetId string) map[int]bool {
+	if m.stars == nil {
+		m.stars = map[string]map[int]bool{mockGoSnippet.Id: {1: true}}
+	}
+	if m.stars[snippetId] == nil {
+		m.stars[snippetId] = make(map[int]bool)
+	}
+	return m.stars[snippetId]
+}
+
+func (m *StarModel) Star(snippetId string, userId int) error {
+	if _, err := (&SnippetModel{}).Get(snippetId, userId, true); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.starsOf(snippetId)[userId] = true
+	return nil
+}
+
+func (m *StarModel) Unstar(snippetId string, userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.starsOf(snippetId), userId)
+	return nil
+}
+
+func (m *StarModel) Starred(snippetId string, userId int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.starsOf(snippetId)[userId], nil
+}
+
+func (m *StarModel) Count(snippetId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.starsOf(snippetId)), nil
+}
@@ -0,0 +1,20 @@
+package mocks
+
+import "go-webserver/internal/models"
+
+type StatsModel struct{}
+
+func (m *StatsModel) Get() (models.Stats, error) {
+	return models.Stats{
+		Users:          len(mockUsers),
+		Snippets:       7,
+		ActiveSnippets: 6,
+		HiddenSnippets: 1,
+		OpenReports:    1,
+		ActiveSessions: 2,
+		Tables: []models.TableSize{
+			{Name: "snippets", Bytes: 81920},
+			{Name: "users", Bytes: 49152},
+		},
+	}, nil
+}
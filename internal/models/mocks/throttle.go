@@ -0,0 +1,86 @@
+package mocks
+
+import (
+	"go-webserver/internal/models"
+	"sync"
+	"time"
+)
+
+// LoginThrottleModel counts failed logins in memory. Tests can Set a key to
+// start from an earlier state.
+type LoginThrottleModel struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+}
+
+func (m *LoginThrottleModel) Set(attempts models.LoginAttempts) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.attempts == nil {
+		m.attempts = make(map[string]models.LoginAttempts)
+	}
+	m.attempts[attempts.Key] = attempts
+}
+
+func (m *LoginThrottleModel) Get(keys ...string) ([]models.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var attempts []models.LoginAttempts
+	for _, key := range keys {
+		if a, ok := m.attempts[key]; ok {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts, nil
+}
+
+func (m *LoginThrottleModel) Fail(key string, window time.Duration) (models.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.attempts == nil {
+		m.attempts = make(map[string]models.LoginAttempts)
+	}
+
+	a, ok := m.attempts[key]
+	if !ok || time.Since(a.LastFailure) > window {
+		a = models.LoginAttempts{Key: key}
+	}
+	a.Failures++
+	a.LastFailure = time.Now()
+	m.attempts[key] = a
+	return a, nil
+}
+
+func (m *LoginThrottleModel) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *LoginThrottleModel) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok && a.Failures > 0 {
+		a.Failures--
+		m.attempts[key] = a
+	}
+	return nil
+}
+
+func (m *LoginThrottleModel) Purge(window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, a := range m.attempts {
+		if time.Since(a.LastFailure) > window {
+			delete(m.attempts, key)
+		}
+	}
+	return nil
+}
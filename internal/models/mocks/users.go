@@ -1,42 +1,135 @@
 package mocks
 
 import (
+	"fmt"
 	"go-webserver/internal/models"
+	"go-webserver/internal/totp"
+	"strings"
+	"sync"
+	"time"
 )
 
-type UserModel struct{}
+var mockUsers = map[int]models.UsersNoPassword{
+	1: {Id: 1, Name: "Alice Jones", Username: "alice", Email: "alice@example.com", Created: time.Now(), Role: models.RoleUser, Verified: true},
+	2: {Id: 2, Name: "Mo Derator", Username: "mod", Email: "mod@example.com", Created: time.Now(), Role: models.RoleModerator, Verified: true},
+	3: {Id: 3, Name: "Ada Admin", Username: "admin", Email: "admin@example.com", Created: time.Now(), Role: models.RoleAdmin, Verified: true},
+	4: {Id: 4, Name: "Dee Sabled", Username: "disabled", Email: "disabled@example.com", Created: time.Now(), Role: models.RoleUser, Disabled: true, Verified: true},
+	5: {Id: 5, Name: "Reese Etter", Username: "reset", Email: "reset@example.com", Created: time.Now(), Role: models.RoleUser, PasswordResetRequired: true, Verified: true},
+	6: {Id: 6, Name: "Una Verified", Username: "unverified", Email: "unverified@example.com", Created: time.Now(), Role: models.RoleUser},
+	7: {Id: 7, Name: "Otto Pee", Username: "totp", Email: "totp@example.com", Created: time.Now(), Role: models.RoleUser, Verified: true, TOTPEnabled: true},
+	8: {Id: 8, Name: "Ann Roll", Username: "enroll", Email: "enroll@example.com", Created: time.Now(), Role: models.RoleModerator, Verified: true, TOTPRequired: true},
+}
+
+// TOTPSecret is the authenticator secret of totp@example.com and
+// RecoveryCode one of its recovery codes. ValidInviteCode is the only invite
+// code that can still be used.
+const (
+	TOTPSecret      = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	RecoveryCode    = "abcde-fghij"
+	ValidInviteCode = "valid-invite"
+)
+
+// UserModel remembers when verification emails were claimed so the resend rate
+// limit can be tested, and the users created by single sign-on.
+type UserModel struct {
+	mu               sync.Mutex
+	verificationSent map[int]time.Time
+	requireTOTP      map[models.Role]bool
+	ssoUsers         map[int]models.UsersNoPassword
+
+	// EmailChanges are the addresses CreateEmailChange issued a token for.
+	EmailChanges []string
+}
+
+// Insert gives every new user the id 9.
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	if _, ok := byUsername(username); ok {
+		return 0, models.ErrDuplicateUsername
+	}
 
-func (m *UserModel) Insert(name, email, password string) error {
 	switch email {
 	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	default:
-		return nil
+		return 9, nil
 	}
 }
 
+// InsertInvited accepts ValidInviteCode as the only usable invite code.
+func (m *UserModel) InsertInvited(name, username, email, password, code string) (int, error) {
+	if code != ValidInviteCode {
+		return 0, models.ErrInvalidInvite
+	}
+	return m.Insert(name, username, email, password)
+}
+
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	if email == "alice@example.com" && password == "pa$$word" {
 		return 1, nil
 	}
+	if email == "mod@example.com" && password == "pa$$word" {
+		return 2, nil
+	}
+	if email == "admin@example.com" && password == "pa$$word" {
+		return 3, nil
+	}
+	if email == "disabled@example.com" && password == "pa$$word" {
+		return 0, models.ErrAccountDisabled
+	}
+	if email == "reset@example.com" && password == "pa$$word" {
+		return 5, nil
+	}
+	if email == "unverified@example.com" && password == "pa$$word" {
+		return 6, nil
+	}
+	if email == "totp@example.com" && password == "pa$$word" {
+		return 7, nil
+	}
+	if email == "enroll@example.com" && password == "pa$$word" {
+		return 8, nil
+	}
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2, 3, 4, 5, 6, 7, 8:
 		return true, nil
 	default:
-		return false, nil
+		_, ok := m.ssoUser(id)
+		return ok, nil
 	}
 }
 
 func (m *UserModel) Get(id int) (models.UsersNoPassword, error) {
-	return models.UsersNoPassword{}, nil
+	user, ok := mockUsers[id]
+	if !ok {
+		user, ok = m.ssoUser(id)
+	}
+	if !ok {
+		return models.UsersNoPassword{}, models.ErrNoRecord
+	}
+	return user, nil
+}
+
+func (m *UserModel) GetByEmail(email string) (models.UsersNoPassword, error) {
+	user, ok := byEmail(email)
+	if !ok {
+		return models.UsersNoPassword{}, models.ErrNoRecord
+	}
+	return user, nil
+}
+
+func (m *UserModel) GetByUsername(username string) (models.UsersNoPassword, error) {
+	user, ok := byUsername(username)
+	if !ok {
+		return models.UsersNoPassword{}, models.ErrNoRecord
+	}
+	return user, nil
 }
 
 func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
-	if id == 1 {
+	if id == 1 || id == 5 {
 		if currentPassword != "pa$$word" {
 			return models.ErrInvalidCredentials
 		}
@@ -44,3 +137,262 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 	}
 	return models.ErrNoRecord
 }
+
+func (m *UserModel) Search(query string, limit int) ([]models.UsersNoPassword, error) {
+	var users []models.UsersNoPassword
+	for id := 1; id <= len(mockUsers) && len(users) < limit; id++ {
+		user := mockUsers[id]
+		if strings.Contains(strings.ToLower(user.Name), strings.ToLower(query)) ||
+			strings.Contains(strings.ToLower(user.Email), strings.ToLower(query)) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *UserModel) SetRole(id int, role models.Role) error {
+	return m.exists(id)
+}
+
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	return m.exists(id)
+}
+
+// RequirePasswordReset hands out the token ResetPassword takes, whoever the
+// user is.
+func (m *UserModel) RequirePasswordReset(id int, ttl time.Duration) (string, error) {
+	if err := m.exists(id); err != nil {
+		return "", err
+	}
+	return "valid-reset-token", nil
+}
+
+func (m *UserModel) exists(id int) error {
+	if _, ok := mockUsers[id]; !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) Delete(id int, password string, keepSnippets bool) error {
+	if err := m.exists(id); err != nil {
+		return err
+	}
+	if password != "pa$$word" {
+		return models.ErrInvalidCredentials
+	}
+	if mockOrgMembers[id] == models.OrgRoleOwner {
+		return models.ErrLastOwner
+	}
+	return nil
+}
+
+func (m *UserModel) Verify(id int, email string) error {
+	if user, ok := byEmail(email); !ok || user.Id != id {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) ClaimVerificationEmail(id int, interval time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mockUsers[id].Verified {
+		return false, nil
+	}
+	if m.verificationSent == nil {
+		m.verificationSent = make(map[int]time.Time)
+	}
+	if sent, ok := m.verificationSent[id]; ok && time.Since(sent) < interval {
+		return false, nil
+	}
+	m.verificationSent[id] = time.Now()
+	return true, nil
+}
+
+// CreatePasswordReset hands out the same token for every known account.
+func (m *UserModel) CreatePasswordReset(email string, ttl time.Duration) (string, error) {
+	if _, ok := byEmail(email); !ok {
+		return "", models.ErrNoRecord
+	}
+	return "valid-reset-token", nil
+}
+
+// GetByResetToken finds reset@example.com by the token ResetPassword takes.
+func (m *UserModel) GetByResetToken(token string) (models.UsersNoPassword, error) {
+	if token != "valid-reset-token" {
+		return models.UsersNoPassword{}, models.ErrInvalidToken
+	}
+	return mockUsers[5], nil
+}
+
+// ResetPassword resets the password of reset@example.com.
+func (m *UserModel) ResetPassword(token, newPassword string) (int, error) {
+	if token != "valid-reset-token" {
+		return 0, models.ErrInvalidToken
+	}
+	return 5, nil
+}
+
+func (m *UserModel) UpdateProfile(id int, name, username string) error {
+	if err := m.exists(id); err != nil {
+		return err
+	}
+	if user, ok := byUsername(username); ok && user.Id != id {
+		return models.ErrDuplicateUsername
+	}
+	return nil
+}
+
+// CreateEmailChange hands out the same token for every free address.
+func (m *UserModel) CreateEmailChange(id int, password, newEmail string, ttl time.Duration) (string, error) {
+	if password != "pa$$word" {
+		return "", models.ErrInvalidCredentials
+	}
+	if _, ok := byEmail(newEmail); ok || newEmail == "dupe@example.com" {
+		return "", models.ErrDuplicateEmail
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.EmailChanges = append(m.EmailChanges, newEmail)
+	return "valid-email-token", nil
+}
+
+// ChangeEmail moves alice to alice@new.example.com for valid-email-token.
+// taken-email-token stands for an address someone else took since.
+func (m *UserModel) ChangeEmail(token string, sessionId int) (models.EmailChange, error) {
+	switch token {
+	case "valid-email-token":
+		return models.EmailChange{UserId: 1, Name: "Alice Jones", OldEmail: "alice@example.com", NewEmail: "alice@new.example.com"}, nil
+	case "taken-email-token":
+		return models.EmailChange{}, models.ErrDuplicateEmail
+	default:
+		return models.EmailChange{}, models.ErrInvalidToken
+	}
+}
+
+// SSOLogin links identities by email to the fixed users and creates anyone
+// else from id 100 onwards, if create is set.
+func (m *UserModel) SSOLogin(issuer, subject, email, name string, create bool) (int, error) {
+	email = models.NormalizeEmail(email)
+	if user, ok := byEmail(email); ok {
+		if !user.Verified {
+			return 0, models.ErrUnverifiedAccount
+		}
+		return user.Id, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ssoUsers == nil {
+		m.ssoUsers = make(map[int]models.UsersNoPassword)
+	}
+	for _, user := range m.ssoUsers {
+		if user.Email == email {
+			return user.Id, nil
+		}
+	}
+	if !create {
+		return 0, models.ErrNoRecord
+	}
+
+	id := 100 + len(m.ssoUsers)
+	m.ssoUsers[id] = models.UsersNoPassword{Id: id, Name: name, Username: fmt.Sprintf("%s%d", models.SSOUsernamePrefix, id), Email: email, Created: time.Now(), Role: models.RoleUser, Verified: true}
+	return id, nil
+}
+
+func (m *UserModel) ssoUser(id int) (models.UsersNoPassword, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.ssoUsers[id]
+	return user, ok
+}
+
+func byEmail(email string) (models.UsersNoPassword, bool) {
+	email = models.NormalizeEmail(email)
+	for _, user := range mockUsers {
+		if user.Email == email {
+			return user, true
+		}
+	}
+	return models.UsersNoPassword{}, false
+}
+
+func byUsername(username string) (models.UsersNoPassword, bool) {
+	for _, user := range mockUsers {
+		if user.Username == username {
+			return user, true
+		}
+	}
+	return models.UsersNoPassword{}, false
+}
+
+func (m *UserModel) EnableTOTP(id int, secret string) ([]string, error) {
+	if err := m.exists(id); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 10)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("code%d-mock%d", i, i)
+	}
+	return codes, nil
+}
+
+func (m *UserModel) DisableTOTP(id int, password string) error {
+	if password != "pa$$word" {
+		return models.ErrInvalidCredentials
+	}
+	return m.exists(id)
+}
+
+func (m *UserModel) ValidateTOTP(id int, code string) (bool, error) {
+	if !mockUsers[id].TOTPEnabled {
+		return false, nil
+	}
+	_, ok := totp.Match(TOTPSecret, code, time.Now())
+	return ok, nil
+}
+
+func (m *UserModel) UseRecoveryCode(id int, code string) (bool, error) {
+	return mockUsers[id].TOTPEnabled && code == RecoveryCode, nil
+}
+
+func (m *UserModel) RecoveryCodesLeft(id int) (int, error) {
+	if !mockUsers[id].TOTPEnabled {
+		return 0, nil
+	}
+	return 7, nil
+}
+
+func (m *UserModel) RegenerateRecoveryCodes(id int, password string) ([]string, error) {
+	if password != "pa$$word" {
+		return nil, models.ErrInvalidCredentials
+	}
+	return m.EnableTOTP(id, TOTPSecret)
+}
+
+func (m *UserModel) RoleSettings() ([]models.RoleSetting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var settings []models.RoleSetting
+	for _, role := range models.Roles {
+		settings = append(settings, models.RoleSetting{Role: role, RequireTOTP: m.requireTOTP[role]})
+	}
+	return settings, nil
+}
+
+func (m *UserModel) SetRoleRequiresTOTP(role models.Role, required bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.requireTOTP == nil {
+		m.requireTOTP = make(map[models.Role]bool)
+	}
+	m.requireTOTP[role] = required
+	return nil
+}
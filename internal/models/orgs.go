@@ -0,0 +1,333 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OrgRole is what a member may do in an organization. Owners manage the
+// members, everyone can see and edit the organization's snippets.
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "owner"
+	OrgRoleMember OrgRole = "member"
+)
+
+var OrgRoles = []OrgRole{OrgRoleOwner, OrgRoleMember}
+
+// Org is an organization as seen by one of its members, Role is theirs.
+type Org struct {
+	Id      int       `db:"id"`
+	Name    string    `db:"name"`
+	Created time.Time `db:"created"`
+	Role    OrgRole   `db:"role"`
+}
+
+type OrgMember struct {
+	UserId   int       `db:"user_id"`
+	Name     string    `db:"name"`
+	Username string    `db:"username"`
+	Role     OrgRole   `db:"role"`
+	Joined   time.Time `db:"joined"`
+}
+
+type OrgInvitation struct {
+	OrgId     int       `db:"org_id"`
+	OrgName   string    `db:"org_name"`
+	Email     string    `db:"email"`
+	Role      OrgRole   `db:"role"`
+	InvitedBy string    `db:"invited_by"`
+	Expiry    time.Time `db:"expiry"`
+}
+
+type OrgModelInterface interface {
+	Insert(name string, ownerId int) (int, error)
+	Get(id, userId int) (Org, error)
+	ForUser(userId int) ([]Org, error)
+	Members(id int) ([]OrgMember, error)
+	Snippets(id int) ([]Snippet, error)
+	SetRole(id, userId int, role OrgRole) error
+	RemoveMember(id, userId int) error
+	Invite(id, invitedBy int, email string, role OrgRole, ttl time.Duration) (string, error)
+	Invitations(id int) ([]OrgInvitation, error)
+	Invitation(token string) (OrgInvitation, error)
+	AcceptInvitation(token string, userId int) (int, error)
+}
+
+type OrgModel struct {
+	Pool *pgxpool.Pool
+}
+
+// Insert creates an organization with ownerId as its first owner.
+func (m *OrgModel) Insert(name string, ownerId int) (int, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	query := `INSERT INTO orgs (name, created) VALUES (@name, @created) RETURNING id`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"name": name, "created": time.Now()}).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `INSERT INTO org_members (org_id, user_id, role, joined) VALUES (@id, @userId, @role, @joined)`
+	_, err = tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "userId": ownerId, "role": OrgRoleOwner, "joined": time.Now()})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
+
+// Get returns the organization if userId is one of its members, otherwise
+// ErrNoRecord, so outsiders can't tell it exists.
+func (m *OrgModel) Get(id, userId int) (Org, error) {
+	query := `SELECT o.id, o.name, o.created, om.role FROM orgs o
+	JOIN org_members om ON om.org_id = o.id
+	WHERE o.id = @id AND om.user_id = @userId`
+	args := pgx.NamedArgs{
+		"id":     id,
+		"userId": userId,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return Org{}, err
+	}
+
+	org, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Org])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Org{}, ErrNoRecord
+		}
+		return Org{}, err
+	}
+
+	return org, nil
+}
+
+func (m *OrgModel) ForUser(userId int) ([]Org, error) {
+	query := `SELECT o.id, o.name, o.created, om.role FROM orgs o
+	JOIN org_members om ON om.org_id = o.id
+	WHERE om.user_id = @userId ORDER BY o.name`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Org])
+}
+
+func (m *OrgModel) Members(id int) ([]OrgMember, error) {
+	query := `SELECT om.user_id, u.name, u.username, om.role, om.joined FROM org_members om
+	JOIN users u ON u.id = om.user_id
+	WHERE om.org_id = @id ORDER BY om.role DESC, u.name`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[OrgMember])
+}
+
+// Snippets returns the organization's unexpired snippets, newest first.
+func (m *OrgModel) Snippets(id int) ([]Snippet, error) {
+	query := `SELECT * FROM snippets WHERE org_id = @id AND expires > CURRENT_TIMESTAMP AND NOT hidden
+	ORDER BY created_at DESC`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+}
+
+// SetRole changes the role of a member. The last owner can't step down, that
+// would leave nobody to manage the organization.
+func (m *OrgModel) SetRole(id, userId int, role OrgRole) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE org_members SET role = @role WHERE org_id = @id AND user_id = @userId`
+	commandTag, err := tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "userId": userId, "role": role})
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	err = requireOwner(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RemoveMember takes a user out of the organization, the snippets they
+// created stay with it. Removing the last owner gives ErrLastOwner.
+func (m *OrgModel) RemoveMember(id, userId int) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM org_members WHERE org_id = @id AND user_id = @userId`
+	commandTag, err := tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "userId": userId})
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	err = requireOwner(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// requireOwner fails with ErrLastOwner when the organization has no owner
+// left. The rows are locked so two owners can't demote each other at once.
+func requireOwner(ctx context.Context, tx pgx.Tx, id int) error {
+	query := `SELECT user_id FROM org_members WHERE org_id = @id AND role = @role FOR UPDATE`
+	rows, err := tx.Query(ctx, query, pgx.NamedArgs{"id": id, "role": OrgRoleOwner})
+	if err != nil {
+		return err
+	}
+
+	owners, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+	if len(owners) == 0 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+// Invite stores the hash of a new single-use token that lets the owner of
+// email join the organization with role, and returns the token itself.
+func (m *OrgModel) Invite(id, invitedBy int, email string, role OrgRole, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO org_invitations (token_hash, org_id, email, role, invited_by, expiry)
+	VALUES (@hash, @id, @email, @role, @invitedBy, @expiry)`
+	args := pgx.NamedArgs{
+		"hash":      hash,
+		"id":        id,
+		"email":     email,
+		"role":      role,
+		"invitedBy": invitedBy,
+		"expiry":    time.Now().Add(ttl),
+	}
+
+	_, err = m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+const orgInvitationColumns = `i.org_id, o.name AS org_name, i.email, i.role, u.name AS invited_by, i.expiry`
+
+// Invitations returns the pending invitations of the organization.
+func (m *OrgModel) Invitations(id int) ([]OrgInvitation, error) {
+	query := `SELECT ` + orgInvitationColumns + ` FROM org_invitations i
+	JOIN orgs o ON o.id = i.org_id
+	JOIN users u ON u.id = i.invited_by
+	WHERE i.org_id = @id AND i.expiry > CURRENT_TIMESTAMP ORDER BY i.expiry`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[OrgInvitation])
+}
+
+// Invitation looks up an unused, unexpired invitation without using it up.
+func (m *OrgModel) Invitation(token string) (OrgInvitation, error) {
+	query := `SELECT ` + orgInvitationColumns + ` FROM org_invitations i
+	JOIN orgs o ON o.id = i.org_id
+	JOIN users u ON u.id = i.invited_by
+	WHERE i.token_hash = @hash AND i.expiry > CURRENT_TIMESTAMP`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"hash": hashToken(token)})
+	if err != nil {
+		return OrgInvitation{}, err
+	}
+
+	invitation, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[OrgInvitation])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return OrgInvitation{}, ErrInvalidToken
+		}
+		return OrgInvitation{}, err
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation uses up an invitation and makes userId a member, and
+// returns the organization's id. Users who already are members keep their
+// role. Unknown, used and expired tokens give ErrInvalidToken.
+func (m *OrgModel) AcceptInvitation(token string, userId int) (int, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	var role OrgRole
+	query := `DELETE FROM org_invitations WHERE token_hash = @hash AND expiry > CURRENT_TIMESTAMP
+	RETURNING org_id, role`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"hash": hashToken(token)}).Scan(&id, &role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidToken
+		}
+		return 0, err
+	}
+
+	query = `INSERT INTO org_members (org_id, user_id, role, joined) VALUES (@id, @userId, @role, @joined)
+	ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "userId": userId, "role": role, "joined": time.Now()})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
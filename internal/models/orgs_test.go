@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"go-webserver/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestOrgSnippetVisibility(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	orgs := OrgModel{Pool: db}
+	snippets := SnippetModel{Pool: db}
+	users := UserModel{Pool: db}
+
+	orgId, err := orgs.Insert("Platform Team", 1)
+	assert.NilError(t, err)
+
+	id, err := snippets.Insert(SnippetRequest{Title: "Runbook", Content: "Restart the worker", Expires: 7, UserId: 1, OrgId: orgId})
+	assert.NilError(t, err)
+
+	_, err = snippets.Get(id, 1, false)
+	assert.NilError(t, err)
+
+	_, err = snippets.Get(id, 0, false)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	bobId, err := users.Insert("Bob Brown", "bob", "bob@example.com", "new-Lantern-42")
+	assert.NilError(t, err)
+
+	_, err = snippets.Get(id, bobId, false)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	token, err := orgs.Invite(orgId, 1, "bob@example.com", OrgRoleMember, time.Hour)
+	assert.NilError(t, err)
+	joined, err := orgs.AcceptInvitation(token, bobId)
+	assert.NilError(t, err)
+	assert.Equal(t, joined, orgId)
+
+	_, err = orgs.AcceptInvitation(token, bobId)
+	assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+
+	_, err = snippets.Get(id, bobId, false)
+	assert.NilError(t, err)
+
+	err = orgs.RemoveMember(orgId, 1)
+	assert.Equal(t, errors.Is(err, ErrLastOwner), true)
+	err = orgs.SetRole(orgId, 1, OrgRoleMember)
+	assert.Equal(t, errors.Is(err, ErrLastOwner), true)
+	err = users.Delete(1, "pa$$word", true)
+	assert.Equal(t, errors.Is(err, ErrLastOwner), true)
+
+	latest, err := snippets.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(latest), 0)
+}
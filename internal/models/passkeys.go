@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Passkey is a WebAuthn credential registered by a user. Credential holds the
+// credential record as JSON, it is only interpreted by the web layer.
+type Passkey struct {
+	Id         []byte     `db:"id"`
+	UserId     int        `db:"user_id"`
+	Name       string     `db:"name"`
+	Credential []byte     `db:"credential"`
+	Created    time.Time  `db:"created"`
+	LastUsed   *time.Time `db:"last_used"`
+}
+
+type PasskeyModelInterface interface {
+	Insert(userId int, id []byte, name string, credential []byte) error
+	ForUser(userId int) ([]Passkey, error)
+	Rename(userId int, id []byte, name string) error
+	Delete(userId int, id []byte) error
+	Used(id []byte, credential []byte) error
+}
+
+type PasskeyModel struct {
+	Pool *pgxpool.Pool
+}
+
+func (m *PasskeyModel) Insert(userId int, id []byte, name string, credential []byte) error {
+	query := `INSERT INTO passkeys(id, user_id, name, credential, created)
+	VALUES (@id, @userId, @name, @credential, @created)`
+	args := pgx.NamedArgs{
+		"id":         id,
+		"userId":     userId,
+		"name":       name,
+		"credential": credential,
+		"created":    time.Now(),
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrDuplicatePasskey
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (m *PasskeyModel) ForUser(userId int) ([]Passkey, error) {
+	query := `SELECT id, user_id, name, credential, created, last_used FROM passkeys
+	WHERE user_id = @userId ORDER BY created`
+	args := pgx.NamedArgs{
+		"userId": userId,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Passkey])
+}
+
+func (m *PasskeyModel) Rename(userId int, id []byte, name string) error {
+	query := `UPDATE passkeys SET name = @name WHERE id = @id AND user_id = @userId`
+	return m.exec(query, pgx.NamedArgs{"id": id, "userId": userId, "name": name})
+}
+
+func (m *PasskeyModel) Delete(userId int, id []byte) error {
+	query := `DELETE FROM passkeys WHERE id = @id AND user_id = @userId`
+	return m.exec(query, pgx.NamedArgs{"id": id, "userId": userId})
+}
+
+// Used stores the credential record after a login, its sign counter moves on
+// with every use.
+func (m *PasskeyModel) Used(id []byte, credential []byte) error {
+	query := `UPDATE passkeys SET credential = @credential, last_used = CURRENT_TIMESTAMP WHERE id = @id`
+	return m.exec(query, pgx.NamedArgs{"id": id, "credential": credential})
+}
+
+func (m *PasskeyModel) exec(query string, args pgx.NamedArgs) error {
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// EmailChange is a confirmed change of a user's email address.
+type EmailChange struct {
+	UserId   int
+	Name     string
+	OldEmail string
+	NewEmail string
+}
+
+// UpdateProfile sets the display name and username. A username that is
+// already taken gives ErrDuplicateUsername.
+func (m *UserModel) UpdateProfile(id int, name, username string) error {
+	query := `UPDATE users SET name = @name, username = @username WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":       id,
+		"name":     name,
+		"username": username,
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return duplicateError(pgErr)
+		}
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// CreateEmailChange stores the hash of a new single-use token that moves the
+// user to newEmail, and returns the token itself. Only the latest token of a
+// user is valid. The user's current password must be given, otherwise
+// ErrInvalidCredentials is returned. An address that is already in use gives
+// ErrDuplicateEmail.
+func (m *UserModel) CreateEmailChange(id int, password, newEmail string, ttl time.Duration) (string, error) {
+	ctx := context.Background()
+	newEmail = NormalizeEmail(newEmail)
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	err = m.checkPassword(ctx, tx, id, password)
+	if err != nil {
+		return "", err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT true FROM users WHERE email = @email)`, pgx.NamedArgs{"email": newEmail}).Scan(&exists)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", ErrDuplicateEmail
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM email_changes WHERE user_id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return "", err
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO email_changes(token_hash, user_id, new_email, expiry)
+	VALUES (@hash, @id, @email, @expiry)`
+	args := pgx.NamedArgs{
+		"hash":   hash,
+		"id":     id,
+		"email":  newEmail,
+		"expiry": time.Now().Add(ttl),
+	}
+
+	_, err = tx.Exec(ctx, query, args)
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit(ctx)
+}
+
+// ChangeEmail uses up an email change token and moves the user to the new
+// address, which counts as verified since the token was mailed there. Password
+// reset links sent to the old address stop working, and the user is signed out
+// everywhere but the session sessionId, 0 for none. Unknown, used and expired
+// tokens give ErrInvalidToken, and ErrDuplicateEmail means someone else took
+// the address in the meantime.
+func (m *UserModel) ChangeEmail(token string, sessionId int) (EmailChange, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return EmailChange{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var change EmailChange
+	query := `DELETE FROM email_changes WHERE token_hash = @hash AND expiry > CURRENT_TIMESTAMP
+	RETURNING user_id, new_email`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"hash": hashToken(token)}).Scan(&change.UserId, &change.NewEmail)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return EmailChange{}, ErrInvalidToken
+		}
+		return EmailChange{}, err
+	}
+
+	query = `SELECT name, email FROM users WHERE id = @id FOR UPDATE`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"id": change.UserId}).Scan(&change.Name, &change.OldEmail)
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	query = `UPDATE users SET email = @email, verified = true WHERE id = @id`
+	_, err = tx.Exec(ctx, query, pgx.NamedArgs{"id": change.UserId, "email": change.NewEmail})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return EmailChange{}, ErrDuplicateEmail
+		}
+		return EmailChange{}, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM password_resets WHERE user_id = @id`, pgx.NamedArgs{"id": change.UserId})
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	err = revokeOtherSessions(ctx, tx, change.UserId, sessionId)
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	return change, tx.Commit(ctx)
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Report struct {
+	Id           int       `db:"id"`
+	SnippetId    string    `db:"snippet_id"`
+	SnippetTitle string    `db:"snippet_title"`
+	Reason       string    `db:"reason"`
+	Details      string    `db:"details"`
+	Status       string    `db:"status"`
+	Created      time.Time `db:"created"`
+}
+
+// ModerationDecision is the permanent record of how a moderator dealt with a
+// report. It outlives the snippet, so it only keeps the snippet's id.
+type ModerationDecision struct {
+	Id          int       `db:"id"`
+	ReportId    int       `db:"report_id"`
+	SnippetId   string    `db:"snippet_id"`
+	ModeratorId int       `db:"moderator_id"`
+	Moderator   string    `db:"moderator"`
+	Action      string    `db:"action"`
+	Reason      string    `db:"reason"`
+	Created     time.Time `db:"created"`
+}
+
+var ReportReasons = []string{"spam", "abuse", "illegal", "malware", "personal-data", "other"}
+
+var ModerationActions = []string{"hide", "delete", "dismiss"}
+
+type ReportModelInterface interface {
+	Insert(snippetId, reason, details string) (int, error)
+	Get(id int) (Report, error)
+	Open() ([]Report, error)
+	Resolve(id, moderatorId int, action, reason string) error
+	Decisions(limit int) ([]ModerationDecision, error)
+}
+
+type ReportModel struct {
+	Pool *pgxpool.Pool
+}
+
+func (m *ReportModel) Insert(snippetId, reason, details string) (int, error) {
+	query := `INSERT INTO reports (snippet_id, reason, details, status, created)
+	VALUES (@snippetId, @reason, @details, 'open', @created) RETURNING id`
+	args := pgx.NamedArgs{
+		"snippetId": snippetId,
+		"reason":    reason,
+		"details":   details,
+		"created":   time.Now(),
+	}
+
+	var id int
+	err := m.Pool.QueryRow(context.Background(), query, args).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *ReportModel) Get(id int) (Report, error) {
+	query := `SELECT r.id, r.snippet_id, COALESCE(s.title, '') AS snippet_title, r.reason, r.details, r.status, r.created
+	FROM reports r LEFT JOIN snippets s ON s.id = r.snippet_id WHERE r.id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Report])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Report{}, ErrNoRecord
+		}
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// Open returns the moderation queue, oldest report first.
+func (m *ReportModel) Open() ([]Report, error) {
+	query := `SELECT r.id, r.snippet_id, COALESCE(s.title, '') AS snippet_title, r.reason, r.details, r.status, r.created
+	FROM reports r LEFT JOIN snippets s ON s.id = r.snippet_id WHERE r.status = 'open' ORDER BY r.created`
+
+	rows, err := m.Pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Report])
+}
+
+// Resolve applies a moderator's decision to a report and records it. Hiding or
+// deleting a snippet closes every open report about it, dismissing only
+// closes the given one.
+func (m *ReportModel) Resolve(id, moderatorId int, action, reason string) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var snippetId string
+	query := `SELECT snippet_id FROM reports WHERE id = @id AND status = 'open' FOR UPDATE`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"id": id}).Scan(&snippetId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	args := pgx.NamedArgs{
+		"id":          id,
+		"snippetId":   snippetId,
+		"moderatorId": moderatorId,
+		"action":      action,
+		"reason":      reason,
+		"created":     time.Now(),
+	}
+
+	switch action {
+	case "hide":
+		_, err = tx.Exec(ctx, `UPDATE snippets SET hidden = true WHERE id = @snippetId`, args)
+	case "delete":
+		_, err = tx.Exec(ctx, `DELETE FROM snippets WHERE id = @snippetId`, args)
+	case "dismiss":
+	default:
+		return errors.New("models: unknown moderation action")
+	}
+	if err != nil {
+		return err
+	}
+
+	if action == "dismiss" {
+		query = `UPDATE reports SET status = 'dismissed' WHERE id = @id`
+	} else {
+		query = `UPDATE reports SET status = 'resolved' WHERE snippet_id = @snippetId AND status = 'open'`
+	}
+	_, err = tx.Exec(ctx, query, args)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO moderation_decisions (report_id, snippet_id, moderator_id, action, reason, created)
+	VALUES (@id, @snippetId, @moderatorId, @action, @reason, @created)`
+	_, err = tx.Exec(ctx, query, args)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Decisions returns the most recent moderation decisions, newest first.
+func (m *ReportModel) Decisions(limit int) ([]ModerationDecision, error) {
+	query := `SELECT d.id, d.report_id, d.snippet_id, COALESCE(d.moderator_id, 0) AS moderator_id,
+	COALESCE(u.name, '(deleted user)') AS moderator, d.action, d.reason, d.created
+	FROM moderation_decisions d LEFT JOIN users u ON u.id = d.moderator_id ORDER BY d.created DESC LIMIT @limit`
+	args := pgx.NamedArgs{
+		"limit": limit,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[ModerationDecision])
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Session describes a login. Its id is kept in the scs session data, and the
+// web layer treats a session whose record is gone as logged out. The record
+// also holds the scs token, so revoking it can delete the session itself.
+type Session struct {
+	Id       int       `db:"id"`
+	UserId   int       `db:"user_id"`
+	Device   string    `db:"device"`
+	IP       string    `db:"ip"`
+	Created  time.Time `db:"created"`
+	LastSeen time.Time `db:"last_seen"`
+}
+
+// touchInterval is how stale last_seen may get before Touch writes it again,
+// so a burst of requests doesn't turn into a burst of updates.
+const touchInterval = time.Minute
+
+type SessionModelInterface interface {
+	Insert(userId int, token, device, ip string) (int, error)
+	Touch(id, userId int, token, ip string) (bool, error)
+	ForUser(userId int, lifetime time.Duration) ([]Session, error)
+	Revoke(id, userId int) error
+	RevokeOthers(id, userId int) error
+}
+
+type SessionModel struct {
+	Pool *pgxpool.Pool
+}
+
+// Insert records a login. token is the scs session token, revoking the record
+// deletes that session too.
+func (m *SessionModel) Insert(userId int, token, device, ip string) (int, error) {
+	query := `INSERT INTO user_sessions(user_id, token, device, ip, created, last_seen)
+	VALUES (@userId, @token, @device, @ip, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	RETURNING id`
+	args := pgx.NamedArgs{
+		"userId": userId,
+		"token":  token,
+		"device": device,
+		"ip":     ip,
+	}
+
+	var id int
+	err := m.Pool.QueryRow(context.Background(), query, args).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Touch marks the session as seen just now from ip with the scs token it has
+// now. It only writes when something changed or last_seen is more than
+// touchInterval old, and reports false when the session has been revoked.
+func (m *SessionModel) Touch(id, userId int, token, ip string) (bool, error) {
+	query := `WITH s AS (
+		SELECT id FROM user_sessions WHERE id = @id AND user_id = @userId
+	), touched AS (
+		UPDATE user_sessions SET last_seen = CURRENT_TIMESTAMP, ip = @ip, token = @token
+		WHERE id IN (SELECT id FROM s)
+			AND (last_seen < CURRENT_TIMESTAMP - @interval::interval OR ip <> @ip OR token <> @token)
+	)
+	SELECT EXISTS(SELECT true FROM s)`
+	args := pgx.NamedArgs{
+		"id":       id,
+		"userId":   userId,
+		"token":    token,
+		"ip":       ip,
+		"interval": touchInterval.String(),
+	}
+
+	var ok bool
+	err := m.Pool.QueryRow(context.Background(), query, args).Scan(&ok)
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// ForUser lists the sessions of a user that started within lifetime, older
+// ones have expired in scs anyway.
+func (m *SessionModel) ForUser(userId int, lifetime time.Duration) ([]Session, error) {
+	query := `SELECT id, user_id, device, ip, created, last_seen FROM user_sessions
+	WHERE user_id = @userId AND created > CURRENT_TIMESTAMP - @lifetime::interval
+	ORDER BY last_seen DESC`
+	args := pgx.NamedArgs{
+		"userId":   userId,
+		"lifetime": lifetime.String(),
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Session])
+}
+
+func (m *SessionModel) Revoke(id, userId int) error {
+	query := `DELETE FROM user_sessions WHERE id = @id AND user_id = @userId RETURNING token`
+	tokens, err := m.revoke(query, pgx.NamedArgs{"id": id, "userId": userId})
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// RevokeOthers signs the user out everywhere but the session id.
+func (m *SessionModel) RevokeOthers(id, userId int) error {
+	query := `DELETE FROM user_sessions WHERE user_id = @userId AND id <> @id RETURNING token`
+	_, err := m.revoke(query, pgx.NamedArgs{"id": id, "userId": userId})
+	return err
+}
+
+// revoke runs query, which deletes session records and returns their tokens,
+// and deletes the scs sessions behind them.
+func (m *SessionModel) revoke(query string, args pgx.NamedArgs) ([]string, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tokens, err := deleteSessions(ctx, tx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, tx.Commit(ctx)
+}
+
+// revokeSessions signs a user out everywhere. It deletes the user's session
+// records along with the scs sessions they were made for.
+func revokeSessions(ctx context.Context, tx pgx.Tx, userId int) error {
+	return revokeOtherSessions(ctx, tx, userId, 0)
+}
+
+// revokeOtherSessions is revokeSessions sparing the session id.
+func revokeOtherSessions(ctx context.Context, tx pgx.Tx, userId, id int) error {
+	query := `DELETE FROM user_sessions WHERE user_id = @userId AND id <> @id RETURNING token`
+	_, err := deleteSessions(ctx, tx, query, pgx.NamedArgs{"userId": userId, "id": id})
+	return err
+}
+
+func deleteSessions(ctx context.Context, tx pgx.Tx, query string, args pgx.NamedArgs) ([]string, error) {
+	rows, err := tx.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM sessions WHERE token = ANY(@tokens)`, pgx.NamedArgs{"tokens": tokens})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+	"go-webserver/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestSessionRevoke(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SessionModel{Pool: db}
+
+	for _, token := range []string{"laptop-token", "phone-token"} {
+		_, err := db.Exec(context.Background(), `INSERT INTO sessions (token, data, expiry) VALUES ($1, '', $2)`, token, time.Now().Add(time.Hour))
+		assert.NilError(t, err)
+	}
+
+	laptop, err := m.Insert(1, "laptop-token", "Firefox on Linux", "192.0.2.1")
+	assert.NilError(t, err)
+	phone, err := m.Insert(1, "phone-token", "Safari on iOS", "192.0.2.2")
+	assert.NilError(t, err)
+
+	err = m.RevokeOthers(laptop, 1)
+	assert.NilError(t, err)
+
+	ok, err := m.Touch(laptop, 1, "laptop-token", "192.0.2.1")
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+	ok, err = m.Touch(phone, 1, "phone-token", "192.0.2.2")
+	assert.NilError(t, err)
+	assert.Equal(t, ok, false)
+
+	// the scs session of the phone is gone, not just its record
+	var tokens []string
+	rows, err := db.Query(context.Background(), `SELECT token FROM sessions ORDER BY token`)
+	assert.NilError(t, err)
+	for rows.Next() {
+		var token string
+		assert.NilError(t, rows.Scan(&token))
+		tokens = append(tokens, token)
+	}
+	assert.NilError(t, rows.Err())
+	assert.Equal(t, len(tokens), 1)
+	assert.Equal(t, tokens[0], "laptop-token")
+
+	err = m.Revoke(phone, 1)
+	assert.Equal(t, err, ErrNoRecord)
+}
@@ -9,28 +9,60 @@ import (
 
 	//placeholder
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	gonanoid "github.com/matoous/go-nanoid/v2"
 )
 
 type Snippet struct {
-	Id        string    `json:"id" db:"id"`
-	Title     string    `json:"title" db:"title"`
-	Content   string    `json:"content" db:"content"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	Expires   time.Time `json:"expires" db:"expires"`
+	Id         string    `json:"id" db:"id"`
+	Title      string    `json:"title" db:"title"`
+	Content    string    `json:"content" db:"content"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	Expires    time.Time `json:"expires" db:"expires"`
+	Language   string    `json:"language" db:"language"`
+	Encryption string    `json:"encryption" db:"encryption"`
+	Slug       string    `json:"slug" db:"slug"`
+	Hidden     bool      `json:"hidden" db:"hidden"`
+	UserId     *int      `json:"userId,omitempty" db:"user_id"`
+	OrgId      *int      `json:"orgId,omitempty" db:"org_id"`
+	ParentId   *string   `json:"parentId,omitempty" db:"parent_id"`
 }
 
 type SnippetRequest struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Expires int    `json:"expires"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	Language   string `json:"language"`
+	Encryption string `json:"encryption"`
+	Slug       string `json:"slug"`
+	Expires    int    `json:"expires"`
+	UserId     int    `json:"-"`
+	OrgId      int    `json:"-"`
+	ParentId   string `json:"-"`
 }
 
+// SnippetLanguages are the values accepted for Snippet.Language, "text" is the
+// default for content without any particular syntax.
+var SnippetLanguages = []string{"text", "go", "json", "sql", "javascript", "python", "bash"}
+
+// EncryptionAESGCM marks content that was encrypted in the browser with
+// AES-256-GCM. The stored content is base64(iv || ciphertext) and the key never
+// reaches the server, it only lives in the URL fragment.
+const EncryptionAESGCM = "aes-256-gcm"
+
+var SnippetEncryptions = []string{EncryptionAESGCM}
+
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (string, error)
-	Get(id string) (Snippet, error)
+	Insert(snippet SnippetRequest) (string, error)
+	Get(id string, viewerId int, includeHidden bool) (Snippet, error)
+	GetBySlug(slug string, viewerId int, includeHidden bool) (Snippet, error)
 	Latest() ([]Snippet, error)
+	ForUser(userId int) ([]Snippet, error)
+	PublicForUser(userId int) ([]Snippet, error)
+	AuthorStats(userId int) (AuthorStats, error)
+	Search(query string, limit int) ([]Snippet, error)
+	Update(id, title, content, language string) error
+	Delete(id string) error
 }
 
 type SnippetModel struct {
@@ -46,27 +78,41 @@ func (m *SnippetModel) ParseRequest(reqBody string) (SnippetRequest, error) {
 
 	return parsedRequest, nil
 }
-func (m *SnippetModel) Insert(title string, content string, expires int) (string, error) {
+func (m *SnippetModel) Insert(snippet SnippetRequest) (string, error) {
 	id, err := gonanoid.New(16)
 	id = fmt.Sprint("snippet-", id)
 	if err != nil {
 		return "", err
 	}
 
-	query := `INSERT INTO snippets(id, title, content, created_at, expires) VALUES
-	(@id, @title, @content, @createdAt, @expires)`
+	if snippet.Language == "" {
+		snippet.Language = "text"
+	}
+
+	query := `INSERT INTO snippets(id, title, content, created_at, expires, language, encryption, slug, user_id, org_id, parent_id) VALUES
+	(@id, @title, @content, @createdAt, @expires, @language, @encryption, @slug, NULLIF(@userId, 0), NULLIF(@orgId, 0), NULLIF(@parentId, ''))`
 
 	args := pgx.NamedArgs{
-		"id":        id,
-		"title":     title,
-		"content":   content,
-		"createdAt": time.Now(),
-		"expires":   time.Now().AddDate(0, 0, expires),
+		"id":         id,
+		"title":      snippet.Title,
+		"content":    snippet.Content,
+		"createdAt":  time.Now(),
+		"expires":    time.Now().AddDate(0, 0, snippet.Expires),
+		"language":   snippet.Language,
+		"encryption": snippet.Encryption,
+		"slug":       snippet.Slug,
+		"userId":     snippet.UserId,
+		"orgId":      snippet.OrgId,
+		"parentId":   snippet.ParentId,
 	}
 
 	commandTag, err := m.Pool.Exec(context.Background(), query, args)
 
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "snippets_uc_slug" {
+			return "", ErrDuplicateSlug
+		}
 		return "", err
 	}
 
@@ -77,11 +123,52 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (string
 	return id, nil
 }
 
-// This will return a specific snippet based on its id.
-func (m *SnippetModel) Get(id string) (Snippet, error) {
-	query := `SELECT * FROM snippets WHERE expires > CURRENT_TIMESTAMP AND id = @id`
+// visibleTo limits a query to snippets the viewer may see: everything that
+// doesn't belong to an organization, and the snippets of organizations they
+// are a member of. Anonymous viewers pass 0.
+const visibleTo = `(org_id IS NULL OR EXISTS
+	(SELECT 1 FROM org_members WHERE org_members.org_id = snippets.org_id AND org_members.user_id = @viewerId))`
+
+// This will return a specific snippet based on its id. Snippets hidden by a
+// moderator are only returned when includeHidden is set, organization
+// snippets only to members of the organization.
+func (m *SnippetModel) Get(id string, viewerId int, includeHidden bool) (Snippet, error) {
+	query := `SELECT * FROM snippets WHERE expires > CURRENT_TIMESTAMP AND id = @id
+	AND (NOT hidden OR @includeHidden) AND ` + visibleTo
 	args := pgx.NamedArgs{
-		"id": id,
+		"id":            id,
+		"viewerId":      viewerId,
+		"includeHidden": includeHidden,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	snippet, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		}
+		return Snippet{}, err
+	}
+
+	return snippet, nil
+}
+
+// GetBySlug returns the snippet published under a custom slug.
+func (m *SnippetModel) GetBySlug(slug string, viewerId int, includeHidden bool) (Snippet, error) {
+	if slug == "" {
+		return Snippet{}, ErrNoRecord
+	}
+
+	query := `SELECT * FROM snippets WHERE expires > CURRENT_TIMESTAMP AND slug = @slug
+	AND (NOT hidden OR @includeHidden) AND ` + visibleTo
+	args := pgx.NamedArgs{
+		"slug":          slug,
+		"viewerId":      viewerId,
+		"includeHidden": includeHidden,
 	}
 
 	rows, err := m.Pool.Query(context.Background(), query, args)
@@ -102,7 +189,8 @@ func (m *SnippetModel) Get(id string) (Snippet, error) {
 
 // This will return the 10 most recently created snippets.
 func (m *SnippetModel) Latest() ([]Snippet, error) {
-	query := `SELECT * FROM snippets WHERE expires > CURRENT_TIMESTAMP ORDER BY created_at DESC LIMIT 5`
+	query := `SELECT * FROM snippets WHERE expires > CURRENT_TIMESTAMP AND NOT hidden AND org_id IS NULL
+	ORDER BY created_at DESC LIMIT 5`
 	rows, err := m.Pool.Query(context.Background(), query)
 	if err != nil {
 		return []Snippet{}, err
@@ -143,3 +231,120 @@ func (m *SnippetModel) Check() {
 	fmt.Println()
 
 }
+
+// ForUser returns every snippet the user created, expired and hidden ones
+// included, oldest first.
+func (m *SnippetModel) ForUser(userId int) ([]Snippet, error) {
+	query := `SELECT * FROM snippets WHERE user_id = @userId ORDER BY created_at`
+	args := pgx.NamedArgs{
+		"userId": userId,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+}
+
+// PublicForUser returns the user's snippets that anyone may see, newest first.
+func (m *SnippetModel) PublicForUser(userId int) ([]Snippet, error) {
+	query := `SELECT * FROM snippets WHERE user_id = @userId AND expires > CURRENT_TIMESTAMP AND NOT hidden
+	AND org_id IS NULL ORDER BY created_at DESC`
+	args := pgx.NamedArgs{
+		"userId": userId,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+}
+
+// AuthorStats is how the snippets of a user were received by others.
+type AuthorStats struct {
+	Stars int `db:"stars"`
+	Forks int `db:"forks"`
+}
+
+// AuthorStats counts the stars on the user's public snippets and the forks
+// other users made of them. Their own revisions don't count as forks.
+func (m *SnippetModel) AuthorStats(userId int) (AuthorStats, error) {
+	query := `SELECT
+	(SELECT count(*) FROM snippet_stars st JOIN snippets s ON s.id = st.snippet_id
+		WHERE s.user_id = @userId AND s.org_id IS NULL) AS stars,
+	(SELECT count(*) FROM snippets f JOIN snippets s ON s.id = f.parent_id
+		WHERE s.user_id = @userId AND s.org_id IS NULL AND f.user_id IS DISTINCT FROM @userId) AS forks`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"userId": userId})
+	if err != nil {
+		return AuthorStats{}, err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[AuthorStats])
+}
+
+// Search finds unexpired snippets, hidden ones included, by a case-insensitive
+// substring of their title, id or slug. It is meant for administrators.
+func (m *SnippetModel) Search(query string, limit int) ([]Snippet, error) {
+	sql := `SELECT * FROM snippets WHERE expires > CURRENT_TIMESTAMP
+	AND (@query = '' OR title ILIKE @pattern ESCAPE '\' OR id ILIKE @pattern ESCAPE '\' OR slug ILIKE @pattern ESCAPE '\')
+	ORDER BY created_at DESC LIMIT @limit`
+	args := pgx.NamedArgs{
+		"query":   query,
+		"pattern": containsPattern(query),
+		"limit":   limit,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), sql, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+}
+
+// Update replaces the title, content and language of a snippet. Only
+// organization snippets are edited in place, the rest are immutable.
+func (m *SnippetModel) Update(id, title, content, language string) error {
+	query := `UPDATE snippets SET title = @title, content = @content, language = @language
+	WHERE id = @id AND org_id IS NOT NULL`
+	args := pgx.NamedArgs{
+		"id":       id,
+		"title":    title,
+		"content":  content,
+		"language": language,
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Delete(id string) error {
+	query := `DELETE FROM snippets WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
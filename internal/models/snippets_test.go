@@ -0,0 +1,30 @@
+package models
+
+import (
+	"go-webserver/internal/assert"
+	"testing"
+)
+
+func TestSnippetModelSearch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{Pool: db}
+
+	for _, title := range []string{"100% uptime", "1000 uptime", "user_id lookup"} {
+		_, err := m.Insert(SnippetRequest{Title: title, Content: "Notes", Expires: 7})
+		assert.NilError(t, err)
+	}
+
+	// LIKE wildcards in a search are matched literally
+	snippets, err := m.Search("100%", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].Title, "100% uptime")
+
+	snippets, err = m.Search("0_u", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 0)
+}
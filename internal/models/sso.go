@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// SSOUsernamePrefix starts the placeholder usernames of users created by
+// SSOLogin. Nobody can pick a username like that themselves.
+const SSOUsernamePrefix = "user-"
+
+// SSOLogin returns the user behind an identity at an OpenID Connect provider.
+// The first login links the identity to the user with the same email address,
+// or creates that user if create is set and returns ErrNoRecord otherwise. The
+// caller must only pass emails the provider has verified, otherwise anyone
+// could take over an account by its address.
+//
+// Only accounts that have verified their address themselves are linked. An
+// unverified one may have been registered by someone else ahead of the
+// owner, linking it would hand them the owner's identity, so SSOLogin
+// returns ErrUnverifiedAccount instead.
+func (m *UserModel) SSOLogin(issuer, subject, email, name string, create bool) (int, error) {
+	ctx := context.Background()
+	email = NormalizeEmail(email)
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	query := `SELECT user_id FROM user_identities WHERE issuer = @issuer AND subject = @subject`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"issuer": issuer, "subject": subject}).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	var verified bool
+	query = `SELECT id, verified FROM users WHERE email = @email FOR UPDATE`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"email": email}).Scan(&id, &verified)
+	switch {
+	case err == nil && !verified:
+		return 0, ErrUnverifiedAccount
+	case err == nil:
+		return id, m.linkIdentity(ctx, tx, issuer, subject, id)
+	case !errors.Is(err, pgx.ErrNoRows):
+		return 0, err
+	case !create:
+		return 0, ErrNoRecord
+	}
+
+	// Users created here log in through the provider. They get a password
+	// nobody knows, a password reset sets a real one.
+	password, _, err := newToken()
+	if err != nil {
+		return 0, err
+	}
+	hashedPassword, err := m.passwords().Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	// The username is a placeholder the user can change on their profile. A
+	// clash with an existing one is unlikely but gets a fresh placeholder.
+	for attempt := 1; ; attempt++ {
+		id, err = insertSSOUser(ctx, tx, name, email, hashedPassword)
+		if err == nil {
+			break
+		}
+		var pgErr *pgconn.PgError
+		if attempt < ssoUsernameAttempts && errors.As(err, &pgErr) && pgErr.Code == "23505" &&
+			errors.Is(duplicateError(pgErr), ErrDuplicateUsername) {
+			continue
+		}
+		return 0, err
+	}
+
+	return id, m.linkIdentity(ctx, tx, issuer, subject, id)
+}
+
+// ssoUsernameAttempts is how many placeholder usernames SSOLogin tries.
+const ssoUsernameAttempts = 3
+
+// insertSSOUser creates a verified user with a placeholder username. It runs
+// in a savepoint so a clash leaves tx usable.
+func insertSSOUser(ctx context.Context, tx pgx.Tx, name, email, hashedPassword string) (int, error) {
+	username, err := gonanoid.Generate("abcdefghijklmnopqrstuvwxyz0123456789", 10)
+	if err != nil {
+		return 0, err
+	}
+
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer savepoint.Rollback(ctx)
+
+	var id int
+	query := `INSERT INTO users (name, username, email, hashed_password, created, verified)
+	VALUES (@name, @username, @email, @hashedPassword, @created, true)
+	RETURNING id`
+	args := pgx.NamedArgs{
+		"name":           name,
+		"username":       SSOUsernamePrefix + username,
+		"email":          email,
+		"hashedPassword": hashedPassword,
+		"created":        time.Now(),
+	}
+	err = savepoint.QueryRow(ctx, query, args).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, savepoint.Commit(ctx)
+}
+
+// linkIdentity records that the identity belongs to the user and commits tx.
+func (m *UserModel) linkIdentity(ctx context.Context, tx pgx.Tx, issuer, subject string, id int) error {
+	query := `INSERT INTO user_identities (issuer, subject, user_id, created)
+	VALUES (@issuer, @subject, @id, CURRENT_TIMESTAMP)`
+	_, err := tx.Exec(ctx, query, pgx.NamedArgs{"issuer": issuer, "subject": subject, "id": id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
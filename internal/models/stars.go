@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type StarModelInterface interface {
+	Star(snippetId string, userId int) error
+	Unstar(snippetId string, userId int) error
+	Starred(snippetId string, userId int) (bool, error)
+	Count(snippetId string) (int, error)
+}
+
+// StarModel records which users starred which snippets. A user stars a
+// snippet at most once.
+type StarModel struct {
+	Pool *pgxpool.Pool
+}
+
+// Star stars the snippet for the user, starring it again changes nothing. A
+// snippet that doesn't exist gives ErrNoRecord.
+func (m *StarModel) Star(snippetId string, userId int) error {
+	query := `INSERT INTO snippet_stars (snippet_id, user_id, created)
+	VALUES (@snippetId, @userId, CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING`
+	args := pgx.NamedArgs{
+		"snippetId": snippetId,
+		"userId":    userId,
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (m *StarModel) Unstar(snippetId string, userId int) error {
+	query := `DELETE FROM snippet_stars WHERE snippet_id = @snippetId AND user_id = @userId`
+	args := pgx.NamedArgs{
+		"snippetId": snippetId,
+		"userId":    userId,
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	return err
+}
+
+func (m *StarModel) Starred(snippetId string, userId int) (bool, error) {
+	query := `SELECT EXISTS(SELECT true FROM snippet_stars WHERE snippet_id = @snippetId AND user_id = @userId)`
+	args := pgx.NamedArgs{
+		"snippetId": snippetId,
+		"userId":    userId,
+	}
+
+	var starred bool
+	err := m.Pool.QueryRow(context.Background(), query, args).Scan(&starred)
+	return starred, err
+}
+
+func (m *StarModel) Count(snippetId string) (int, error) {
+	query := `SELECT count(*) FROM snippet_stars WHERE snippet_id = @snippetId`
+
+	var count int
+	err := m.Pool.QueryRow(context.Background(), query, pgx.NamedArgs{"snippetId": snippetId}).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"go-webserver/internal/assert"
+	"testing"
+)
+
+func TestStarsAndForks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	stars := StarModel{Pool: db}
+	snippets := SnippetModel{Pool: db}
+	users := UserModel{Pool: db}
+
+	bob, err := users.Insert("Bob", "bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	original, err := snippets.Insert(SnippetRequest{Title: "Deploy", Content: "Steps", Expires: 7, UserId: 1})
+	assert.NilError(t, err)
+
+	assert.NilError(t, stars.Star(original, bob))
+	assert.NilError(t, stars.Star(original, bob))
+	assert.NilError(t, stars.Star(original, 1))
+	count, err := stars.Count(original)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 2)
+
+	assert.NilError(t, stars.Unstar(original, 1))
+	starred, err := stars.Starred(original, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, starred, false)
+
+	err = stars.Star("snippet-missing", bob)
+	assert.Equal(t, err, ErrNoRecord)
+
+	// alice's own revision isn't a fork, bob's copy is
+	_, err = snippets.Insert(SnippetRequest{Title: "Deploy", Content: "Steps", Expires: 7, UserId: 1, ParentId: original})
+	assert.NilError(t, err)
+	_, err = snippets.Insert(SnippetRequest{Title: "Deploy", Content: "Steps", Expires: 7, UserId: bob, ParentId: original})
+	assert.NilError(t, err)
+
+	stats, err := snippets.AuthorStats(1)
+	assert.NilError(t, err)
+	assert.Equal(t, stats, AuthorStats{Stars: 1, Forks: 1})
+}
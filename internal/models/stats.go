@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TableSize struct {
+	Name  string `db:"name"`
+	Bytes int64  `db:"bytes"`
+}
+
+type Stats struct {
+	Users          int `db:"users"`
+	Snippets       int `db:"snippets"`
+	ActiveSnippets int `db:"active_snippets"`
+	HiddenSnippets int `db:"hidden_snippets"`
+	OpenReports    int `db:"open_reports"`
+	ActiveSessions int `db:"active_sessions"`
+	Tables         []TableSize
+}
+
+type StatsModelInterface interface {
+	Get() (Stats, error)
+}
+
+type StatsModel struct {
+	Pool *pgxpool.Pool
+}
+
+func (m *StatsModel) Get() (Stats, error) {
+	query := `SELECT
+		(SELECT COUNT(*) FROM users) AS users,
+		(SELECT COUNT(*) FROM snippets) AS snippets,
+		(SELECT COUNT(*) FROM snippets WHERE expires > CURRENT_TIMESTAMP) AS active_snippets,
+		(SELECT COUNT(*) FROM snippets WHERE hidden) AS hidden_snippets,
+		(SELECT COUNT(*) FROM reports WHERE status = 'open') AS open_reports,
+		(SELECT COUNT(*) FROM sessions WHERE expiry > CURRENT_TIMESTAMP) AS active_sessions`
+
+	rows, err := m.Pool.Query(context.Background(), query)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats, err := pgx.CollectOneRow(rows, pgx.RowToStructByNameLax[Stats])
+	if err != nil {
+		return Stats{}, err
+	}
+
+	query = `SELECT relname AS name, pg_total_relation_size(relid) AS bytes
+	FROM pg_catalog.pg_statio_user_tables ORDER BY bytes DESC`
+
+	rows, err = m.Pool.Query(context.Background(), query)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats.Tables, err = pgx.CollectRows(rows, pgx.RowToStructByName[TableSize])
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return stats, nil
+}
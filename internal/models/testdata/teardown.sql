@@ -1,3 +1,39 @@
+DROP TABLE snippet_stars;
+DROP TABLE api_tokens;
+DROP TABLE invite_code_uses;
+DROP TABLE invite_codes;
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only;
+DROP TABLE org_invitations;
+DROP TABLE org_members;
+DROP TABLE email_changes;
+DROP TABLE user_sessions;
+DROP TABLE sessions;
+
+DROP TABLE login_attempts;
+
+DROP TABLE user_identities;
+
+DROP TABLE passkeys;
+
+DROP TABLE role_settings;
+
+DROP TABLE recovery_codes;
+
+DROP TABLE password_resets;
+
+DROP TABLE account_exports;
+
+DROP TABLE moderation_decisions;
+
+DROP TABLE reports;
+
+DROP TABLE collection_snippets;
+
+DROP TABLE collections;
+
 DROP TABLE users;
 
-DROP TABLE snippets;
\ No newline at end of file
+DROP TABLE snippets;
+
+DROP TABLE orgs;
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoginAttempts counts the failed logins for a key, a client IP or an email
+// address. The count starts over once a key has had no failures for a while.
+type LoginAttempts struct {
+	Key         string    `db:"key"`
+	Failures    int       `db:"failures"`
+	LastFailure time.Time `db:"last_failure"`
+}
+
+type LoginThrottleModelInterface interface {
+	Get(keys ...string) ([]LoginAttempts, error)
+	Fail(key string, window time.Duration) (LoginAttempts, error)
+	Reset(key string) error
+	Release(key string) error
+	Purge(window time.Duration) error
+}
+
+type LoginThrottleModel struct {
+	Pool *pgxpool.Pool
+}
+
+func (m *LoginThrottleModel) Get(keys ...string) ([]LoginAttempts, error) {
+	query := `SELECT key, failures, last_failure FROM login_attempts WHERE key = ANY(@keys)`
+	args := pgx.NamedArgs{
+		"keys": keys,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[LoginAttempts])
+}
+
+// Fail records a failed login for key. Failures more than window apart don't
+// add up.
+func (m *LoginThrottleModel) Fail(key string, window time.Duration) (LoginAttempts, error) {
+	query := `INSERT INTO login_attempts(key, failures, last_failure)
+	VALUES (@key, 1, CURRENT_TIMESTAMP)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_attempts.last_failure < CURRENT_TIMESTAMP - @window::interval THEN 1
+			ELSE login_attempts.failures + 1 END,
+		last_failure = CURRENT_TIMESTAMP
+	RETURNING key, failures, last_failure`
+	args := pgx.NamedArgs{
+		"key":    key,
+		"window": window.String(),
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return LoginAttempts{}, err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[LoginAttempts])
+}
+
+func (m *LoginThrottleModel) Reset(key string) error {
+	_, err := m.Pool.Exec(context.Background(), `DELETE FROM login_attempts WHERE key = @key`, pgx.NamedArgs{"key": key})
+	return err
+}
+
+// Release takes back one failure recorded for key.
+func (m *LoginThrottleModel) Release(key string) error {
+	query := `UPDATE login_attempts SET failures = failures - 1 WHERE key = @key AND failures > 0`
+	_, err := m.Pool.Exec(context.Background(), query, pgx.NamedArgs{"key": key})
+	return err
+}
+
+// Purge deletes the keys whose last failure is more than window ago, they
+// would start over from zero anyway.
+func (m *LoginThrottleModel) Purge(window time.Duration) error {
+	query := `DELETE FROM login_attempts WHERE last_failure < CURRENT_TIMESTAMP - @window::interval`
+	_, err := m.Pool.Exec(context.Background(), query, pgx.NamedArgs{"window": window.String()})
+	return err
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+)
+
+// newToken returns a random token for the user and the hash that gets
+// stored. Only the hash ever reaches the database so a leaked table cannot be
+// used to log in or reset anything.
+func newToken() (string, []byte, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
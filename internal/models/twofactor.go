@@ -0,0 +1,243 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go-webserver/internal/totp"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time.
+const recoveryCodeCount = 10
+
+// RoleSetting holds the per role security policy admins can change.
+type RoleSetting struct {
+	Role        Role `db:"role"`
+	RequireTOTP bool `db:"require_totp"`
+}
+
+// EnableTOTP turns on two-factor authentication with a secret the user has
+// already proven to have set up, and returns a fresh set of recovery codes.
+func (m *UserModel) EnableTOTP(id int, secret string) ([]string, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET totp_secret = @secret, totp_last_step = 0 WHERE id = @id`
+	commandTag, err := tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "secret": secret})
+	if err != nil {
+		return nil, err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return nil, ErrNoRecord
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit(ctx)
+}
+
+// DisableTOTP turns two-factor authentication off after checking the password.
+func (m *UserModel) DisableTOTP(id int, password string) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = m.checkPassword(ctx, tx, id, password)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET totp_secret = '', totp_last_step = 0 WHERE id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ValidateTOTP checks a code from the user's authenticator app. Every code is
+// accepted only once, even within the window where it is still valid.
+func (m *UserModel) ValidateTOTP(id int, code string) (bool, error) {
+	var secret string
+	query := `SELECT totp_secret FROM users WHERE id = @id`
+	err := m.Pool.QueryRow(context.Background(), query, pgx.NamedArgs{"id": id}).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+
+	if secret == "" {
+		return false, nil
+	}
+
+	step, ok := totp.Match(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	query = `UPDATE users SET totp_last_step = @step WHERE id = @id AND totp_last_step < @step`
+	commandTag, err := m.Pool.Exec(context.Background(), query, pgx.NamedArgs{"id": id, "step": step})
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode spends one of the user's recovery codes.
+func (m *UserModel) UseRecoveryCode(id int, code string) (bool, error) {
+	query := `DELETE FROM recovery_codes WHERE user_id = @id AND code_hash = @hash`
+	args := pgx.NamedArgs{
+		"id":   id,
+		"hash": hashToken(normalizeRecoveryCode(code)),
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (m *UserModel) RecoveryCodesLeft(id int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = @id`
+	err := m.Pool.QueryRow(context.Background(), query, pgx.NamedArgs{"id": id}).Scan(&count)
+	return count, err
+}
+
+// RegenerateRecoveryCodes throws away the remaining recovery codes and hands
+// out a new set, after checking the password.
+func (m *UserModel) RegenerateRecoveryCodes(id int, password string) ([]string, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = m.checkPassword(ctx, tx, id, password)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit(ctx)
+}
+
+// RoleSettings returns the policy of every role, roles without a row in
+// role_settings get the defaults.
+func (m *UserModel) RoleSettings() ([]RoleSetting, error) {
+	var roles []string
+	for _, role := range Roles {
+		roles = append(roles, string(role))
+	}
+
+	query := `SELECT r.role, COALESCE(s.require_totp, false) AS require_totp
+	FROM unnest(@roles::text[]) WITH ORDINALITY AS r(role, position)
+	LEFT JOIN role_settings s ON s.role = r.role ORDER BY r.position`
+
+	rows, err := m.Pool.Query(context.Background(), query, pgx.NamedArgs{"roles": roles})
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[RoleSetting])
+}
+
+func (m *UserModel) SetRoleRequiresTOTP(role Role, required bool) error {
+	query := `INSERT INTO role_settings(role, require_totp) VALUES (@role, @required)
+	ON CONFLICT (role) DO UPDATE SET require_totp = EXCLUDED.require_totp`
+	args := pgx.NamedArgs{
+		"role":     role,
+		"required": required,
+	}
+
+	_, err := m.Pool.Exec(context.Background(), query, args)
+	return err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, id int) ([]string, error) {
+	_, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	for range recoveryCodeCount {
+		token, _, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(token[:5] + "-" + token[5:10])
+		codes = append(codes, code)
+
+		query := `INSERT INTO recovery_codes(user_id, code_hash) VALUES (@id, @hash)`
+		_, err = tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "hash": hashToken(normalizeRecoveryCode(code))})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode makes "ABCDE-FGHIJ", "abcde fghij" and "abcdefghij"
+// the same code.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// checkPassword returns ErrInvalidCredentials unless password belongs to the
+// user with the given id.
+func (m *UserModel) checkPassword(ctx context.Context, tx pgx.Tx, id int, password string) error {
+	var hashedPassword string
+	query := `SELECT hashed_password FROM users WHERE id = @id FOR UPDATE`
+	err := tx.QueryRow(ctx, query, pgx.NamedArgs{"id": id}).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	match, _, err := m.passwords().Verify(hashedPassword, password)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
@@ -3,13 +3,15 @@ package models
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
+
+	"go-webserver/internal/passwords"
 )
 
 type Users struct {
@@ -18,72 +20,167 @@ type Users struct {
 	Email          string    `db:"email"`
 	HashedPassword string    `db:"hashed_password"`
 	Created        time.Time `db:"created"`
+	Disabled       bool      `db:"disabled"`
 }
 type UsersNoPassword struct {
-	Id      int       `db:"id"`
-	Name    string    `db:"name"`
-	Email   string    `db:"email"`
-	Created time.Time `db:"created"`
+	Id       int       `db:"id"`
+	Name     string    `db:"name"`
+	Username string    `db:"username"`
+	Email    string    `db:"email"`
+	Created  time.Time `db:"created"`
+	Role     Role      `db:"role"`
+
+	Disabled              bool `db:"disabled"`
+	PasswordResetRequired bool `db:"password_reset_required"`
+	Verified              bool `db:"verified"`
+
+	// TOTPEnabled is set once the user finished 2FA enrollment, TOTPRequired
+	// when an admin requires 2FA for the user's role.
+	TOTPEnabled  bool `db:"totp_enabled"`
+	TOTPRequired bool `db:"totp_required"`
+}
+
+// userColumns selects every field of UsersNoPassword.
+const userColumns = `id, name, username, email, created, role, disabled, password_reset_required, verified,
+	totp_secret <> '' AS totp_enabled,
+	EXISTS (SELECT 1 FROM role_settings WHERE role_settings.role = users.role AND require_totp) AS totp_required`
+
+// Role decides what a user is allowed to do. Roles are ordered, every role
+// includes the permissions of the ones below it.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+var roleRanks = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// AtLeast reports whether r grants at least the permissions of other. Unknown
+// roles grant nothing.
+func (r Role) AtLeast(other Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[other]
 }
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, username, email, password string) (int, error)
+	InsertInvited(name, username, email, password, code string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (UsersNoPassword, error)
+	GetByEmail(email string) (UsersNoPassword, error)
+	GetByUsername(username string) (UsersNoPassword, error)
 	PasswordUpdate(id int, currentPassword, newPassword string) error
+	Search(query string, limit int) ([]UsersNoPassword, error)
+	SetRole(id int, role Role) error
+	SetDisabled(id int, disabled bool) error
+	RequirePasswordReset(id int, ttl time.Duration) (string, error)
+	Delete(id int, password string, keepSnippets bool) error
+	Verify(id int, email string) error
+	ClaimVerificationEmail(id int, interval time.Duration) (bool, error)
+	CreatePasswordReset(email string, ttl time.Duration) (string, error)
+	GetByResetToken(token string) (UsersNoPassword, error)
+	ResetPassword(token, newPassword string) (int, error)
+	SSOLogin(issuer, subject, email, name string, create bool) (int, error)
+	UpdateProfile(id int, name, username string) error
+	CreateEmailChange(id int, password, newEmail string, ttl time.Duration) (string, error)
+	ChangeEmail(token string, sessionId int) (EmailChange, error)
+
+	EnableTOTP(id int, secret string) ([]string, error)
+	DisableTOTP(id int, password string) error
+	ValidateTOTP(id int, code string) (bool, error)
+	UseRecoveryCode(id int, code string) (bool, error)
+	RecoveryCodesLeft(id int) (int, error)
+	RegenerateRecoveryCodes(id int, password string) ([]string, error)
+	RoleSettings() ([]RoleSetting, error)
+	SetRoleRequiresTOTP(role Role, required bool) error
 }
 
+// UserModel hashes passwords according to Passwords, or the default policy
+// when that is nil. Problems that don't fail the call, like a password that
+// couldn't be rehashed, go to Logger or the default logger.
 type UserModel struct {
-	Pool *pgxpool.Pool
+	Pool      *pgxpool.Pool
+	Passwords *passwords.Policy
+	Logger    *slog.Logger
+}
+
+var defaultPasswords = passwords.DefaultPolicy()
+
+func (m *UserModel) passwords() *passwords.Policy {
+	if m.Passwords == nil {
+		return defaultPasswords
+	}
+	return m.Passwords
+}
+
+func (m *UserModel) logger() *slog.Logger {
+	if m.Logger == nil {
+		return slog.Default()
+	}
+	return m.Logger
+}
+
+// NormalizeEmail is the form email addresses are stored and looked up in.
+// Every UserModel method that takes an address applies it, so an account
+// can't be registered twice in different case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+// Insert creates the user and returns their id.
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	hashedPassword, err := m.passwords().Hash(password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	query := `INSERT INTO users (name, email, hashed_password, created) 
-			VALUES(@name, @email, @hashedPassword, @createdAt)`
+	query := `INSERT INTO users (name, username, email, hashed_password, created) 
+			VALUES(@name, @username, @email, @hashedPassword, @createdAt) RETURNING id`
 
 	args := pgx.NamedArgs{
 		"name":           name,
-		"email":          email,
+		"username":       username,
+		"email":          NormalizeEmail(email),
 		"hashedPassword": hashedPassword,
 		"createdAt":      time.Now(),
 	}
 
-	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	var id int
+	err = m.Pool.QueryRow(context.Background(), query, args).Scan(&id)
 
 	if err != nil {
 		var pgErr *pgconn.PgError
 
 		//we basically check is this a postgre error? if not return the error
 		if !errors.As(err, &pgErr) {
-			return err
+			return 0, err
 		}
 
 		//23505 is postgre error code for unique value constraint violation.
 		if pgErr.Code == "23505" {
-			return ErrDuplicateEmail
+			return 0, duplicateError(pgErr)
 		}
 
+		return 0, err
 	}
 
-	if commandTag.RowsAffected() != 1 {
-		return err
-	}
-
-	fmt.Println(string(hashedPassword))
-	return nil
+	return id, nil
 }
 
 // return id, err
 func (m *UserModel) Authenticate(email, password string) (int, error) {
-	query := `SELECT * from users where email = @email`
+	query := `SELECT id, name, email, hashed_password, created, disabled from users where email = @email`
 	args := pgx.NamedArgs{
-		"email": email,
+		"email": NormalizeEmail(email),
 	}
 
 	rows, err := m.Pool.Query(context.Background(), query, args)
@@ -102,20 +199,40 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		return 0, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
+	match, rehash, err := m.passwords().Verify(user.HashedPassword, password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredentials
-		}
 		return 0, err
 	}
+	if !match {
+		return 0, ErrInvalidCredentials
+	}
+
+	// Upgrade hashes made with an older algorithm or weaker parameters while
+	// the password is at hand. The old hash keeps working if this fails, so
+	// it is simply tried again on the next login.
+	if rehash {
+		hashedPassword, err := m.passwords().Hash(password)
+		if err == nil {
+			query = `UPDATE users SET hashed_password = @new WHERE id = @id AND hashed_password = @old`
+			_, err = m.Pool.Exec(context.Background(), query, pgx.NamedArgs{"id": user.Id, "old": user.HashedPassword, "new": hashedPassword})
+		}
+		if err != nil {
+			m.logger().Error("rehashing password failed", "error", err, "user", user.Id)
+		}
+	}
+
+	// Only tell the caller the account is disabled once the password proved
+	// they own it.
+	if user.Disabled {
+		return 0, ErrAccountDisabled
+	}
 
 	return user.Id, nil
 }
 
 // return true or f, why not just return the user idk
 func (m *UserModel) Exists(id int) (bool, error) {
-	query := `SELECT * from users where id = @id`
+	query := `SELECT id, name, email, hashed_password, created, disabled from users where id = @id`
 	args := pgx.NamedArgs{
 		"id": id,
 	}
@@ -137,36 +254,87 @@ func (m *UserModel) Exists(id int) (bool, error) {
 }
 
 func (m *UserModel) Get(id int) (UsersNoPassword, error) {
-	query := `SELECT id, name, email, created FROM users WHERE id = @id`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = @id`
 	args := pgx.NamedArgs{
 		"id": id,
 	}
 
 	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return UsersNoPassword{}, err
+	}
+
+	user, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[UsersNoPassword])
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return UsersNoPassword{}, ErrInvalidCredentials
+			return UsersNoPassword{}, ErrNoRecord
 		}
+		return UsersNoPassword{}, err
+	}
+	return *user, nil
+}
 
+func (m *UserModel) GetByEmail(email string) (UsersNoPassword, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = @email`
+	args := pgx.NamedArgs{
+		"email": NormalizeEmail(email),
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
 		return UsersNoPassword{}, err
 	}
 
-	user, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[UsersNoPassword])
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[UsersNoPassword])
 	if err != nil {
-		return UsersNoPassword{}, nil
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UsersNoPassword{}, ErrNoRecord
+		}
+		return UsersNoPassword{}, err
 	}
-	return *user, nil
+	return user, nil
+}
+
+func (m *UserModel) GetByUsername(username string) (UsersNoPassword, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = @username`
+	args := pgx.NamedArgs{
+		"username": username,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return UsersNoPassword{}, err
+	}
+
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[UsersNoPassword])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UsersNoPassword{}, ErrNoRecord
+		}
+		return UsersNoPassword{}, err
+	}
+	return user, nil
 }
 
+// PasswordUpdate sets a new password once the current one checks out. API
+// tokens made with the old password are deleted along with it.
 func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	// select the data, get the hash
 
-	query := `SELECT hashed_password FROM users where id = @id`
+	query := `SELECT hashed_password FROM users where id = @id FOR UPDATE`
 	args := pgx.NamedArgs{
 		"id": id,
 	}
 
-	rows, err := m.Pool.Query(context.Background(), query, args)
+	rows, err := tx.Query(ctx, query, args)
 	if err != nil {
 		return err
 	}
@@ -178,35 +346,348 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 
 	// compare the hash, return errInvalidcreden if fail
 
-	err = bcrypt.CompareHashAndPassword([]byte(oldHashed), []byte(currentPassword))
+	match, _, err := m.passwords().Verify(oldHashed, currentPassword)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return ErrInvalidCredentials
-		}
 		return err
 	}
+	if !match {
+		return ErrInvalidCredentials
+	}
 
 	// make a hash
-	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	newHashedPassword, err := m.passwords().Hash(newPassword)
 	if err != nil {
 		return err
 	}
 
-	//update password
-	query = `UPDATE users SET hashed_password = @newHashed WHERE id = @id`
+	//update password, this also satisfies a reset forced by an admin
+	query = `UPDATE users SET hashed_password = @newHashed, password_reset_required = false WHERE id = @id`
 	args = pgx.NamedArgs{
 		"id":        id,
 		"newHashed": newHashedPassword,
 	}
 
+	_, err = tx.Exec(ctx, query, args)
+	if err != nil {
+		return err
+	}
+
+	err = revokeAPITokens(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Search looks users up by a case-insensitive substring of their name or email.
+// An empty query lists the most recent signups.
+func (m *UserModel) Search(query string, limit int) ([]UsersNoPassword, error) {
+	sql := `SELECT ` + userColumns + ` FROM users
+	WHERE @query = '' OR name ILIKE @pattern OR email ILIKE @pattern
+	ORDER BY created DESC LIMIT @limit`
+	args := pgx.NamedArgs{
+		"query":   query,
+		"pattern": containsPattern(query),
+		"limit":   limit,
+	}
+
+	rows, err := m.Pool.Query(context.Background(), sql, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[UsersNoPassword])
+}
+
+func (m *UserModel) SetRole(id int, role Role) error {
+	return m.update(id, `UPDATE users SET role = @value WHERE id = @id`, string(role))
+}
+
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	return m.update(id, `UPDATE users SET disabled = @value WHERE id = @id`, disabled)
+}
+
+// RequirePasswordReset locks the user out until they choose a new password
+// with a reset link, for when their password may be known to someone else.
+// Their sessions and API tokens are revoked and earlier reset links replaced
+// by the one whose token is returned. ResetPassword clears the flag.
+func (m *UserModel) RequirePasswordReset(id int, ttl time.Duration) (string, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, `UPDATE users SET password_reset_required = true WHERE id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return "", err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return "", ErrNoRecord
+	}
+
+	err = revokeSessions(ctx, tx, id)
+	if err != nil {
+		return "", err
+	}
+
+	err = revokeAPITokens(ctx, tx, id)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM password_resets WHERE user_id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return "", err
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO password_resets(token_hash, user_id, expiry) VALUES (@hash, @id, @expiry)`
+	_, err = tx.Exec(ctx, query, pgx.NamedArgs{"hash": hash, "id": id, "expiry": time.Now().Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit(ctx)
+}
+
+// update runs a single column update and reports ErrNoRecord if no user has
+// the given id.
+func (m *UserModel) update(id int, query string, value any) error {
+	args := pgx.NamedArgs{
+		"id":    id,
+		"value": value,
+	}
+
 	commandTag, err := m.Pool.Exec(context.Background(), query, args)
 	if err != nil {
 		return err
 	}
 
-	if commandTag.RowsAffected() != 1 {
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Delete removes the account after checking its password. The user's snippets
+// are either deleted or kept without an owner, organization snippets are always
+// kept, and every session logged in as the user is revoked. It all happens in
+// a single transaction. The last owner of an organization gets ErrLastOwner
+// and has to hand it over first.
+func (m *UserModel) Delete(id int, password string, keepSnippets bool) error {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = m.checkPassword(ctx, tx, id, password)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `DELETE FROM org_members WHERE user_id = @id RETURNING org_id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return err
+	}
+	orgIds, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+	for _, orgId := range orgIds {
+		err = requireOwner(ctx, tx, orgId)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Organization snippets belong to the organization, they always stay.
+	if !keepSnippets {
+		_, err = tx.Exec(ctx, `DELETE FROM snippets WHERE user_id = @id AND org_id IS NULL`, pgx.NamedArgs{"id": id})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(ctx, `UPDATE snippets SET user_id = NULL WHERE user_id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
 		return err
 	}
 
+	err = revokeSessions(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM users WHERE id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Verify marks the account as verified, as long as it still has the email
+// address the verification link was sent to.
+func (m *UserModel) Verify(id int, email string) error {
+	query := `UPDATE users SET verified = true WHERE id = @id AND email = @email`
+	args := pgx.NamedArgs{
+		"id":    id,
+		"email": NormalizeEmail(email),
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
 	return nil
 }
+
+// ClaimVerificationEmail reports whether another verification email may be
+// sent to an unverified user, at most one per interval. The check and the
+// timestamp update are a single statement so concurrent requests cannot both
+// win.
+func (m *UserModel) ClaimVerificationEmail(id int, interval time.Duration) (bool, error) {
+	query := `UPDATE users SET verification_sent = CURRENT_TIMESTAMP
+	WHERE id = @id AND NOT verified
+	AND (verification_sent IS NULL OR verification_sent < CURRENT_TIMESTAMP - @interval::interval)`
+	args := pgx.NamedArgs{
+		"id":       id,
+		"interval": interval.String(),
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// CreatePasswordReset stores the hash of a new single-use reset token for the
+// account with the given email and returns the token itself.
+func (m *UserModel) CreatePasswordReset(email string, ttl time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO password_resets(token_hash, user_id, expiry)
+	SELECT @hash, id, @expiry FROM users WHERE email = @email`
+	args := pgx.NamedArgs{
+		"hash":   hash,
+		"email":  NormalizeEmail(email),
+		"expiry": time.Now().Add(ttl),
+	}
+
+	commandTag, err := m.Pool.Exec(context.Background(), query, args)
+	if err != nil {
+		return "", err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return "", ErrNoRecord
+	}
+
+	return token, nil
+}
+
+// GetByResetToken returns the user a reset token is for, without using it up.
+// Unknown, used and expired tokens give ErrInvalidToken.
+func (m *UserModel) GetByResetToken(token string) (UsersNoPassword, error) {
+	query := `SELECT ` + userColumns + ` FROM users
+	WHERE id = (SELECT user_id FROM password_resets WHERE token_hash = @hash AND expiry > CURRENT_TIMESTAMP)`
+	args := pgx.NamedArgs{
+		"hash": hashToken(token),
+	}
+
+	rows, err := m.Pool.Query(context.Background(), query, args)
+	if err != nil {
+		return UsersNoPassword{}, err
+	}
+
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[UsersNoPassword])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UsersNoPassword{}, ErrInvalidToken
+		}
+		return UsersNoPassword{}, err
+	}
+	return user, nil
+}
+
+// ResetPassword uses up a reset token, sets the new password and signs the user
+// out everywhere, API tokens included. It returns the user's id. Unknown, used and expired tokens
+// give ErrInvalidToken.
+func (m *UserModel) ResetPassword(token, newPassword string) (int, error) {
+	ctx := context.Background()
+
+	tx, err := m.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	query := `DELETE FROM password_resets WHERE token_hash = @hash AND expiry > CURRENT_TIMESTAMP RETURNING user_id`
+	err = tx.QueryRow(ctx, query, pgx.NamedArgs{"hash": hashToken(token)}).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidToken
+		}
+		return 0, err
+	}
+
+	hashedPassword, err := m.passwords().Hash(newPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `UPDATE users SET hashed_password = @hashedPassword, password_reset_required = false WHERE id = @id`
+	_, err = tx.Exec(ctx, query, pgx.NamedArgs{"id": id, "hashedPassword": hashedPassword})
+	if err != nil {
+		return 0, err
+	}
+
+	// any other link that was mailed out is no good anymore either
+	_, err = tx.Exec(ctx, `DELETE FROM password_resets WHERE user_id = @id`, pgx.NamedArgs{"id": id})
+	if err != nil {
+		return 0, err
+	}
+
+	err = revokeSessions(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = revokeAPITokens(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
+
+// duplicateError tells which of the unique columns of users a unique
+// violation is about.
+func duplicateError(pgErr *pgconn.PgError) error {
+	if pgErr.ConstraintName == "users_uc_username" {
+		return ErrDuplicateUsername
+	}
+	return ErrDuplicateEmail
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
 	"go-webserver/internal/assert"
 	"testing"
+	"time"
 )
 
 func TestUserModelExists(t *testing.T) {
@@ -39,7 +41,7 @@ func TestUserModelExists(t *testing.T) {
 			// for each sub-test.
 			db := newTestDB(t)
 			// Create a new instance of the UserModel.
-			m := UserModel{db}
+			m := UserModel{Pool: db}
 			// Call the UserModel.Exists() method and check that the return
 			// value and error match the expected values for the sub-test.
 			exists, err := m.Exists(tt.userID)
@@ -49,3 +51,163 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelAuthenticateRehash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{Pool: db}
+
+	// alice is stored with a bcrypt hash in setup.sql
+	id, err := m.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	var hash string
+	err = db.QueryRow(context.Background(), "SELECT hashed_password FROM users WHERE id = $1", id).Scan(&hash)
+	assert.NilError(t, err)
+	assert.StringContains(t, hash, "$argon2id$")
+
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+}
+
+func TestUserModelChangeEmail(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{Pool: db}
+
+	_, err := m.CreateEmailChange(1, "wrong", "alice@new.example.com", time.Hour)
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	_, err = m.CreateEmailChange(1, "pa$$word", "alice@example.com", time.Hour)
+	assert.Equal(t, err, ErrDuplicateEmail)
+
+	stale, err := m.CreateEmailChange(1, "pa$$word", "alice@new.example.com", time.Hour)
+	assert.NilError(t, err)
+	token, err := m.CreateEmailChange(1, "pa$$word", "alice@new.example.com", time.Hour)
+	assert.NilError(t, err)
+
+	// only the latest link works
+	_, err = m.ChangeEmail(stale, 0)
+	assert.Equal(t, err, ErrInvalidToken)
+
+	// a reset link sent to the old address and the other sessions don't
+	// survive the change
+	reset, err := m.CreatePasswordReset("alice@example.com", time.Hour)
+	assert.NilError(t, err)
+	sessions := SessionModel{Pool: db}
+	here, err := sessions.Insert(1, "here-token", "Firefox on Linux", "192.0.2.1")
+	assert.NilError(t, err)
+	elsewhere, err := sessions.Insert(1, "elsewhere-token", "Safari on iOS", "192.0.2.2")
+	assert.NilError(t, err)
+
+	change, err := m.ChangeEmail(token, here)
+	assert.NilError(t, err)
+
+	_, err = m.ResetPassword(reset, "new-Lantern-42")
+	assert.Equal(t, err, ErrInvalidToken)
+	ok, err := sessions.Touch(here, 1, "here-token", "192.0.2.1")
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+	ok, err = sessions.Touch(elsewhere, 1, "elsewhere-token", "192.0.2.2")
+	assert.NilError(t, err)
+	assert.Equal(t, ok, false)
+	assert.Equal(t, change.OldEmail, "alice@example.com")
+	assert.Equal(t, change.NewEmail, "alice@new.example.com")
+
+	user, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Email, "alice@new.example.com")
+	assert.Equal(t, user.Verified, true)
+
+	_, err = m.ChangeEmail(token, 0)
+	assert.Equal(t, err, ErrInvalidToken)
+
+	// someone signs up with the address before the link is opened
+	token, err = m.CreateEmailChange(1, "pa$$word", "bob@example.com", time.Hour)
+	assert.NilError(t, err)
+	_, err = m.Insert("Bob", "bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+	_, err = m.ChangeEmail(token, 0)
+	assert.Equal(t, err, ErrDuplicateEmail)
+}
+
+func TestUserModelRequirePasswordReset(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{Pool: db}
+	sessions := SessionModel{Pool: db}
+
+	stale, err := m.CreatePasswordReset("alice@example.com", time.Hour)
+	assert.NilError(t, err)
+	session, err := sessions.Insert(1, "laptop-token", "Firefox on Linux", "192.0.2.1")
+	assert.NilError(t, err)
+
+	token, err := m.RequirePasswordReset(1, time.Hour)
+	assert.NilError(t, err)
+
+	user, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.PasswordResetRequired, true)
+	ok, err := sessions.Touch(session, 1, "laptop-token", "192.0.2.1")
+	assert.NilError(t, err)
+	assert.Equal(t, ok, false)
+
+	_, err = m.ResetPassword(stale, "new-Lantern-42")
+	assert.Equal(t, err, ErrInvalidToken)
+	_, err = m.ResetPassword(token, "new-Lantern-42")
+	assert.NilError(t, err)
+
+	user, err = m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.PasswordResetRequired, false)
+
+	_, err = m.RequirePasswordReset(99, time.Hour)
+	assert.Equal(t, err, ErrNoRecord)
+
+	// LIKE wildcards in a search are matched literally
+	users, err := m.Search("%", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 0)
+}
+
+func TestUserModelSSOLogin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := UserModel{Pool: db}
+
+	// addresses are matched whatever their case
+	_, err := m.Insert("Alice Again", "alice2", "ALICE@example.com", "pa$$word")
+	assert.Equal(t, err, ErrDuplicateEmail)
+	user, err := m.GetByEmail("Alice@Example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, user.Id, 1)
+
+	// alice hasn't verified her address, so the provider can't claim it
+	_, err = m.SSOLogin("https://idp.example", "alice-sub", "Alice@Example.com", "Alice", true)
+	assert.Equal(t, err, ErrUnverifiedAccount)
+
+	err = m.Verify(1, "alice@example.com")
+	assert.NilError(t, err)
+	id, err := m.SSOLogin("https://idp.example", "alice-sub", "Alice@Example.com", "Alice", true)
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	id, err = m.SSOLogin("https://idp.example", "bob-sub", "Bob@Corp.example", "Bob", true)
+	assert.NilError(t, err)
+	user, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Email, "bob@corp.example")
+	assert.Equal(t, user.Verified, true)
+}
@@ -0,0 +1,149 @@
+package passwords
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxBreachLine is the longest line Contains can read. The Have I Been Pwned
+// lines are a 40 character hash, a colon and a count.
+const maxBreachLine = 512
+
+// BreachList is a set of passwords known from data breaches, kept as their
+// SHA-1 hashes. The list is a file with one hex encoded hash per line, sorted
+// by hash and optionally followed by a colon and a count, like the "ordered
+// by hash" downloads from Have I Been Pwned. Blank lines and lines starting
+// with # may only come before the first hash. The file is searched where it
+// is rather than read into memory, those downloads run to tens of gigabytes.
+type BreachList struct {
+	r    io.ReaderAt
+	size int64
+}
+
+// OpenBreachList opens the breach list in the file at path. It stays open
+// until Close is called.
+func OpenBreachList(path string) (*BreachList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return NewBreachList(f, info.Size()), nil
+}
+
+// NewBreachList searches the size bytes of r, laid out like a breach list
+// file.
+func NewBreachList(r io.ReaderAt, size int64) *BreachList {
+	return &BreachList{r: r, size: size}
+}
+
+// Close closes the file of a list opened with OpenBreachList.
+func (l *BreachList) Close() error {
+	if c, ok := l.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Contains reports whether password is on the list. It binary searches the
+// byte offsets of the file, reading the first line that starts at or after
+// each one.
+func (l *BreachList) Contains(password string) (bool, error) {
+	hash := sha1.Sum([]byte(password))
+
+	// lines starting in [lo, hi) are left to search
+	lo, hi := int64(0), l.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := l.lineAt(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		c, err := compareLine(line, hash)
+		if err != nil {
+			return false, fmt.Errorf("passwords: breach list line at byte %d: %w", start, err)
+		}
+		switch {
+		case c == 0:
+			return true, nil
+		case c < 0:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineAt returns the first line that starts at or after offset, without its
+// newline, and where it starts. At the end of the list it returns l.size.
+func (l *BreachList) lineAt(offset int64) (int64, []byte, error) {
+	// Reading from the byte before offset tells whether a line starts right
+	// at offset.
+	from := max(offset-1, 0)
+	buf := make([]byte, 2*maxBreachLine)
+	n, err := l.r.ReadAt(buf, from)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, err
+	}
+	buf = buf[:n]
+
+	start := 0
+	if offset > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			if from+int64(n) >= l.size {
+				return l.size, nil, nil
+			}
+			return 0, nil, fmt.Errorf("passwords: breach list has a line longer than %d bytes", maxBreachLine)
+		}
+		start = i + 1
+	}
+	if from+int64(start) >= l.size {
+		return l.size, nil, nil
+	}
+
+	line := buf[start:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	} else if from+int64(n) < l.size {
+		return 0, nil, fmt.Errorf("passwords: breach list has a line longer than %d bytes", maxBreachLine)
+	}
+	return from + int64(start), line, nil
+}
+
+// compareLine compares the hash on a breach list line with hash. Blank lines
+// and comments come before every hash.
+func compareLine(line []byte, hash [sha1.Size]byte) (int, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] == '#' {
+		return -1, nil
+	}
+	line, _, _ = bytes.Cut(line, []byte(":"))
+
+	var lineHash [sha1.Size]byte
+	if hex.DecodedLen(len(line)) != sha1.Size {
+		return 0, errors.New("not a SHA-1 hash")
+	}
+	_, err := hex.Decode(lineHash[:], line)
+	if err != nil {
+		return 0, errors.New("not a SHA-1 hash")
+	}
+	return bytes.Compare(lineHash[:], hash[:]), nil
+}
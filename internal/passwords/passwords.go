@@ -0,0 +1,59 @@
+// Package passwords hashes and verifies user passwords. New passwords are
+// hashed with the current algorithm of a Policy, while hashes made with an
+// older algorithm or older parameters keep working until they are replaced.
+package passwords
+
+import (
+	"errors"
+)
+
+// ErrUnknownHash is returned for a hash that no hasher of the policy
+// recognizes.
+var ErrUnknownHash = errors.New("passwords: unknown hash format")
+
+// Hasher hashes passwords in one format. Hashes carry their own salt and
+// parameters, so any hash a Hasher recognizes can be compared, whatever the
+// Hasher's own parameters are.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) (bool, error)
+	Recognizes(hash string) bool
+	Current(hash string) bool
+}
+
+// Policy hashes new passwords with Hasher and still accepts the hashes of
+// Legacy.
+type Policy struct {
+	Hasher Hasher
+	Legacy []Hasher
+}
+
+// DefaultPolicy hashes with argon2id and accepts bcrypt hashes from before.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Hasher: DefaultArgon2id(),
+		Legacy: []Hasher{Bcrypt{Cost: 12}},
+	}
+}
+
+func (p *Policy) Hash(password string) (string, error) {
+	return p.Hasher.Hash(password)
+}
+
+// Verify reports whether password matches hash, and if it does whether the
+// hash should be replaced because it doesn't follow the policy anymore.
+func (p *Policy) Verify(hash, password string) (match bool, rehash bool, err error) {
+	if p.Hasher.Recognizes(hash) {
+		match, err = p.Hasher.Compare(hash, password)
+		return match, match && !p.Hasher.Current(hash), err
+	}
+
+	for _, hasher := range p.Legacy {
+		if hasher.Recognizes(hash) {
+			match, err = hasher.Compare(hash, password)
+			return match, match, err
+		}
+	}
+
+	return false, false, ErrUnknownHash
+}
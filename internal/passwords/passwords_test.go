@@ -0,0 +1,122 @@
+package passwords
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-webserver/internal/assert"
+)
+
+// fast keeps the tests quick; the parameters don't matter for correctness.
+var fast = Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2id(t *testing.T) {
+	hash, err := fast.Hash("pa$$word")
+	assert.NilError(t, err)
+	assert.StringContains(t, hash, "$argon2id$v=19$m=1024,t=1,p=1$")
+
+	other, err := fast.Hash("pa$$word")
+	assert.NilError(t, err)
+	assert.Equal(t, hash == other, false)
+
+	match, err := fast.Compare(hash, "pa$$word")
+	assert.NilError(t, err)
+	assert.Equal(t, match, true)
+
+	match, err = fast.Compare(hash, "wrong")
+	assert.NilError(t, err)
+	assert.Equal(t, match, false)
+
+	assert.Equal(t, fast.Recognizes(hash), true)
+	assert.Equal(t, fast.Current(hash), true)
+
+	slower := fast
+	slower.Iterations = 2
+	assert.Equal(t, slower.Current(hash), false)
+}
+
+func TestArgon2idMalformed(t *testing.T) {
+	hashes := []string{
+		"$argon2id$",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$",
+	}
+
+	for _, hash := range hashes {
+		t.Run(hash, func(t *testing.T) {
+			_, err := fast.Compare(hash, "pa$$word")
+			assert.Equal(t, err, errMalformedArgon2id)
+		})
+	}
+}
+
+func TestPolicyVerify(t *testing.T) {
+	policy := &Policy{Hasher: fast, Legacy: []Hasher{Bcrypt{Cost: 4}}}
+
+	current, err := policy.Hash("pa$$word")
+	assert.NilError(t, err)
+
+	legacy, err := Bcrypt{Cost: 4}.Hash("pa$$word")
+	assert.NilError(t, err)
+
+	weaker := fast
+	weaker.Memory = 512
+	outdated, err := weaker.Hash("pa$$word")
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name       string
+		hash       string
+		password   string
+		wantMatch  bool
+		wantRehash bool
+	}{
+		{
+			name:      "Current hash",
+			hash:      current,
+			password:  "pa$$word",
+			wantMatch: true,
+		},
+		{
+			name:     "Wrong password",
+			hash:     current,
+			password: "wrong",
+		},
+		{
+			name:       "Legacy hash",
+			hash:       legacy,
+			password:   "pa$$word",
+			wantMatch:  true,
+			wantRehash: true,
+		},
+		{
+			name:     "Legacy hash, wrong password",
+			hash:     legacy,
+			password: "wrong",
+		},
+		{
+			name:       "Outdated parameters",
+			hash:       outdated,
+			password:   "pa$$word",
+			wantMatch:  true,
+			wantRehash: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := policy.Verify(tt.hash, tt.password)
+			assert.NilError(t, err)
+			assert.Equal(t, match, tt.wantMatch)
+			assert.Equal(t, rehash, tt.wantRehash)
+		})
+	}
+
+	t.Run("Unknown format", func(t *testing.T) {
+		_, _, err := policy.Verify(strings.Repeat("x", 60), "pa$$word")
+		assert.Equal(t, errors.Is(err, ErrUnknownHash), true)
+	})
+}
@@ -0,0 +1,306 @@
+package passwords
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The reasons Checker.Check rejects a password.
+var (
+	ErrBreached = errors.New("passwords: password appears in a data breach")
+	ErrPersonal = errors.New("passwords: password is based on the user's name or email address")
+	ErrCommon   = errors.New("passwords: password is based on a common password")
+	ErrPattern  = errors.New("passwords: password is made of repeats or sequences")
+	ErrWeak     = errors.New("passwords: password is too easy to guess")
+)
+
+// DefaultMinEntropy is about what eight random lowercase letters give.
+const DefaultMinEntropy = 36
+
+// Checker rejects passwords that are on the Breached list, when there is one,
+// or that Estimate puts below MinEntropy bits.
+type Checker struct {
+	Breached   *BreachList
+	MinEntropy float64
+}
+
+// Check returns nil for an acceptable password, one of the errors above, or
+// the error from reading the breach list. userInputs are things an attacker
+// knows about the user, such as their name and email address.
+func (c *Checker) Check(password string, userInputs ...string) error {
+	if c.Breached != nil {
+		breached, err := c.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrBreached
+		}
+	}
+
+	minEntropy := c.MinEntropy
+	if minEntropy == 0 {
+		minEntropy = DefaultMinEntropy
+	}
+
+	bits, weakness := Estimate(password, userInputs...)
+	if bits < minEntropy {
+		return weakness
+	}
+	return nil
+}
+
+// Estimate returns roughly how many bits of entropy password has, and the
+// main reason it has fewer than its length suggests. Common words, the user's
+// own details, years, repeats and sequences like "abc" or "qwerty" count as a
+// single character each, the rest counts by the kinds of characters used.
+func Estimate(password string, userInputs ...string) (float64, error) {
+	runes := []rune(strings.ToLower(password))
+	if len(runes) == 0 {
+		return 0, ErrWeak
+	}
+
+	e := estimator{
+		runes:   runes,
+		plain:   unleet(runes),
+		covered: make([]bool, len(runes)),
+	}
+
+	var weakness error
+	if e.words(personalWords(userInputs)) {
+		weakness = ErrPersonal
+	}
+	if e.words(commonWords) && weakness == nil {
+		weakness = ErrCommon
+	}
+	years, sequences, repeats := e.years(), e.sequences(), e.repeats()
+	if (years || sequences || repeats) && weakness == nil {
+		weakness = ErrPattern
+	}
+	if weakness == nil {
+		weakness = ErrWeak
+	}
+
+	length := e.tokens
+	for _, covered := range e.covered {
+		if !covered {
+			length++
+		}
+	}
+
+	return float64(length) * math.Log2(float64(charsetSize(password))), weakness
+}
+
+// estimator covers the parts of a password that follow a pattern. Each
+// covered part counts as one token.
+type estimator struct {
+	runes   []rune
+	plain   []rune
+	covered []bool
+	tokens  int
+}
+
+// cover marks runes[i:j] as one token, unless part of it is already covered.
+func (e *estimator) cover(i, j int) bool {
+	if slices.Contains(e.covered[i:j], true) {
+		return false
+	}
+	for k := i; k < j; k++ {
+		e.covered[k] = true
+	}
+	e.tokens++
+	return true
+}
+
+// words covers every occurrence of words, as typed or with l33t substitutions.
+func (e *estimator) words(words []string) bool {
+	found := false
+	for _, word := range words {
+		w := []rune(word)
+		for i := 0; i+len(w) <= len(e.runes); i++ {
+			if (slices.Equal(e.runes[i:i+len(w)], w) || slices.Equal(e.plain[i:i+len(w)], w)) && e.cover(i, i+len(w)) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// years covers four digit years from 1900 to 2099.
+func (e *estimator) years() bool {
+	found := false
+	for i := 0; i+4 <= len(e.runes); i++ {
+		year := string(e.runes[i : i+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && strings.Trim(year, "0123456789") == "" && e.cover(i, i+4) {
+			found = true
+		}
+	}
+	return found
+}
+
+// sequences covers runs of at least three characters that repeat one
+// character or step through the alphabet, the digits or a keyboard row in one
+// direction.
+func (e *estimator) sequences() bool {
+	found := false
+	for i := 0; i+2 < len(e.runes); {
+		s, ok := step(e.runes[i], e.runes[i+1])
+		j := i + 1
+		for ok && j+1 < len(e.runes) {
+			next, follows := step(e.runes[j], e.runes[j+1])
+			if !follows || next != s {
+				break
+			}
+			j++
+		}
+		if ok && j-i >= 2 && e.cover(i, j+1) {
+			found = true
+			i = j + 1
+			continue
+		}
+		i++
+	}
+	return found
+}
+
+// repeats covers blocks of two to four characters that directly repeat the
+// block before them, like the second "ab" of "abab".
+func (e *estimator) repeats() bool {
+	found := false
+	for size := 4; size >= 2; size-- {
+		for i := 0; i+2*size <= len(e.runes); i++ {
+			if slices.Equal(e.runes[i:i+size], e.runes[i+size:i+2*size]) && e.cover(i+size, i+2*size) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// step describes how b follows a: 0 for a repeat, ±1 for neighbours in the
+// alphabet or the digits, ±2 for neighbours on a keyboard row.
+func step(a, b rune) (int, bool) {
+	if a == b {
+		return 0, true
+	}
+	if isAlnum(a) && isAlnum(b) && (b == a+1 || b == a-1) {
+		return int(b - a), true
+	}
+	for _, row := range keyboardRows {
+		i, j := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (j == i+1 || j == i-1) {
+			return 2 * (j - i), true
+		}
+	}
+	return 0, false
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// unleet undoes common letter substitutions, so "p@$$w0rd" reads "password".
+func unleet(runes []rune) []rune {
+	plain := make([]rune, len(runes))
+	for i, r := range runes {
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+		plain[i] = r
+	}
+	return plain
+}
+
+// personalWords splits names and email addresses into the words an attacker
+// would try, longest first.
+func personalWords(userInputs []string) []string {
+	var words []string
+	for _, input := range userInputs {
+		input = strings.ToLower(input)
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			words = append(words, local)
+		}
+		words = append(words, strings.FieldsFunc(input, func(r rune) bool {
+			return !isAlnum(r)
+		})...)
+	}
+
+	words = slices.DeleteFunc(words, func(word string) bool {
+		return utf8.RuneCountInString(word) < 3
+	})
+	sortLongestFirst(words)
+	return words
+}
+
+func sortLongestFirst(words []string) {
+	slices.SortStableFunc(words, func(a, b string) int {
+		return utf8.RuneCountInString(b) - utf8.RuneCountInString(a)
+	})
+}
+
+// charsetSize returns how many characters an attacker has to try for each
+// position, given the kinds of characters password uses.
+func charsetSize(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if other {
+		size += 33
+	}
+	return size
+}
+
+// commonWords are the bases of the most used passwords.
+var commonWords = func() []string {
+	words := []string{
+		"password", "passwort", "qwerty", "letmein", "welcome", "admin", "administrator",
+		"login", "master", "monkey", "dragon", "football", "baseball", "basketball",
+		"soccer", "hockey", "sunshine", "princess", "iloveyou", "trustno", "shadow",
+		"superman", "batman", "starwars", "pokemon", "minecraft", "michael", "jennifer",
+		"jordan", "hunter", "ranger", "buster", "thomas", "robert", "charlie", "daniel",
+		"andrew", "jessica", "ashley", "michelle", "matthew", "joshua", "pepper",
+		"ginger", "cookie", "cheese", "summer", "winter", "spring", "autumn", "january",
+		"february", "march", "april", "june", "july", "august", "september", "october",
+		"november", "december", "monday", "tuesday", "wednesday", "thursday", "friday",
+		"saturday", "sunday", "secret", "freedom", "whatever", "computer", "internet",
+		"samsung", "google", "apple", "orange", "banana", "chocolate", "flower",
+		"purple", "silver", "golden", "diamond", "tigger", "hello", "lovely", "loveme",
+		"love", "angel", "test", "guest", "default", "changeme", "snippet", "snippetbox",
+		"access", "mustang", "harley", "killer", "maggie", "hannah", "pass", "user",
+		"root", "demo", "temp",
+	}
+	sortLongestFirst(words)
+	return words
+}()
@@ -0,0 +1,80 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go-webserver/internal/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		password   string
+		userInputs []string
+		want       error
+	}{
+		{password: "password1", want: ErrCommon},
+		{password: "P@ssw0rd!", want: ErrCommon},
+		{password: "Summer2024!", want: ErrCommon},
+		{password: "qwertyuiop", want: ErrCommon},
+		{password: "abcd1234", want: ErrPattern},
+		{password: "zxcvbnm,./", want: ErrPattern},
+		{password: "aaaaaaaaaaaa", want: ErrPattern},
+		{password: "xoxoxoxoxo", want: ErrPattern},
+		{password: "x7#Kp", want: ErrWeak},
+		{password: "alice1987", userInputs: []string{"Alice Jones", "alice@example.com"}, want: ErrPersonal},
+		{password: "j0nes-4lice", userInputs: []string{"Alice Jones", "alice@example.com"}, want: ErrPersonal},
+		{password: "zkqvmtrp"},
+		{password: "Tr0ub4dor&3"},
+		{password: "correct horse battery staple"},
+		{password: "alice-likes-purple-kites", userInputs: []string{"Alice Jones"}},
+	}
+
+	checker := &Checker{}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			assert.Equal(t, checker.Check(tt.password, tt.userInputs...), tt.want)
+		})
+	}
+}
+
+func TestBreachList(t *testing.T) {
+	hash := sha1.Sum([]byte("Tr0ub4dor&3"))
+	hashes := []string{
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:10434004",
+		strings.ToUpper(hex.EncodeToString(hash[:])) + ":4051",
+	}
+	for i := range 200 {
+		hash := sha1.Sum([]byte(strconv.Itoa(i)))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(hash[:]))+":1")
+	}
+	slices.Sort(hashes)
+	file := "# breached passwords\r\n\r\n" + strings.Join(hashes, "\r\n")
+	list := NewBreachList(strings.NewReader(file), int64(len(file)))
+
+	for _, password := range []string{"Tr0ub4dor&3", "password", "0", "199"} {
+		found, err := list.Contains(password)
+		assert.NilError(t, err)
+		assert.Equal(t, found, true)
+	}
+	found, err := list.Contains("correct horse battery staple")
+	assert.NilError(t, err)
+	assert.Equal(t, found, false)
+
+	checker := &Checker{Breached: list}
+	assert.Equal(t, checker.Check("Tr0ub4dor&3"), ErrBreached)
+	assert.Equal(t, checker.Check("correct horse battery staple"), nil)
+
+	empty := NewBreachList(strings.NewReader(""), 0)
+	found, err = empty.Contains("password")
+	assert.NilError(t, err)
+	assert.Equal(t, found, false)
+
+	broken := NewBreachList(strings.NewReader("not a hash\n"), 11)
+	_, err = broken.Contains("password")
+	assert.Equal(t, err != nil, true)
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var tokenRX = regexp.MustCompile(`[A-Za-z0-9+/=_\-]+`)
+
+// EntropyRule flags long tokens whose Shannon entropy suggests random key
+// material rather than words or identifiers.
+type EntropyRule struct {
+	MinLength int
+	Threshold float64
+}
+
+func (r EntropyRule) Name() string {
+	return "high-entropy"
+}
+
+func (r EntropyRule) Scan(content string) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(content, "\n") {
+		for _, token := range tokenRX.FindAllString(line, -1) {
+			if len(token) < r.MinLength || !mixed(token) {
+				continue
+			}
+
+			if shannonEntropy(token) >= r.Threshold {
+				findings = append(findings, Finding{
+					Rule:        r.Name(),
+					Description: "High-entropy token",
+					Line:        i + 1,
+					Match:       redact(token),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// mixed reports whether token contains both letters and digits, which filters
+// out long words and plain numbers.
+func mixed(token string) bool {
+	var letter, digit bool
+	for _, r := range token {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return letter && digit
+}
+
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	var entropy float64
+	length := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
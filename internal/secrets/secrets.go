@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Finding describes a single suspected secret inside a piece of content.
+type Finding struct {
+	Rule        string
+	Description string
+	Line        int
+	Match       string
+}
+
+// Rule is a single detection strategy. New detectors only need to satisfy this
+// interface to be plugged into a Scanner.
+type Rule interface {
+	Name() string
+	Scan(content string) []Finding
+}
+
+type Scanner struct {
+	rules []Rule
+}
+
+func NewScanner(rules ...Rule) *Scanner {
+	return &Scanner{rules: rules}
+}
+
+// Scan runs every rule against content and returns the findings ordered by line.
+func (s *Scanner) Scan(content string) []Finding {
+	var findings []Finding
+	for _, rule := range s.rules {
+		findings = append(findings, rule.Scan(content)...)
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return a.Line - b.Line
+	})
+
+	return findings
+}
+
+func (s *Scanner) Rules() []string {
+	names := make([]string, 0, len(s.rules))
+	for _, rule := range s.rules {
+		names = append(names, rule.Name())
+	}
+	return names
+}
+
+// RegexRule flags every match of Pattern.
+type RegexRule struct {
+	RuleName    string
+	Description string
+	Pattern     *regexp.Regexp
+}
+
+func (r RegexRule) Name() string {
+	return r.RuleName
+}
+
+func (r RegexRule) Scan(content string) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(content, "\n") {
+		for _, match := range r.Pattern.FindAllString(line, -1) {
+			findings = append(findings, Finding{
+				Rule:        r.RuleName,
+				Description: r.Description,
+				Line:        i + 1,
+				Match:       redact(match),
+			})
+		}
+	}
+	return findings
+}
+
+// redact keeps just enough of a match for the author to recognise it, the rest
+// is never echoed back in the page.
+func redact(match string) string {
+	match = strings.TrimSpace(match)
+	if len(match) <= 8 {
+		return strings.Repeat("*", len(match))
+	}
+	return match[:6] + strings.Repeat("*", 6)
+}
+
+func DefaultRules() []Rule {
+	return []Rule{
+		RegexRule{
+			RuleName:    "private-key",
+			Description: "Private key",
+			Pattern:     regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`),
+		},
+		RegexRule{
+			RuleName:    "aws-access-key",
+			Description: "AWS access key ID",
+			Pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`),
+		},
+		RegexRule{
+			RuleName:    "gcp-api-key",
+			Description: "Google Cloud API key",
+			Pattern:     regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+		},
+		RegexRule{
+			RuleName:    "github-token",
+			Description: "GitHub token",
+			Pattern:     regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`),
+		},
+		RegexRule{
+			RuleName:    "jwt",
+			Description: "JSON Web Token",
+			Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+		},
+		RegexRule{
+			RuleName:    "env-password",
+			Description: "Password assignment",
+			Pattern:     regexp.MustCompile(`(?i)^\s*(?:export\s+)?[A-Z0-9_]*(?:PASSWORD|PASSWD|PWD|SECRET)[A-Z0-9_]*\s*=\s*\S+`),
+		},
+		EntropyRule{MinLength: 24, Threshold: 4.0},
+	}
+}
+
+// Select returns the rules from all whose names are not listed in disabled.
+func Select(all []Rule, disabled []string) []Rule {
+	var rules []Rule
+	for _, rule := range all {
+		if !slices.Contains(disabled, rule.Name()) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
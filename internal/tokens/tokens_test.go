@@ -0,0 +1,65 @@
+package tokens
+
+import (
+	"go-webserver/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner([]byte("test-key"))
+	token := signer.Sign("verify-email", "alice@example.com", time.Hour)
+
+	tests := []struct {
+		name        string
+		token       string
+		purpose     string
+		wantSubject string
+		wantErr     error
+	}{
+		{
+			name:        "Valid",
+			token:       token,
+			purpose:     "verify-email",
+			wantSubject: "alice@example.com",
+		},
+		{
+			name:    "Other purpose",
+			token:   token,
+			purpose: "reset-password",
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "Tampered",
+			token:   token[:len(token)-2] + "xx",
+			purpose: "verify-email",
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "Expired",
+			token:   signer.Sign("verify-email", "alice@example.com", -time.Minute),
+			purpose: "verify-email",
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "Other key",
+			token:   NewSigner([]byte("other-key")).Sign("verify-email", "alice@example.com", time.Hour),
+			purpose: "verify-email",
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "Garbage",
+			token:   "not-a-token",
+			purpose: "verify-email",
+			wantErr: ErrInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := signer.Verify(tt.token, tt.purpose)
+			assert.Equal(t, err, tt.wantErr)
+			assert.Equal(t, subject, tt.wantSubject)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"encoding/base32"
+	"go-webserver/internal/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key from RFC 6238 appendix B.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC lists 8 digit codes, ours are their last 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+			assert.NilError(t, err)
+			assert.Equal(t, code, tt.want)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code, _ := Code(rfcSecret, Step(now))
+
+	tests := []struct {
+		name     string
+		code     string
+		at       time.Time
+		wantStep int64
+		wantOK   bool
+	}{
+		{
+			name:     "Current step",
+			code:     code,
+			at:       now,
+			wantStep: Step(now),
+			wantOK:   true,
+		},
+		{
+			name:     "One step late",
+			code:     code,
+			at:       now.Add(Period * time.Second),
+			wantStep: Step(now),
+			wantOK:   true,
+		},
+		{
+			name: "Two steps late",
+			code: code,
+			at:   now.Add(2 * Period * time.Second),
+		},
+		{
+			name: "Wrong code",
+			code: "123456",
+			at:   now,
+		},
+		{
+			name: "Wrong length",
+			code: "12345",
+			at:   now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Match(rfcSecret, tt.code, tt.at)
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, step, tt.wantStep)
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Snippetbox", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, strings.HasPrefix(uri, "otpauth://totp/Snippetbox:alice@example.com?"), true)
+	assert.StringContains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.StringContains(t, uri, "issuer=Snippetbox")
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NilError(t, err)
+	assert.Equal(t, len(secret), 32)
+
+	_, err = Code(secret, 1)
+	assert.NilError(t, err)
+}
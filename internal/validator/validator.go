@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"encoding/base64"
 	"regexp"
 	"slices"
 	"strings"
@@ -54,10 +55,24 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 
 var EmailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// SlugRegex matches lowercase words separated by single dashes.
+var SlugRegex = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// UsernameRegex matches 3 to 30 lowercase letters, digits, dashes and
+// underscores, starting and ending with a letter or digit.
+var UsernameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,28}[a-z0-9]$`)
+
 func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
 }
 
 func Matches(value string, regex *regexp.Regexp) bool {
 	return regex.MatchString(value)
-}
\ No newline at end of file
+}
+
+// Base64 reports whether value is standard, padded base64 that decodes to at
+// least minBytes bytes.
+func Base64(value string, minBytes int) bool {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(decoded) >= minBytes
+}
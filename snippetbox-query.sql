@@ -80,4 +80,327 @@ CREATE TABLE users(
 ALTER TABLE users
     ADD CONSTRAINT users_uc_email UNIQUE (email);
 
+ALTER TABLE snippets
+    ADD COLUMN language varchar(20) NOT NULL DEFAULT 'text';
 
+CREATE TABLE collections(
+    id serial NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    visibility varchar(20) NOT NULL DEFAULT 'private',
+    created timestamptz NOT NULL
+);
+
+CREATE TABLE collection_snippets(
+    collection_id integer NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    snippet_id varchar(50) NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    PRIMARY KEY (collection_id, snippet_id)
+);
+
+ALTER TABLE snippets
+    ADD COLUMN encryption varchar(30) NOT NULL DEFAULT '';
+
+ALTER TABLE snippets
+    ADD COLUMN slug varchar(60) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX snippets_uc_slug ON snippets(slug) WHERE slug <> '';
+
+ALTER TABLE snippets
+    ADD COLUMN hidden boolean NOT NULL DEFAULT false;
+
+ALTER TABLE users
+    ADD COLUMN moderator boolean NOT NULL DEFAULT false;
+
+CREATE TABLE reports(
+    id serial NOT NULL PRIMARY KEY,
+    snippet_id varchar(50) NOT NULL,
+    reason varchar(30) NOT NULL,
+    details text NOT NULL DEFAULT '',
+    status varchar(20) NOT NULL DEFAULT 'open',
+    created timestamptz NOT NULL
+);
+
+CREATE INDEX idx_reports_status ON reports(status, created);
+
+CREATE TABLE moderation_decisions(
+    id serial NOT NULL PRIMARY KEY,
+    report_id integer NOT NULL REFERENCES reports(id),
+    snippet_id varchar(50) NOT NULL,
+    moderator_id integer NOT NULL REFERENCES users(id),
+    action varchar(20) NOT NULL,
+    reason text NOT NULL,
+    created timestamptz NOT NULL
+);
+
+ALTER TABLE users
+    ADD COLUMN role varchar(20) NOT NULL DEFAULT 'user';
+
+UPDATE
+    users
+SET
+    role = 'moderator'
+WHERE
+    moderator;
+
+ALTER TABLE users
+    DROP COLUMN moderator;
+
+-- Promote the first administrator by hand, the admin panel takes it from there.
+-- UPDATE users SET role = 'admin' WHERE email = 'you@example.com';
+
+ALTER TABLE users
+    ADD COLUMN disabled boolean NOT NULL DEFAULT false,
+    ADD COLUMN password_reset_required boolean NOT NULL DEFAULT false;
+
+ALTER TABLE snippets
+    ADD COLUMN user_id integer REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_snippets_user ON snippets(user_id);
+
+CREATE TABLE account_exports(
+    id serial NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status varchar(20) NOT NULL,
+    archive bytea,
+    created timestamptz NOT NULL,
+    downloaded timestamptz
+);
+
+CREATE INDEX idx_account_exports_created ON account_exports(created);
+
+-- Keep moderation decisions around when the moderator deletes their account.
+ALTER TABLE moderation_decisions
+    ALTER COLUMN moderator_id DROP NOT NULL,
+    DROP CONSTRAINT moderation_decisions_moderator_id_fkey,
+    ADD CONSTRAINT moderation_decisions_moderator_id_fkey FOREIGN KEY (moderator_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Accounts that existed before email verification are trusted as they are.
+ALTER TABLE users
+    ADD COLUMN verified boolean NOT NULL DEFAULT false,
+    ADD COLUMN verification_sent timestamptz;
+
+UPDATE
+    users
+SET
+    verified = true;
+
+CREATE TABLE password_resets(
+    token_hash bytea NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry timestamptz NOT NULL
+);
+
+CREATE INDEX idx_password_resets_user ON password_resets(user_id);
+
+ALTER TABLE users
+    ADD COLUMN totp_secret varchar(64) NOT NULL DEFAULT '',
+    ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes(
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash bytea NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE role_settings(
+    role varchar(20) NOT NULL PRIMARY KEY,
+    require_totp boolean NOT NULL DEFAULT false
+);
+
+CREATE TABLE passkeys(
+    id bytea NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name varchar(50) NOT NULL,
+    credential jsonb NOT NULL,
+    created timestamptz NOT NULL,
+    last_used timestamptz
+);
+
+CREATE INDEX idx_passkeys_user ON passkeys(user_id);
+
+CREATE TABLE user_identities(
+    issuer varchar(255) NOT NULL,
+    subject varchar(255) NOT NULL,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created timestamptz NOT NULL,
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE TABLE login_attempts(
+    key varchar(300) NOT NULL PRIMARY KEY,
+    failures integer NOT NULL,
+    last_failure timestamptz NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_last_failure ON login_attempts(last_failure);
+
+CREATE TABLE user_sessions(
+    id serial NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token text NOT NULL,
+    device varchar(100) NOT NULL,
+    ip varchar(45) NOT NULL,
+    created timestamptz NOT NULL,
+    last_seen timestamptz NOT NULL
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions(user_id);
+
+-- argon2id hashes are longer than bcrypt's 60 characters
+ALTER TABLE users
+    ALTER COLUMN hashed_password TYPE varchar(255);
+
+CREATE TABLE email_changes(
+    token_hash bytea NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email varchar(255) NOT NULL,
+    expiry timestamptz NOT NULL
+);
+
+CREATE INDEX idx_email_changes_user ON email_changes(user_id);
+
+-- existing users get a placeholder they can change on their profile
+ALTER TABLE users
+    ADD COLUMN username varchar(30);
+
+UPDATE users SET username = 'user-' || id;
+
+ALTER TABLE users
+    ALTER COLUMN username SET NOT NULL;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_uc_username UNIQUE (username);
+
+CREATE TABLE orgs(
+    id serial NOT NULL PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    created timestamptz NOT NULL
+);
+
+CREATE TABLE org_members(
+    org_id integer NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role varchar(20) NOT NULL,
+    joined timestamptz NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX idx_org_members_user ON org_members(user_id);
+
+CREATE TABLE org_invitations(
+    token_hash bytea NOT NULL PRIMARY KEY,
+    org_id integer NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+    email varchar(255) NOT NULL,
+    role varchar(20) NOT NULL,
+    invited_by integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry timestamptz NOT NULL
+);
+
+CREATE INDEX idx_org_invitations_org ON org_invitations(org_id);
+
+-- organization snippets are only visible to the organization's members
+ALTER TABLE snippets
+    ADD COLUMN org_id integer REFERENCES orgs(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_snippets_org ON snippets(org_id);
+
+-- audit_events is append-only, rows can be added but never changed or removed
+CREATE TABLE audit_events(
+    id bigserial NOT NULL PRIMARY KEY,
+    event varchar(50) NOT NULL,
+    actor_id integer,
+    user_id integer,
+    ip varchar(45) NOT NULL,
+    user_agent varchar(500) NOT NULL,
+    details jsonb NOT NULL DEFAULT '{}',
+    created timestamptz NOT NULL
+);
+
+CREATE INDEX idx_audit_events_user ON audit_events(user_id, created);
+CREATE INDEX idx_audit_events_created ON audit_events(created);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- the app connects as the role that runs this script, so it loses the
+-- privileges too and the triggers are a second line of defence
+REVOKE UPDATE, DELETE, TRUNCATE ON audit_events FROM PUBLIC, CURRENT_USER;
+
+-- invite codes let people sign up while signups are invite-only
+CREATE TABLE invite_codes(
+    id serial NOT NULL PRIMARY KEY,
+    code_hash bytea NOT NULL UNIQUE,
+    note varchar(255) NOT NULL DEFAULT '',
+    max_uses integer NOT NULL CHECK (max_uses > 0),
+    uses integer NOT NULL DEFAULT 0,
+    revoked boolean NOT NULL DEFAULT false,
+    created_by integer REFERENCES users(id) ON DELETE SET NULL,
+    created timestamptz NOT NULL
+);
+
+-- a use outlives the account it created, so deleting an account doesn't hand
+-- its use of the code back
+CREATE TABLE invite_code_uses(
+    id serial NOT NULL PRIMARY KEY,
+    code_id integer NOT NULL REFERENCES invite_codes(id) ON DELETE CASCADE,
+    user_id integer REFERENCES users(id) ON DELETE SET NULL,
+    used timestamptz NOT NULL
+);
+
+CREATE INDEX idx_invite_code_uses_code ON invite_code_uses(code_id);
+
+-- API tokens let scripts authenticate without a session cookie
+CREATE TABLE api_tokens(
+    id serial NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash bytea NOT NULL UNIQUE,
+    name varchar(100) NOT NULL,
+    scopes text[] NOT NULL,
+    created timestamptz NOT NULL,
+    expiry timestamptz NOT NULL,
+    last_used timestamptz
+);
+
+CREATE INDEX idx_api_tokens_user ON api_tokens(user_id);
+
+-- Email addresses are kept in lower case so an address can't be registered
+-- twice in different case. Accounts that only differ in the case of their
+-- address make this fail, merge them by hand first.
+UPDATE
+    users
+SET
+    email = lower(trim(email))
+WHERE
+    email <> lower(trim(email));
+
+UPDATE
+    email_changes
+SET
+    new_email = lower(trim(new_email))
+WHERE
+    new_email <> lower(trim(new_email));
+
+-- a formatted revision points back at the snippet it was made from
+ALTER TABLE snippets
+    ADD COLUMN parent_id varchar(50) REFERENCES snippets(id) ON DELETE SET NULL;
+
+-- stars users gave snippets, counted on the author's public profile
+CREATE TABLE snippet_stars(
+    snippet_id varchar(50) NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created timestamptz NOT NULL,
+    PRIMARY KEY (snippet_id, user_id)
+);
+
+CREATE INDEX idx_snippet_stars_user ON snippet_stars(user_id);
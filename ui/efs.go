@@ -4,5 +4,5 @@ import "embed"
 
 
 //embed the static dir
-//go:embed "static" "html"
+//go:embed "static" "html" "email"
 var Files embed.FS
@@ -0,0 +1,101 @@
+// End-to-end encryption for snippets. Content is encrypted with AES-256-GCM
+// before the form is submitted and decrypted again on the view page. The key
+// only ever lives in the URL fragment, which browsers never send to the server.
+//
+// Stored format: base64(iv || ciphertext), with a 12 byte iv.
+(function () {
+	var ALGORITHM = "aes-256-gcm";
+
+	function toBase64(bytes) {
+		var binary = "";
+		for (var i = 0; i < bytes.length; i++) {
+			binary += String.fromCharCode(bytes[i]);
+		}
+		return btoa(binary);
+	}
+
+	function fromBase64(value) {
+		var binary = atob(value);
+		var bytes = new Uint8Array(binary.length);
+		for (var i = 0; i < binary.length; i++) {
+			bytes[i] = binary.charCodeAt(i);
+		}
+		return bytes;
+	}
+
+	function toBase64Url(bytes) {
+		return toBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	}
+
+	function fromBase64Url(value) {
+		value = value.replace(/-/g, "+").replace(/_/g, "/");
+		while (value.length % 4) {
+			value += "=";
+		}
+		return fromBase64(value);
+	}
+
+	async function encrypt(plaintext) {
+		var key = await crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt"]);
+		var iv = crypto.getRandomValues(new Uint8Array(12));
+		var ciphertext = await crypto.subtle.encrypt({ name: "AES-GCM", iv: iv }, key, new TextEncoder().encode(plaintext));
+
+		var payload = new Uint8Array(iv.length + ciphertext.byteLength);
+		payload.set(iv, 0);
+		payload.set(new Uint8Array(ciphertext), iv.length);
+
+		var rawKey = new Uint8Array(await crypto.subtle.exportKey("raw", key));
+		return { content: toBase64(payload), key: toBase64Url(rawKey) };
+	}
+
+	async function decrypt(content, encodedKey) {
+		var payload = fromBase64(content);
+		var key = await crypto.subtle.importKey("raw", fromBase64Url(encodedKey), { name: "AES-GCM" }, false, ["decrypt"]);
+		var plaintext = await crypto.subtle.decrypt({ name: "AES-GCM", iv: payload.slice(0, 12) }, key, payload.slice(12));
+		return new TextDecoder().decode(plaintext);
+	}
+
+	function keyFromFragment() {
+		var match = window.location.hash.match(/key=([A-Za-z0-9_-]+)/);
+		return match ? match[1] : null;
+	}
+
+	var form = document.querySelector("form[action='/snippet/create']");
+	if (form) {
+		form.addEventListener("submit", async function (event) {
+			var checkbox = document.getElementById("encrypt");
+			if (!checkbox || !checkbox.checked) {
+				return;
+			}
+
+			event.preventDefault();
+			var result = await encrypt(form.elements["content"].value);
+			form.elements["content"].value = result.content;
+			form.elements["encryption"].value = ALGORITHM;
+
+			// The server answers with a redirect without a fragment, so the
+			// browser carries this one over to the new snippet's page.
+			form.action = "/snippet/create#key=" + result.key;
+			checkbox.checked = false;
+			form.submit();
+		});
+	}
+
+	var code = document.getElementById("ciphertext");
+	if (code) {
+		var status = document.getElementById("encryption-status");
+		var key = keyFromFragment();
+
+		if (code.dataset.encryption !== ALGORITHM) {
+			status.textContent = "This snippet uses an encryption scheme your browser can't decrypt.";
+		} else if (!key) {
+			status.textContent = "This snippet is encrypted and the link has no key. Ask the author for the full link.";
+		} else {
+			decrypt(code.dataset.ciphertext, key).then(function (plaintext) {
+				code.textContent = plaintext;
+			}).catch(function () {
+				status.textContent = "The key in the link can't decrypt this snippet.";
+			});
+		}
+	}
+})();
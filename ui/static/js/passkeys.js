@@ -0,0 +1,118 @@
+// Passkey registration and login. The server hands out WebAuthn options as
+// JSON, binary values are base64url encoded both ways.
+(function () {
+	function toBase64Url(buffer) {
+		var bytes = new Uint8Array(buffer);
+		var binary = "";
+		for (var i = 0; i < bytes.length; i++) {
+			binary += String.fromCharCode(bytes[i]);
+		}
+		return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	}
+
+	function fromBase64Url(value) {
+		value = value.replace(/-/g, "+").replace(/_/g, "/");
+		while (value.length % 4) {
+			value += "=";
+		}
+		var binary = atob(value);
+		var bytes = new Uint8Array(binary.length);
+		for (var i = 0; i < binary.length; i++) {
+			bytes[i] = binary.charCodeAt(i);
+		}
+		return bytes.buffer;
+	}
+
+	function decodeCredentials(list) {
+		return (list || []).map(function (credential) {
+			return Object.assign({}, credential, { id: fromBase64Url(credential.id) });
+		});
+	}
+
+	async function post(form, url, body) {
+		var response = await fetch(url, {
+			method: "POST",
+			headers: { "Content-Type": "application/json", "X-CSRF-Token": form.dataset.csrfToken },
+			body: body ? JSON.stringify(body) : null,
+		});
+		var data = await response.json().catch(function () {
+			return {};
+		});
+		if (!response.ok) {
+			throw new Error(data.error || "Something went wrong, please try again.");
+		}
+		return data;
+	}
+
+	function showError(form, message) {
+		var error = form.querySelector(".error");
+		error.textContent = message;
+		error.hidden = false;
+	}
+
+	async function register(form) {
+		var name = form.elements["name"].value.trim();
+		if (!name) {
+			throw new Error("Please give the passkey a name.");
+		}
+
+		var options = (await post(form, "/account/passkeys/register/begin")).publicKey;
+		options.challenge = fromBase64Url(options.challenge);
+		options.user.id = fromBase64Url(options.user.id);
+		options.excludeCredentials = decodeCredentials(options.excludeCredentials);
+
+		var credential = await navigator.credentials.create({ publicKey: options });
+		return post(form, "/account/passkeys/register/finish?name=" + encodeURIComponent(name), {
+			id: credential.id,
+			rawId: toBase64Url(credential.rawId),
+			type: credential.type,
+			response: {
+				clientDataJSON: toBase64Url(credential.response.clientDataJSON),
+				attestationObject: toBase64Url(credential.response.attestationObject),
+				transports: credential.response.getTransports ? credential.response.getTransports() : [],
+			},
+		});
+	}
+
+	async function login(form) {
+		var options = (await post(form, "/user/login/passkey/begin")).publicKey;
+		options.challenge = fromBase64Url(options.challenge);
+		options.allowCredentials = decodeCredentials(options.allowCredentials);
+
+		var credential = await navigator.credentials.get({ publicKey: options });
+		return post(form, "/user/login/passkey/finish", {
+			id: credential.id,
+			rawId: toBase64Url(credential.rawId),
+			type: credential.type,
+			response: {
+				clientDataJSON: toBase64Url(credential.response.clientDataJSON),
+				authenticatorData: toBase64Url(credential.response.authenticatorData),
+				signature: toBase64Url(credential.response.signature),
+				userHandle: credential.response.userHandle ? toBase64Url(credential.response.userHandle) : null,
+			},
+		});
+	}
+
+	function bind(id, ceremony) {
+		var form = document.getElementById(id);
+		if (!form) {
+			return;
+		}
+		if (!window.PublicKeyCredential) {
+			form.hidden = true;
+			return;
+		}
+
+		form.addEventListener("submit", function (event) {
+			event.preventDefault();
+			ceremony(form).then(function (data) {
+				window.location = data.redirect;
+			}).catch(function (err) {
+				showError(form, err.message);
+			});
+		});
+	}
+
+	bind("passkey-register", register);
+	bind("passkey-login", login);
+})();